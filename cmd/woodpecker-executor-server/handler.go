@@ -2,13 +2,25 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/operantai/woodpecker/internal/imds"
 	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/kubelet"
+	"github.com/operantai/woodpecker/internal/network"
+	"github.com/operantai/woodpecker/internal/rbac"
+	"github.com/operantai/woodpecker/internal/webhook"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func ListK8sSecrets(w http.ResponseWriter, r *http.Request) {
@@ -72,3 +84,211 @@ func CheckEgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// RBACSweep reviews and attempts the sensitive permissions of the service account of the pod in
+// the namespaces given as namespace query parameters, limited to the permission query parameters
+func RBACSweep(w http.ResponseWriter, r *http.Request) {
+	client, err := k8s.NewClientInContainer()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	prober, err := rbac.NewProber(client.RestConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	matrix, err := prober.Sweep(r.Context(), query["namespace"], query["permission"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(matrix); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// InstanceMetadata probes the metadata services of the provider query parameters, at the
+// addresses of the aws, gcp and azure query parameters, the link-local addresses by default
+func InstanceMetadata(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	timeout := 2 * time.Second
+	if query.Get("timeout") != "" {
+		var err error
+		if timeout, err = time.ParseDuration(query.Get("timeout")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	prober := imds.NewProber(imds.Addresses{
+		AWS:   query.Get("aws"),
+		GCP:   query.Get("gcp"),
+		Azure: query.Get("azure"),
+	}, timeout)
+	results, err := prober.Probe(r.Context(), query["provider"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// serviceAccountTokenPath is where the token of the service account of the pod is mounted
+const serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// KubeletAPI probes the kubelets of the node query parameters, given as name=address, or of every
+// node of the cluster when the service account of the pod may list them
+func KubeletAPI(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var nodes []kubelet.Node
+	for _, node := range query["node"] {
+		name, address, found := strings.Cut(node, "=")
+		if !found {
+			http.Error(w, "Invalid node "+node+", expected name=address", http.StatusBadRequest)
+			return
+		}
+		nodes = append(nodes, kubelet.Node{Name: name, Address: address})
+	}
+	if len(nodes) == 0 {
+		client, err := k8s.NewClientInContainer()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list, err := client.Clientset.CoreV1().Nodes().List(r.Context(), metav1.ListOptions{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nodes = kubelet.NodesFromList(list)
+	}
+
+	timeout := 2 * time.Second
+	if query.Get("timeout") != "" {
+		var err error
+		if timeout, err = time.ParseDuration(query.Get("timeout")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// Without a mounted token only the anonymous probes are made
+	token, _ := os.ReadFile(serviceAccountTokenPath)
+	prober := kubelet.NewProber(strings.TrimSpace(string(token)), timeout)
+	for key, port := range map[string]*int{"readOnlyPort": &prober.ReadOnlyPort, "port": &prober.Port} {
+		if query.Get(key) == "" {
+			continue
+		}
+		value, err := strconv.Atoi(query.Get(key))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*port = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(prober.Probe(r.Context(), nodes)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Reachability probes the targets of the network.ReachabilityRequest it is posted
+func Reachability(w http.ResponseWriter, r *http.Request) {
+	var request network.ReachabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := 2 * time.Second
+	if request.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(request.Timeout); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	results, err := network.NewProber(timeout).Reach(r.Context(), request.Targets, request.Protocols)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// NetworkMapping maps the network of the cluster as asked by the network.MappingRequest it is
+// posted
+func NetworkMapping(w http.ResponseWriter, r *http.Request) {
+	var request network.MappingRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := time.Second
+	if request.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(request.Timeout); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	result, err := network.NewMapper(timeout).Map(r.Context(), request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// WebhookReviews returns the admission requests routed through the webhook
+func WebhookReviews(hook *webhook.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(hook.Reviews()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// serveWebhook serves the webhook over TLS in the background, with the certificate and key of the
+// kubernetes.io/tls Secret mounted in the directory
+func serveWebhook(hook *webhook.Server, certDir string) error {
+	certificate, err := tls.LoadX509KeyPair(filepath.Join(certDir, corev1.TLSCertKey), filepath.Join(certDir, corev1.TLSPrivateKeyKey))
+	if err != nil {
+		return fmt.Errorf("Invalid webhook certificate: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(webhook.Path, hook)
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", webhook.Port),
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12},
+	}
+	go func() {
+		log.Printf("starting webhook on :%d", webhook.Port)
+		if err := server.ListenAndServeTLS("", ""); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	return nil
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/operantai/woodpecker/internal/webhook"
 	"log"
 	"net/http"
+	"os"
 )
 
 type Result struct {
@@ -20,6 +22,20 @@ func main() {
 	r := mux.NewRouter()
 	r.HandleFunc("/experiment/CheckEgress/", CheckEgress)
 	r.HandleFunc("/experiment/listKubernetesSecrets/{namespace}", ListK8sSecrets)
+	r.HandleFunc("/experiment/rbac", RBACSweep)
+	r.HandleFunc("/experiment/imds", InstanceMetadata)
+	r.HandleFunc("/experiment/kubelet", KubeletAPI)
+	r.HandleFunc("/experiment/reachability", Reachability).Methods(http.MethodPost)
+	r.HandleFunc("/experiment/mapping", NetworkMapping).Methods(http.MethodPost)
+
+	// The admission webhook is only served when the executor is given its TLS certificate
+	if certDir := os.Getenv(webhook.CertDirEnv); certDir != "" {
+		hook := webhook.NewServer(webhook.Injection{SidecarImage: os.Getenv(webhook.SidecarImageEnv)})
+		r.HandleFunc("/experiment/webhook", WebhookReviews(hook))
+		if err := serveWebhook(hook, certDir); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Start the experiment server
 	log.Print("starting server on :4000")
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/operantai/woodpecker/internal/components"
+	"github.com/operantai/woodpecker/internal/experiments"
 	"github.com/operantai/woodpecker/internal/output"
 	"github.com/operantai/woodpecker/internal/snippets"
 	"github.com/spf13/cobra"
@@ -32,7 +33,7 @@ var componentCmd = &cobra.Command{
 var installComponentCmd = &cobra.Command{
 	Use:   "install",
 	Short: "Install a component",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		files, err := cmd.Flags().GetStringSlice("files")
 		if err != nil {
 			output.WriteError("Error reading file flag: %v", err)
@@ -41,8 +42,9 @@ var installComponentCmd = &cobra.Command{
 		ctx := cmd.Context()
 		comp := components.New(ctx)
 		if err := comp.Add(files); err != nil {
-			output.WriteError("Error installing components %s: %v", strings.Join(files, ","), err)
+			return fmt.Errorf("Error installing components %s: %w", strings.Join(files, ","), err)
 		}
+		return nil
 	},
 }
 
@@ -50,23 +52,24 @@ var installComponentCmd = &cobra.Command{
 var snippetComponentCmd = &cobra.Command{
 	Use:   "snippet",
 	Short: "Print a template of a component out to stdout",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		component, err := cmd.Flags().GetString("component")
 		if err != nil {
 			output.WriteError("Error reading component flag: %v", err)
 		}
 		snippet, err := snippets.GetComponentTemplate(component)
 		if err != nil {
-			output.WriteFatal("Error retrieving component template: %v", err)
+			return &experiments.ConfigError{Err: fmt.Errorf("Error retrieving component template: %w", err)}
 		}
 		fmt.Println(string(snippet))
+		return nil
 	},
 }
 
 var uninstallComponentCmd = &cobra.Command{
 	Use:   "uninstall",
 	Short: "Uninstall a component",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		files, err := cmd.Flags().GetStringSlice("files")
 		if err != nil {
 			output.WriteError("Error reading file flag: %v", err)
@@ -75,8 +78,9 @@ var uninstallComponentCmd = &cobra.Command{
 		ctx := cmd.Context()
 		comp := components.New(ctx)
 		if err := comp.Remove(files); err != nil {
-			output.WriteError("Error uninstalling components %s: %v", strings.Join(files, ","), err)
+			return fmt.Errorf("Error uninstalling components %s: %w", strings.Join(files, ","), err)
 		}
+		return nil
 	},
 }
 
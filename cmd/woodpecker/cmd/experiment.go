@@ -4,10 +4,20 @@ Copyright 2023 Operant AI
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/operantai/woodpecker/internal/experiments"
+	"github.com/operantai/woodpecker/internal/k8s"
 	"github.com/operantai/woodpecker/internal/output"
+	"github.com/operantai/woodpecker/internal/report"
+	"github.com/operantai/woodpecker/internal/results"
 	"github.com/operantai/woodpecker/internal/snippets"
 	"github.com/spf13/cobra"
 )
@@ -32,16 +42,52 @@ var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run an experiment",
 	Long:  "Run an experiment",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		files, err := cmd.Flags().GetStringSlice("file")
 		if err != nil {
 			output.WriteError("Error reading file flag: %v", err)
 		}
+		templating, err := templatingFlags(cmd)
+		if err != nil {
+			return err
+		}
+		selector, err := selectorFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			output.WriteError("Error reading parallel flag: %v", err)
+		}
+		failFast, err := cmd.Flags().GetBool("fail-fast")
+		if err != nil {
+			output.WriteError("Error reading fail-fast flag: %v", err)
+		}
+		dryRun, err := cmd.Flags().GetString("dry-run")
+		if err != nil {
+			output.WriteError("Error reading dry-run flag: %v", err)
+		}
 
 		// Run the experiment
 		ctx := cmd.Context()
-		er := experiments.NewRunner(ctx, files)
-		er.Run()
+		store, err := openResultStore(cmd)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		er, err := experiments.NewRunner(ctx, files,
+			experiments.WithResultStore(store),
+			experiments.WithParallelism(parallel),
+			experiments.WithFailFast(failFast),
+			experiments.WithTemplating(templating),
+			experiments.WithSelector(selector),
+			experiments.WithDryRun(dryRun),
+		)
+		if err != nil {
+			return err
+		}
+		return er.Run()
 	},
 }
 
@@ -49,16 +95,80 @@ var runCmd = &cobra.Command{
 var snippetExperimentCmd = &cobra.Command{
 	Use:   "snippet",
 	Short: "Print a template of an experiment type to stdout",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		experiment, err := cmd.Flags().GetString("experiment")
 		if err != nil {
 			output.WriteError("Error reading experiment flag: %v", err)
 		}
 		snippet, err := snippets.GetExperimentTemplate(experiment)
 		if err != nil {
-			output.WriteFatal("Error retrieving experiment template: %v", err)
+			return &experiments.ConfigError{Err: fmt.Errorf("Error retrieving experiment template: %w", err)}
 		}
 		fmt.Println(string(snippet))
+		return nil
+	},
+}
+
+// validateCmd lints experiment files without touching a cluster
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate experiment files",
+	Long:  "Validate experiment files against the schema of their experiment types, and check that their dependencies resolve, without touching a cluster",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, err := cmd.Flags().GetStringSlice("file")
+		if err != nil {
+			output.WriteError("Error reading file flag: %v", err)
+		}
+		templating, err := templatingFlags(cmd)
+		if err != nil {
+			return err
+		}
+		validateSnippets, err := cmd.Flags().GetBool("snippets")
+		if err != nil {
+			output.WriteError("Error reading snippets flag: %v", err)
+		}
+		if len(files) == 0 && !validateSnippets {
+			return &experiments.ConfigError{Err: errors.New("Nothing to validate, provide experiment files with -f or --snippets")}
+		}
+
+		var errs []error
+		if len(files) > 0 {
+			errs = append(errs, experiments.ValidateFiles(cmd.Context(), files, templating))
+		}
+		if validateSnippets {
+			errs = append(errs, experiments.ValidateSnippets())
+		}
+		if err := errors.Join(errs...); err != nil {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				output.WriteError("%s", line)
+			}
+			return &experiments.ConfigError{Err: errors.New("Validation failed")}
+		}
+		output.WriteSuccess("All experiments are valid")
+		return nil
+	},
+}
+
+// schemaCmd outputs the JSON Schema of experiment files
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of experiment files to stdout",
+	Long:  "Print the JSON Schema of experiment files, or of a single experiment type, to stdout, e.g. for editor completion and validation",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		experiment, err := cmd.Flags().GetString("experiment")
+		if err != nil {
+			output.WriteError("Error reading experiment flag: %v", err)
+		}
+		if experiment == "" {
+			output.WriteJSON(experiments.FileSchema())
+			return nil
+		}
+		s, err := experiments.ExperimentSchema(experiment)
+		if err != nil {
+			return &experiments.ConfigError{Err: err}
+		}
+		output.WriteJSON(s)
+		return nil
 	},
 }
 
@@ -67,20 +177,61 @@ var verifyCmd = &cobra.Command{
 	Use:   "verify",
 	Short: "Verify the outcome of an experiment",
 	Long:  "Verify the outcome of an experiment",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		files, err := cmd.Flags().GetStringSlice("file")
 		if err != nil {
 			output.WriteError("Error reading file flag: %v", err)
 		}
+		templating, err := templatingFlags(cmd)
+		if err != nil {
+			return err
+		}
+		selector, err := selectorFlags(cmd)
+		if err != nil {
+			return err
+		}
 		outputFormat, err := cmd.Flags().GetString("output")
 		if err != nil {
 			output.WriteError("Error reading json output flag: %v", err)
 		}
+		runID, err := cmd.Flags().GetString("run")
+		if err != nil {
+			output.WriteError("Error reading run flag: %v", err)
+		}
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			output.WriteError("Error reading parallel flag: %v", err)
+		}
+		failFast, err := cmd.Flags().GetBool("fail-fast")
+		if err != nil {
+			output.WriteError("Error reading fail-fast flag: %v", err)
+		}
+		outputFile, err := cmd.Flags().GetString("output-file")
+		if err != nil {
+			output.WriteError("Error reading output-file flag: %v", err)
+		}
 
 		// Run the verifiers
 		ctx := cmd.Context()
-		er := experiments.NewRunner(ctx, files)
-		er.RunVerifiers(outputFormat)
+		store, err := openResultStore(cmd)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		er, err := experiments.NewRunner(ctx, files,
+			experiments.WithResultStore(store),
+			experiments.WithRunID(runID),
+			experiments.WithParallelism(parallel),
+			experiments.WithFailFast(failFast),
+			experiments.WithOutputFile(outputFile),
+			experiments.WithReportMetadata(reportMetadata()),
+			experiments.WithTemplating(templating),
+			experiments.WithSelector(selector),
+		)
+		if err != nil {
+			return err
+		}
+		return er.RunVerifiers(outputFormat)
 	},
 }
 
@@ -89,39 +240,439 @@ var cleanCmd = &cobra.Command{
 	Use:   "clean",
 	Short: "Clean up after an experiment run",
 	Long:  "Clean up after an experiment run",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		files, err := cmd.Flags().GetStringSlice("file")
 		if err != nil {
 			output.WriteError("Error reading file flag: %v", err)
 		}
+		templating, err := templatingFlags(cmd)
+		if err != nil {
+			return err
+		}
+		selector, err := selectorFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		runID, err := cmd.Flags().GetString("run")
+		if err != nil {
+			output.WriteError("Error reading run flag: %v", err)
+		}
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			output.WriteError("Error reading parallel flag: %v", err)
+		}
 
 		// Create a new experiment runner and clean up
 		ctx := cmd.Context()
-		er := experiments.NewRunner(ctx, files)
-		er.Cleanup()
+		store, err := openResultStore(cmd)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		er, err := experiments.NewRunner(ctx, files,
+			experiments.WithResultStore(store),
+			experiments.WithRunID(runID),
+			experiments.WithParallelism(parallel),
+			experiments.WithTemplating(templating),
+			experiments.WithSelector(selector),
+		)
+		if err != nil {
+			return err
+		}
+		return er.Cleanup()
 	},
 }
 
+// testCmd runs, verifies and cleans up experiments in one go
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Run, verify and clean up an experiment",
+	Long:  "Run an experiment, wait for it to be ready, verify its outcome and clean it up. Exits with a non-zero status if any check failed.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, err := cmd.Flags().GetStringSlice("file")
+		if err != nil {
+			output.WriteError("Error reading file flag: %v", err)
+		}
+		templating, err := templatingFlags(cmd)
+		if err != nil {
+			return err
+		}
+		selector, err := selectorFlags(cmd)
+		if err != nil {
+			return err
+		}
+		outputFormat, err := cmd.Flags().GetString("output")
+		if err != nil {
+			output.WriteError("Error reading output flag: %v", err)
+		}
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			output.WriteError("Error reading parallel flag: %v", err)
+		}
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			output.WriteError("Error reading timeout flag: %v", err)
+		}
+		failFast, err := cmd.Flags().GetBool("fail-fast")
+		if err != nil {
+			output.WriteError("Error reading fail-fast flag: %v", err)
+		}
+		outputFile, err := cmd.Flags().GetString("output-file")
+		if err != nil {
+			output.WriteError("Error reading output-file flag: %v", err)
+		}
+		dryRun, err := cmd.Flags().GetString("dry-run")
+		if err != nil {
+			output.WriteError("Error reading dry-run flag: %v", err)
+		}
+
+		// Stop on Ctrl-C, the experiments are still cleaned up
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		store, err := openResultStore(cmd)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		er, err := experiments.NewRunner(ctx, files,
+			experiments.WithResultStore(store),
+			experiments.WithParallelism(parallel),
+			experiments.WithFailFast(failFast),
+			experiments.WithOutputFile(outputFile),
+			experiments.WithReportMetadata(reportMetadata()),
+			experiments.WithTemplating(templating),
+			experiments.WithSelector(selector),
+			experiments.WithDryRun(dryRun),
+		)
+		if err != nil {
+			return err
+		}
+		return er.Test(outputFormat, timeout)
+	},
+}
+
+// reportCmd verifies experiments and renders the outcome into a report file
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Generate a report of the outcome of experiments",
+	Long:  "Verify experiments and render their outcome, with a MITRE ATT&CK / ATLAS tactic matrix and the outputs of every check, into a self-contained report file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, err := cmd.Flags().GetStringSlice("file")
+		if err != nil {
+			output.WriteError("Error reading file flag: %v", err)
+		}
+		templating, err := templatingFlags(cmd)
+		if err != nil {
+			return err
+		}
+		selector, err := selectorFlags(cmd)
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			output.WriteError("Error reading format flag: %v", err)
+		}
+		outputFile, err := cmd.Flags().GetString("output-file")
+		if err != nil {
+			output.WriteError("Error reading output-file flag: %v", err)
+		}
+		runID, err := cmd.Flags().GetString("run")
+		if err != nil {
+			output.WriteError("Error reading run flag: %v", err)
+		}
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			output.WriteError("Error reading parallel flag: %v", err)
+		}
+
+		ctx := cmd.Context()
+		store, err := openResultStore(cmd)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		er, err := experiments.NewRunner(ctx, files,
+			experiments.WithResultStore(store),
+			experiments.WithRunID(runID),
+			experiments.WithParallelism(parallel),
+			experiments.WithOutputFile(outputFile),
+			experiments.WithReportMetadata(reportMetadata()),
+			experiments.WithTemplating(templating),
+			experiments.WithSelector(selector),
+		)
+		if err != nil {
+			return err
+		}
+		return er.RunVerifiers(format)
+	},
+}
+
+// historyCmd lists the experiment runs kept in the result store
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past experiment runs",
+	Long:  "List past experiment runs with their verification results",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputFormat, err := cmd.Flags().GetString("output")
+		if err != nil {
+			output.WriteError("Error reading output flag: %v", err)
+		}
+
+		store, err := openResultStore(cmd)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		runs, err := store.ListRuns(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("Failed to list runs: %w", err)
+		}
+		if runs == nil {
+			runs = []*results.Run{}
+		}
+
+		switch strings.ToLower(outputFormat) {
+		case "json":
+			output.WriteJSON(runs)
+		case "yaml":
+			output.WriteYAML(runs)
+		case "":
+			table := output.NewTable([]string{"Run ID", "Started", "Experiments", "Passed", "Failed", "Verified"})
+			for _, run := range runs {
+				passed, failed, verified := "-", "-", "-"
+				if !run.VerifiedAt.IsZero() {
+					passed = strconv.Itoa(run.Passed)
+					failed = strconv.Itoa(run.Failed)
+					verified = run.VerifiedAt.Local().Format(time.DateTime)
+				}
+				table.AddRow([]string{
+					run.ID,
+					run.StartedAt.Local().Format(time.DateTime),
+					strconv.Itoa(len(run.Experiments)),
+					passed,
+					failed,
+					verified,
+				})
+			}
+			table.Render()
+		default:
+			return &experiments.ConfigError{Err: fmt.Errorf("Unknown output format: %s", outputFormat)}
+		}
+		return nil
+	},
+}
+
+// pruneHistoryCmd removes old experiment runs and their results
+var pruneHistoryCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old experiment runs and their results",
+	Long:  "Remove old experiment runs and their results",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		olderThan, err := cmd.Flags().GetDuration("older-than")
+		if err != nil {
+			output.WriteError("Error reading older-than flag: %v", err)
+		}
+		keep, err := cmd.Flags().GetInt("keep")
+		if err != nil {
+			output.WriteError("Error reading keep flag: %v", err)
+		}
+
+		if olderThan <= 0 && keep <= 0 {
+			return &experiments.ConfigError{Err: fmt.Errorf("Either --older-than or --keep is required")}
+		}
+		var before time.Time
+		if olderThan > 0 {
+			before = time.Now().Add(-olderThan)
+		}
+
+		store, err := openResultStore(cmd)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		pruned, err := results.Prune(cmd.Context(), store, before, keep)
+		for _, run := range pruned {
+			output.WriteInfo("Removed run %s", run.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to prune runs: %w", err)
+		}
+		output.WriteSuccess("Removed %d run(s)", len(pruned))
+		return nil
+	},
+}
+
+// templatingFlags returns the templating of experiment files set by the --set, --values, --env
+// and --trust-remote flags
+func templatingFlags(cmd *cobra.Command) (experiments.Templating, error) {
+	sets, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		output.WriteError("Error reading set flag: %v", err)
+	}
+	valuesFiles, err := cmd.Flags().GetStringSlice("values")
+	if err != nil {
+		output.WriteError("Error reading values flag: %v", err)
+	}
+	environment, err := cmd.Flags().GetString("env")
+	if err != nil {
+		output.WriteError("Error reading env flag: %v", err)
+	}
+	trustRemote, err := cmd.Flags().GetBool("trust-remote")
+	if err != nil {
+		output.WriteError("Error reading trust-remote flag: %v", err)
+	}
+	values, err := experiments.ParseValues(valuesFiles, sets)
+	if err != nil {
+		return experiments.Templating{}, &experiments.ConfigError{Err: err}
+	}
+	return experiments.Templating{Values: values, Environment: environment, TrustRemote: trustRemote}, nil
+}
+
+// selectorFlags returns the selector of experiments set by the --select, --framework, --name and
+// --exclude flags
+func selectorFlags(cmd *cobra.Command) (*experiments.Selector, error) {
+	selects, err := cmd.Flags().GetStringArray("select")
+	if err != nil {
+		output.WriteError("Error reading select flag: %v", err)
+	}
+	frameworks, err := cmd.Flags().GetStringSlice("framework")
+	if err != nil {
+		output.WriteError("Error reading framework flag: %v", err)
+	}
+	names, err := cmd.Flags().GetStringSlice("name")
+	if err != nil {
+		output.WriteError("Error reading name flag: %v", err)
+	}
+	excludes, err := cmd.Flags().GetStringArray("exclude")
+	if err != nil {
+		output.WriteError("Error reading exclude flag: %v", err)
+	}
+	return experiments.ParseSelector(selects, frameworks, names, excludes)
+}
+
+// reportMetadata returns the metadata of the reports of verified experiments
+func reportMetadata() report.Metadata {
+	metadata := report.Metadata{Version: Version}
+	// Experiments may run against Docker only, the report is still written without a cluster
+	if clusterContext, err := k8s.CurrentContext(); err == nil {
+		metadata.ClusterContext = clusterContext
+	}
+	return metadata
+}
+
+// openResultStore opens the result store selected by the store flags
+func openResultStore(cmd *cobra.Command) (results.ResultStore, error) {
+	backend, err := cmd.Flags().GetString("store")
+	if err != nil {
+		output.WriteError("Error reading store flag: %v", err)
+	}
+	location, err := cmd.Flags().GetString("store-path")
+	if err != nil {
+		output.WriteError("Error reading store-path flag: %v", err)
+	}
+	store, err := results.New(cmd.Context(), backend, location)
+	if err != nil {
+		err = fmt.Errorf("Failed to open result store: %w", err)
+		if errors.Is(err, results.ErrUnknownStore) {
+			return nil, &experiments.ConfigError{Err: err}
+		}
+		return nil, err
+	}
+	return store, nil
+}
+
+// fileFlagSources describes the experiment files -f accepts
+const fileFlagSources = ": paths, directories, globs, - for stdin, URLs (pinned with #sha256=<hex>) or oci:// artifacts"
+
 func init() {
 	rootCmd.AddCommand(experimentCmd)
 	experimentCmd.AddCommand(runCmd)
 	experimentCmd.AddCommand(verifyCmd)
 	experimentCmd.AddCommand(cleanCmd)
 	experimentCmd.AddCommand(snippetExperimentCmd)
+	experimentCmd.AddCommand(validateCmd)
+	experimentCmd.AddCommand(schemaCmd)
+	experimentCmd.AddCommand(testCmd)
+	experimentCmd.AddCommand(reportCmd)
+	experimentCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(pruneHistoryCmd)
+
+	// Define where experiment results are stored between run, verify and clean
+	experimentCmd.PersistentFlags().String("store", results.Local, fmt.Sprintf("Result store to use (%s)", strings.Join(results.Backends(), "|")))
+	experimentCmd.PersistentFlags().String("store-path", "", "Directory (local), database file (bolt) or namespace (configmap|secret) of the result store")
 
 	// Define the path of the experiment file to run
-	runCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to run")
+	runCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to run"+fileFlagSources)
 	_ = runCmd.MarkFlagRequired("file")
 
-	verifyCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to verify")
+	verifyCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to verify"+fileFlagSources)
 	_ = verifyCmd.MarkFlagRequired("file")
 
-	cleanCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to run")
+	cleanCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to run"+fileFlagSources)
 	_ = cleanCmd.MarkFlagRequired("file")
 
+	// Select the run to verify or clean up, defaults to the latest run of each experiment
+	verifyCmd.Flags().String("run", "", "ID of the run to verify")
+	cleanCmd.Flags().String("run", "", "ID of the run to clean up")
+
+	testCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to test"+fileFlagSources)
+	_ = testCmd.MarkFlagRequired("file")
+	testCmd.Flags().StringP("output", "o", "", fmt.Sprintf("Output results in the provided format (%s)", strings.Join(report.Formats(), "|")))
+	testCmd.Flags().Duration("timeout", 5*time.Minute, "How long to wait for experiments to be ready, and to clean them up")
+
+	reportCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to report on"+fileFlagSources)
+	_ = reportCmd.MarkFlagRequired("file")
+	reportCmd.Flags().String("run", "", "ID of the run to report on")
+	reportCmd.Flags().String("format", report.HTML, fmt.Sprintf("Format of the report (%s)", strings.Join(report.Formats(), "|")))
+	reportCmd.Flags().String("output-file", "woodpecker-report.html", "File to write the report to")
+
+	// Render experiment files with values and environment overlays
+	for _, c := range []*cobra.Command{runCmd, verifyCmd, cleanCmd, testCmd, reportCmd, validateCmd} {
+		c.Flags().StringArray("set", []string{}, "Set a value referenced as ${key} in experiment files, e.g. --set namespace=staging")
+		c.Flags().StringSlice("values", []string{}, "YAML file(s) of values referenced in experiment files")
+		c.Flags().String("env", "", "Environment overlay of the experiment files to apply")
+		c.Flags().Bool("trust-remote", false, "Let experiment files from URLs and OCI artifacts read local environment variables and files")
+	}
+
+	// Select the experiments to process
+	for _, c := range []*cobra.Command{runCmd, verifyCmd, cleanCmd, testCmd, reportCmd} {
+		c.Flags().StringArray("select", []string{}, "Only process experiments matching key=value or key!=value, keys are name, type, namespace, framework, tactic, technique, tag or a label, values can contain * and ?")
+		c.Flags().StringSlice("framework", []string{}, "Only process experiments of the framework(s), e.g. MITRE-ATLAS")
+		c.Flags().StringSlice("name", []string{}, "Only process experiments with matching names, e.g. llm-*")
+		c.Flags().StringArray("exclude", []string{}, "Skip experiments with matching names, or matching key=value")
+	}
+
+	// Run independent experiments concurrently
+	for _, c := range []*cobra.Command{runCmd, verifyCmd, cleanCmd, testCmd, reportCmd} {
+		c.Flags().Int("parallel", 1, "Number of experiments to process at the same time")
+	}
+
+	// Stop at the first failure, clean up always processes every experiment
+	for _, c := range []*cobra.Command{runCmd, verifyCmd, testCmd} {
+		c.Flags().Bool("fail-fast", false, "Stop at the first failed experiment or check")
+	}
+
+	// Check admission policies without creating anything
+	for _, c := range []*cobra.Command{runCmd, testCmd} {
+		c.Flags().String("dry-run", experiments.DryRunNone, fmt.Sprintf("Submit objects with server-side dry-run to record whether admission allows them (%s|%s)", experiments.DryRunNone, experiments.DryRunServer))
+	}
+
+	historyCmd.Flags().StringP("output", "o", "", "Output runs in the provided format (json|yaml)")
+	pruneHistoryCmd.Flags().Duration("older-than", 0, "Remove runs started longer ago than this duration, e.g. 168h")
+	pruneHistoryCmd.Flags().Int("keep", 0, "Number of most recent runs to always keep")
+
+	validateCmd.Flags().StringSliceP("file", "f", []string{}, "Experiment file(s) to validate"+fileFlagSources)
+	validateCmd.Flags().Bool("snippets", false, "Validate the experiment templates embedded in woodpecker")
+	schemaCmd.Flags().StringP("experiment", "e", "", "Experiment type to print the schema of, all types by default")
+
 	snippetExperimentCmd.Flags().StringP("experiment", "e", "", "Experiment to generate a template for")
 	_ = snippetExperimentCmd.MarkFlagRequired("experiment")
 
-	// Output the results in JSON format
-	verifyCmd.Flags().StringP("output", "o", "", "Output results in the provided format (json|yaml)")
+	// Output the results in the given format, to the terminal or to a file
+	verifyCmd.Flags().StringP("output", "o", "", fmt.Sprintf("Output results in the provided format (%s)", strings.Join(report.Formats(), "|")))
+	for _, c := range []*cobra.Command{verifyCmd, testCmd} {
+		c.Flags().String("output-file", "", "Write results to a file, in the output format or the format matching the file extension, and only print a summary")
+	}
 }
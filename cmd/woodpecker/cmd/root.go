@@ -4,6 +4,9 @@ Copyright 2023 Operant AI
 package cmd
 
 import (
+	"os"
+
+	"github.com/operantai/woodpecker/internal/experiments"
 	"github.com/operantai/woodpecker/internal/output"
 	"github.com/spf13/cobra"
 )
@@ -12,14 +15,43 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "woodpecker",
 	Short: "",
-	Long:  "",
+	Long: `Run security experiments against a Kubernetes cluster and verify their outcome.
+
+Exit codes:
+  0  every check passed
+  1  one or more checks failed
+  2  configuration error, e.g. an invalid experiment file or flag
+  3  infrastructure error, e.g. the cluster or result store could not be reached
+  4  the cluster denied the requests of an experiment or verifier, e.g. because of RBAC or an admission policy`,
+	// Once flags and arguments are valid, errors should not print the usage
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := cmd.ValidateRequiredFlags(); err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		return nil
+	},
+	SilenceErrors: true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The process exits with 0 if every check passed, 1 if checks failed, 2 on configuration
+// errors, 3 on infrastructure errors and 4 when the cluster denied the requests of an experiment.
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
+	}
+
+	// Errors returned before the command ran are invalid flags or arguments
+	code := experiments.ExitConfigError
+	if cmd.SilenceUsage {
+		code = experiments.ExitCode(err)
+	}
+	// Failed checks are already reported by the verification summary
+	if code != experiments.ExitChecksFailed {
 		output.WriteError("%s", err.Error())
 	}
+	os.Exit(code)
 }
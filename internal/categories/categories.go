@@ -3,6 +3,8 @@ Copyright 2023 Operant AI
 */
 package categories
 
+import "reflect"
+
 type Framework string
 
 const (
@@ -188,3 +190,46 @@ func init() {
 		AMLExfiltration{LLMDataLeakage: mitreEntry{"AML.T0057", "Exfiltration", "LLM Data Leakage"}},
 	}
 }
+
+// Tactic is a column of a framework matrix, with the techniques of the tactic
+type Tactic struct {
+	ID         string
+	Name       string
+	Techniques []string
+}
+
+// Matrix returns the tactics of the framework with their techniques, in the order of the framework
+func Matrix(framework Framework) []Tactic {
+	var tactics reflect.Value
+	switch framework {
+	case Mitre:
+		tactics = reflect.ValueOf(MITRE)
+	case MitreAtlas:
+		tactics = reflect.ValueOf(MITREATLAS)
+	default:
+		return nil
+	}
+
+	var matrix []Tactic
+	for i := 0; i < tactics.NumField(); i++ {
+		var tactic Tactic
+		seen := make(map[string]bool)
+		techniques := tactics.Field(i)
+		for j := 0; j < techniques.NumField(); j++ {
+			entry := techniques.Field(j).Interface().(mitreEntry)
+			tactic.Name = entry.Tactic
+			// Some entries share a technique, e.g. RCE and Application Exploit
+			if seen[entry.Technique] {
+				continue
+			}
+			seen[entry.Technique] = true
+			tactic.Techniques = append(tactic.Techniques, entry.Technique)
+			// ATLAS IDs are per technique, only MITRE ATT&CK IDs identify the tactic
+			if framework == Mitre {
+				tactic.ID = entry.CategoryID
+			}
+		}
+		matrix = append(matrix, tactic)
+	}
+	return matrix
+}
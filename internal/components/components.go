@@ -2,6 +2,7 @@ package components
 
 import (
 	"context"
+	"fmt"
 	"os"
 
 	"github.com/operantai/woodpecker/internal/output"
@@ -62,9 +63,12 @@ func (i *Installer) Add(files []string) error {
 		}
 
 		output.WriteInfo("Adding component %s", config.Type)
-		component := registry[config.Type]
+		component, ok := registry[config.Type]
+		if !ok {
+			return fmt.Errorf("Component %s does not exist", config.Type)
+		}
 		if err := component.Install(i.ctx, &config); err != nil {
-			output.WriteFatal("Could not install component %s: %s", config.Type, err.Error())
+			return fmt.Errorf("Could not install component %s: %w", config.Type, err)
 		}
 	}
 	return nil
@@ -83,9 +87,12 @@ func (i *Installer) Remove(files []string) error {
 		}
 
 		output.WriteInfo("Removing component %s from Cluster", config.Type)
-		component := registry[config.Type]
+		component, ok := registry[config.Type]
+		if !ok {
+			return fmt.Errorf("Component %s does not exist", config.Type)
+		}
 		if err := component.Uninstall(i.ctx, &config); err != nil {
-			output.WriteFatal("Could not uninstall component %s: %s", config.Type, err.Error())
+			return fmt.Errorf("Could not uninstall component %s: %w", config.Type, err)
 		}
 	}
 	return nil
@@ -2,6 +2,7 @@ package executor
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -26,6 +27,14 @@ type RemoteExecutor struct {
 	ServiceAccountName string
 	TargetPort         int32
 	ImageParameters    []string
+	// SecretVolumes are mounted read-only in the executor container
+	SecretVolumes []SecretVolume
+}
+
+// SecretVolume mounts a Secret in the executor container, each key as a file
+type SecretVolume struct {
+	SecretName string
+	MountPath  string
 }
 type RemoteExecuteAPI struct {
 	Image              string   `yaml:"image"`
@@ -90,6 +99,19 @@ func (r *RemoteExecutorConfig) Deploy(ctx context.Context, client *kubernetes.Cl
 			},
 		},
 	}
+	podSpec := &deployment.Spec.Template.Spec
+	for i, secret := range r.Parameters.SecretVolumes {
+		name := fmt.Sprintf("secret-%d", i)
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secret.SecretName}},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: secret.MountPath,
+			ReadOnly:  true,
+		})
+	}
 	params := r.Parameters
 	if params.ServiceAccountName != "" {
 		deployment.Spec.Template.Spec.ServiceAccountName = params.ServiceAccountName
@@ -132,10 +154,11 @@ func (r *RemoteExecutorConfig) Cleanup(ctx context.Context, client *kubernetes.C
 func prepareImageParameters(imageParameters []string) []corev1.EnvVar {
 	var envVar []corev1.EnvVar
 	for _, param := range imageParameters {
-		parts := strings.Split(param, "=")
+		// Values may contain "=", e.g. base64 encoded values
+		name, value, _ := strings.Cut(param, "=")
 		envVar = append(envVar, corev1.EnvVar{
-			Name:  parts[0],
-			Value: parts[1],
+			Name:  name,
+			Value: value,
 		})
 	}
 
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Dry-run modes of the Runner
+const (
+	// DryRunNone creates the objects of experiments
+	DryRunNone = "none"
+	// DryRunServer submits the objects of experiments with server-side dry-run, recording whether
+	// admission allowed them without persisting them
+	DryRunServer = "server"
+)
+
+// AdmissionExperiment is implemented by experiments that can submit their objects with
+// server-side dry-run
+type AdmissionExperiment interface {
+	Experiment
+	// SupportsDryRun reports whether the experiment honours --dry-run=server
+	SupportsDryRun() bool
+}
+
+// supportsDryRun reports whether an experiment can run in server-side dry-run mode
+func supportsDryRun(e Experiment) bool {
+	a, ok := e.(AdmissionExperiment)
+	return ok && a.SupportsDryRun()
+}
+
+// AdmissionResult records whether admission allowed the objects an experiment submitted with
+// server-side dry-run
+type AdmissionResult struct {
+	DryRun  bool                   `json:"dryRun"`
+	Objects []ManifestObjectResult `json:"objects"`
+}
+
+// isAdmissionDenial reports whether admission rejected an object: a Forbidden error, as returned
+// by Pod Security Admission and RBAC, or an Invalid or BadRequest error of an admission webhook or
+// ValidatingAdmissionPolicy. Other Invalid and BadRequest errors are objects the API server failed
+// to validate, e.g. a malformed manifest, which are not denials.
+func isAdmissionDenial(err error) bool {
+	if apierrors.IsForbidden(err) {
+		return true
+	}
+	if !apierrors.IsInvalid(err) && !apierrors.IsBadRequest(err) {
+		return false
+	}
+	message := err.Error()
+	return strings.Contains(message, "admission webhook") || strings.Contains(message, "ValidatingAdmissionPolicy")
+}
+
+// admission creates the objects of an experiment, or submits them with server-side dry-run when
+// the experiment runs in dry-run mode
+type admission struct {
+	dryRun bool
+	result AdmissionResult
+}
+
+func newAdmission(experimentConfig *ExperimentConfig) *admission {
+	return &admission{
+		dryRun: experimentConfig.dryRun,
+		result: AdmissionResult{DryRun: experimentConfig.dryRun},
+	}
+}
+
+// options returns the options to create objects with
+func (a *admission) options() metav1.CreateOptions {
+	if a.dryRun {
+		return metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.CreateOptions{}
+}
+
+// check handles the error of creating an object. In dry-run mode denials are recorded with their
+// message and not returned, other errors are always returned.
+func (a *admission) check(kind, namespace, name string, err error) error {
+	if !a.dryRun {
+		return err
+	}
+	object := ManifestObjectResult{Kind: kind, Name: name, Namespace: namespace}
+	switch {
+	case err == nil:
+		object.Created = true
+	case isAdmissionDenial(err):
+		object.Message = err.Error()
+	default:
+		return fmt.Errorf("Failed to submit %s %s: %w", kind, name, err)
+	}
+	a.result.Objects = append(a.result.Objects, object)
+	return nil
+}
+
+// createDeployment creates a deployment. In dry-run mode a pod of its template is submitted as
+// well, as Pod Security Admission only warns about deployments and enforces its levels on pods.
+func (a *admission) createDeployment(ctx context.Context, clientset kubernetes.Interface, namespace string, deployment *appsv1.Deployment) error {
+	_, err := clientset.AppsV1().Deployments(namespace).Create(ctx, deployment, a.options())
+	if err := a.check("Deployment", namespace, deployment.Name, err); err != nil || !a.dryRun {
+		return err
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: *deployment.Spec.Template.ObjectMeta.DeepCopy(),
+		Spec:       *deployment.Spec.Template.Spec.DeepCopy(),
+	}
+	pod.Name = deployment.Name
+	pod.Namespace = namespace
+	_, err = clientset.CoreV1().Pods(namespace).Create(ctx, pod, a.options())
+	return a.check("Pod", namespace, pod.Name, err)
+}
+
+// store writes the admission result of a dry-run to the result store, it does nothing otherwise
+func (a *admission) store(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	if !a.dryRun {
+		return nil
+	}
+	resultJSON, err := json.Marshal(a.result)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+// getAdmissionResult returns the admission result of an experiment run in dry-run mode, or nil if
+// the experiment created its objects
+func getAdmissionResult(ctx context.Context, experimentConfig *ExperimentConfig) (*AdmissionResult, error) {
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for i := len(rawResults) - 1; i >= 0; i-- {
+		var result AdmissionResult
+		if err := json.Unmarshal(rawResults[i], &result); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		if result.DryRun {
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+// verify adds a check per object. The attack of a check succeeded when admission allowed the
+// object, the check is successful when that was expected. The denial message is part of the
+// outputs of the check.
+func (r *AdmissionResult) verify(v *verifier.LegacyVerifier, expectSucceeded bool) {
+	for _, object := range r.Objects {
+		check := fmt.Sprintf("%s/%s", strings.ToLower(object.Kind), object.Name)
+		checkAttack(v, check, object.Created, expectSucceeded)
+		v.StoreResultOutputs(check, object)
+	}
+}
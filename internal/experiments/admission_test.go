@@ -0,0 +1,204 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/results"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestIsAdmissionDenial(t *testing.T) {
+	pods := corev1.Resource("pods")
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "Pod Security Admission",
+			err:      apierrors.NewForbidden(pods, "privileged", errors.New(`violates PodSecurity "restricted:latest"`)),
+			expected: true,
+		},
+		{
+			name:     "Admission webhook",
+			err:      apierrors.NewBadRequest(`admission webhook "policy.example.com" denied the request: privileged containers are not allowed`),
+			expected: true,
+		},
+		{
+			name:     "ValidatingAdmissionPolicy",
+			err:      apierrors.NewInvalid(corev1.SchemeGroupVersion.WithKind("Pod").GroupKind(), "privileged", field.ErrorList{field.Invalid(field.NewPath(""), "privileged", "ValidatingAdmissionPolicy 'no-privileged' with binding 'no-privileged' denied request: failed expression")}),
+			expected: true,
+		},
+		{
+			name: "Malformed object",
+			err:  apierrors.NewInvalid(corev1.SchemeGroupVersion.WithKind("Pod").GroupKind(), "privileged", field.ErrorList{field.Required(field.NewPath("spec", "containers"), "")}),
+		},
+		{
+			name: "Bad request",
+			err:  apierrors.NewBadRequest("the object provided is unrecognized"),
+		},
+		{
+			name: "Internal error",
+			err:  apierrors.NewInternalError(assert.AnError),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isAdmissionDenial(test.err))
+		})
+	}
+}
+
+func TestAdmissionCreateDeployment(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "privileged"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "privileged"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "shell", Image: "alpine"}},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		dryRun   bool
+		podErr   error
+		expected map[string]string
+		err      bool
+	}{
+		{
+			name:     "Dry-run denied by Pod Security Admission",
+			dryRun:   true,
+			podErr:   apierrors.NewForbidden(corev1.Resource("pods"), "privileged", errors.New(`violates PodSecurity "restricted:latest"`)),
+			expected: map[string]string{"deployment/privileged": verifier.Success, "pod/privileged": verifier.Fail},
+		},
+		{
+			name:     "Dry-run admitted",
+			dryRun:   true,
+			expected: map[string]string{"deployment/privileged": verifier.Success, "pod/privileged": verifier.Success},
+		},
+		{
+			name:   "Dry-run failure other than a denial",
+			dryRun: true,
+			podErr: apierrors.NewInternalError(assert.AnError),
+			err:    true,
+		},
+		{
+			name:   "Created without dry-run",
+			podErr: apierrors.NewInternalError(assert.AnError),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, err := results.NewLocalStore(t.TempDir())
+			require.NoError(t, err)
+			experimentConfig := &ExperimentConfig{
+				Metadata:    ExperimentMetadata{Name: "privileged", Type: "privileged-container", Namespace: "default"},
+				resultStore: store,
+				runID:       "run",
+				dryRun:      test.dryRun,
+			}
+			clientset := fake.NewSimpleClientset()
+			if test.podErr != nil {
+				clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, test.podErr
+				})
+			}
+
+			a := newAdmission(experimentConfig)
+			err = a.createDeployment(ctx, clientset, "default", deployment.DeepCopy())
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, a.store(ctx, experimentConfig))
+
+			result, err := getAdmissionResult(ctx, experimentConfig)
+			require.NoError(t, err)
+			if !test.dryRun {
+				assert.Nil(t, result)
+				assert.Empty(t, a.options().DryRun)
+				return
+			}
+			assert.Equal(t, []string{metav1.DryRunAll}, a.options().DryRun)
+			require.NotNil(t, result)
+
+			v := verifier.NewLegacy("privileged", "", "", "", "")
+			result.verify(v, true)
+			assert.Equal(t, test.expected, v.GetOutcome().Result)
+			if test.podErr != nil {
+				assert.Contains(t, result.Objects[1].Message, "PodSecurity")
+			}
+		})
+	}
+}
+
+func TestNewRunnerDryRun(t *testing.T) {
+	dir := t.TempDir()
+	supported := filepath.Join(dir, "supported.yaml")
+	require.NoError(t, os.WriteFile(supported, []byte(`
+experiments:
+- metadata:
+    name: privileged
+    namespace: default
+    type: privileged-container
+  parameters:
+    experiment:
+      privileged: true
+    verifier:
+      deployed: true
+`), 0o600))
+	unsupported := filepath.Join(dir, "unsupported.yaml")
+	require.NoError(t, os.WriteFile(unsupported, []byte(`
+experiments:
+- metadata:
+    name: exec
+    namespace: default
+    type: kube-exec
+  parameters:
+    target:
+      pod: my-pod
+      container: my-container
+    command: ["id"]
+`), 0o600))
+	store, err := results.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	r, err := NewRunner(ctx, []string{supported}, WithResultStore(store), WithDryRun(DryRunServer))
+	require.NoError(t, err)
+	assert.True(t, r.experimentsConfig["privileged"].dryRun)
+
+	r, err = NewRunner(ctx, []string{supported}, WithResultStore(store), WithDryRun(DryRunNone))
+	require.NoError(t, err)
+	assert.False(t, r.experimentsConfig["privileged"].dryRun)
+
+	var configErr *ConfigError
+	_, err = NewRunner(ctx, []string{supported, unsupported}, WithResultStore(store), WithDryRun(DryRunServer))
+	require.ErrorAs(t, err, &configErr)
+	assert.EqualError(t, err, "Experiments exec (kube-exec) do not support --dry-run=server")
+
+	_, err = NewRunner(ctx, []string{supported}, WithResultStore(store), WithDryRun("client"))
+	require.ErrorAs(t, err, &configErr)
+	assert.EqualError(t, err, "Invalid dry-run mode client, expected none or server")
+}
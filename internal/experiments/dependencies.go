@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// orderExperiments sorts the experiments so that every experiment comes after the experiments it
+// depends on, experiments without an ordering constraint are sorted by name. It returns an error
+// if an experiment depends on an unknown experiment or if the dependencies form a cycle.
+func orderExperiments(configs map[string]*ExperimentConfig) ([]*ExperimentConfig, error) {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	order := make([]*ExperimentConfig, 0, len(configs))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// Only report the part of the path that forms the cycle
+			for i, p := range path {
+				if p == name {
+					path = path[i:]
+					break
+				}
+			}
+			return fmt.Errorf("Experiment dependencies form a cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		state[name] = visiting
+		e := configs[name]
+		dependencies := append([]string{}, e.Metadata.DependsOn...)
+		sort.Strings(dependencies)
+		for _, dependency := range dependencies {
+			if _, ok := configs[dependency]; !ok {
+				return fmt.Errorf("Experiment %s depends on unknown experiment %s", name, dependency)
+			}
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, e)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// dependents returns the names of the experiments depending on each experiment
+func dependents(configs []*ExperimentConfig) map[string][]string {
+	result := make(map[string][]string)
+	for _, e := range configs {
+		for _, dependency := range e.Metadata.DependsOn {
+			result[dependency] = append(result[dependency], e.Metadata.Name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package experiments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderExperiments(t *testing.T) {
+	tests := []struct {
+		name          string
+		dependencies  map[string][]string
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:         "No dependencies are sorted by name",
+			dependencies: map[string][]string{"c": nil, "a": nil, "b": nil},
+			expected:     []string{"a", "b", "c"},
+		},
+		{
+			name:         "Dependencies come first",
+			dependencies: map[string][]string{"a": {"c"}, "b": nil, "c": {"b"}},
+			expected:     []string{"b", "c", "a"},
+		},
+		{
+			name:          "Unknown dependency",
+			dependencies:  map[string][]string{"a": {"missing"}},
+			expectedError: "Experiment a depends on unknown experiment missing",
+		},
+		{
+			name:          "Self dependency",
+			dependencies:  map[string][]string{"a": {"a"}},
+			expectedError: "Experiment dependencies form a cycle: a -> a",
+		},
+		{
+			name:          "Cycle",
+			dependencies:  map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}},
+			expectedError: "Experiment dependencies form a cycle: b -> c -> b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configs := make(map[string]*ExperimentConfig)
+			for name, dependsOn := range test.dependencies {
+				configs[name] = &ExperimentConfig{Metadata: ExperimentMetadata{Name: name, DependsOn: dependsOn}}
+			}
+
+			order, err := orderExperiments(configs)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, e := range order {
+				names = append(names, e.Metadata.Name)
+			}
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"errors"
+)
+
+// Exit codes of the woodpecker CLI, by outcome of the experiments
+const (
+	// ExitSuccess is used when every check passed
+	ExitSuccess = 0
+	// ExitChecksFailed is used when the experiments ran but one or more checks failed
+	ExitChecksFailed = 1
+	// ExitConfigError is used when the experiments could not run because of their configuration
+	ExitConfigError = 2
+	// ExitInfrastructureError is used when the experiments could not run, be verified or be
+	// cleaned up, e.g. because the cluster or result store is unreachable
+	ExitInfrastructureError = 3
+	// ExitExperimentDenied is used when the cluster denied the requests of an experiment or
+	// verifier, e.g. because of RBAC or an admission policy
+	ExitExperimentDenied = 4
+)
+
+// ErrChecksFailed is returned when experiments were verified and one or more checks failed
+var ErrChecksFailed = errors.New("One or more checks failed")
+
+// ConfigError is returned when experiments cannot run because of invalid configuration
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ExperimentError is returned when an experiment fails to run or be verified
+type ExperimentError struct {
+	Experiment string
+	Err        error
+}
+
+func (e *ExperimentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExperimentError) Unwrap() error {
+	return e.Err
+}
+
+// Denied reports whether the experiment failed because the cluster denied its requests
+func (e *ExperimentError) Denied() bool {
+	return isAdmissionDenial(e.Err)
+}
+
+// ExitCode returns the exit code matching the error returned by the Runner. Configuration
+// errors take precedence over infrastructure errors, which take precedence over denied
+// experiments, which take precedence over failed checks.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return ExitConfigError
+	}
+	return exitCode(err)
+}
+
+// exitCode returns the exit code of the most severe error joined in err
+func exitCode(err error) int {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		code := ExitChecksFailed
+		for _, e := range joined.Unwrap() {
+			switch exitCode(e) {
+			case ExitInfrastructureError:
+				return ExitInfrastructureError
+			case ExitExperimentDenied:
+				code = ExitExperimentDenied
+			}
+		}
+		return code
+	}
+	var experimentErr *ExperimentError
+	if errors.As(err, &experimentErr) && experimentErr.Denied() {
+		return ExitExperimentDenied
+	}
+	if errors.Is(err, ErrChecksFailed) {
+		return ExitChecksFailed
+	}
+	return ExitInfrastructureError
+}
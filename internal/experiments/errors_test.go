@@ -0,0 +1,40 @@
+package experiments
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestExitCode(t *testing.T) {
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "privileged", errors.New("violates PodSecurity"))
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "No error", err: nil, expected: ExitSuccess},
+		{name: "Checks failed", err: ErrChecksFailed, expected: ExitChecksFailed},
+		{name: "Joined checks failed", err: errors.Join(ErrChecksFailed, ErrChecksFailed), expected: ExitChecksFailed},
+		{name: "Config error", err: &ConfigError{Err: errors.New("invalid")}, expected: ExitConfigError},
+		{name: "Wrapped config error", err: fmt.Errorf("parsing: %w", &ConfigError{Err: errors.New("invalid")}), expected: ExitConfigError},
+		{name: "Infrastructure error", err: errors.New("connection refused"), expected: ExitInfrastructureError},
+		{name: "Infrastructure error and checks failed", err: errors.Join(errors.New("connection refused"), ErrChecksFailed), expected: ExitInfrastructureError},
+		{name: "Experiment denied", err: &ExperimentError{Experiment: "privileged", Err: fmt.Errorf("Experiment privileged failed with error: %w", forbidden)}, expected: ExitExperimentDenied},
+		{name: "Experiment denied and checks failed", err: errors.Join(&ExperimentError{Experiment: "privileged", Err: forbidden}, ErrChecksFailed), expected: ExitExperimentDenied},
+		{name: "Experiment failed", err: &ExperimentError{Experiment: "privileged", Err: errors.New("connection refused")}, expected: ExitInfrastructureError},
+		{name: "Denied outside of an experiment", err: forbidden, expected: ExitInfrastructureError},
+		{name: "Infrastructure error takes precedence over denied experiment", err: errors.Join(&ExperimentError{Experiment: "privileged", Err: forbidden}, errors.New("connection refused")), expected: ExitInfrastructureError},
+		{name: "Config error takes precedence", err: errors.Join(errors.New("connection refused"), &ConfigError{Err: errors.New("invalid")}), expected: ExitConfigError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ExitCode(test.err))
+		})
+	}
+}
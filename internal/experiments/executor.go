@@ -0,0 +1,128 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/operantai/woodpecker/internal/executor"
+	"github.com/operantai/woodpecker/internal/k8s"
+)
+
+// Defaults of the executor server deployed by experiments
+const (
+	defaultExecutorImage = "ghcr.io/operantai/woodpecker-executor-server:latest"
+	defaultExecutorPort  = 4000
+)
+
+// errExecutorNotRunning is returned when the executor of an experiment did not run in time,
+// before any request was sent to it
+var errExecutorNotRunning = errors.New("Executor is not running")
+
+// newExecutor returns the executor of an experiment, with the default image and port of the
+// executor server unless they are set
+func newExecutor(metadata ExperimentMetadata, api executor.RemoteExecuteAPI) *executor.RemoteExecutorConfig {
+	if api.Image == "" {
+		api.Image = defaultExecutorImage
+	}
+	if api.Target.Port == 0 {
+		api.Target.Port = defaultExecutorPort
+	}
+	return executor.NewExecutorConfig(
+		metadata.Name,
+		metadata.Namespace,
+		api.Image,
+		api.ImageParameters,
+		api.ServiceAccountName,
+		api.Target.Port,
+	)
+}
+
+// queryExecutor waits up to the timeout for the executor of an experiment to run, then sends a GET
+// request for the path and query to it through a port-forward and decodes its JSON response
+func queryExecutor(ctx context.Context, client *k8s.Client, e *executor.RemoteExecutorConfig, path string, query url.Values, timeout time.Duration, out interface{}) error {
+	return callExecutor(ctx, client, e, http.MethodGet, path, query, nil, timeout, out)
+}
+
+// postExecutor is like queryExecutor, with a POST request whose body is the JSON of in
+func postExecutor(ctx context.Context, client *k8s.Client, e *executor.RemoteExecutorConfig, path string, in interface{}, timeout time.Duration, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal executor request: %w", err)
+	}
+	return callExecutor(ctx, client, e, http.MethodPost, path, nil, body, timeout, out)
+}
+
+// callExecutor sends a request to the executor of an experiment, as described by queryExecutor
+func callExecutor(ctx context.Context, client *k8s.Client, e *executor.RemoteExecutorConfig, method, path string, query url.Values, body []byte, timeout time.Duration, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	selector := "app=" + e.Name
+	if _, err := k8s.WaitForRunningPod(ctx, client.Clientset, e.Namespace, selector, 2*time.Second); err != nil {
+		return fmt.Errorf("%w: %s: %w", errExecutorNotRunning, e.Name, err)
+	}
+
+	pf := client.NewPortForwarder(ctx)
+	defer pf.Stop()
+	forwardedPort, err := pf.Forward(e.Namespace, selector, int(e.Parameters.TargetPort))
+	if err != nil {
+		return err
+	}
+	requestURL := url.URL{
+		Scheme:   "http",
+		Host:     fmt.Sprintf("%s:%d", pf.Addr(), forwardedPort.Local),
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	// The server may still be starting when its pod runs
+	var response *http.Response
+	err = wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		response, err = http.DefaultClient.Do(request)
+		return err == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to reach executor %s: %w", e.Name, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("Executor %s returned %s: %s", e.Name, response.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("Executor %s returned an invalid response: %w", e.Name, err)
+	}
+	return nil
+}
+
+// parseTimeout parses a timeout parameter, returning the default when it is not set
+func parseTimeout(timeout string, defaultTimeout time.Duration) (time.Duration, error) {
+	if timeout == "" {
+		return defaultTimeout, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid timeout %s: %w", timeout, err)
+	}
+	return d, nil
+}
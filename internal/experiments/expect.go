@@ -0,0 +1,45 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"fmt"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// Expectations of the attacks of an experiment. A check succeeds when the attack it attempts
+// ended as expected. Experiments with an expect parameter document their default, the others
+// expect their attacks to succeed.
+const (
+	// ExpectSucceeded expects the attacks to succeed, to show what an attacker can do
+	ExpectSucceeded = "succeeded"
+	// ExpectPrevented expects the attacks to be prevented, or detected, to prove that controls work
+	ExpectPrevented = "prevented"
+)
+
+// parseExpect parses an expect parameter, the default expectation when it is not set, returning
+// whether the attacks are expected to succeed
+func parseExpect(expect, defaultExpect string) (bool, error) {
+	if expect == "" {
+		expect = defaultExpect
+	}
+	switch expect {
+	case ExpectSucceeded:
+		return true, nil
+	case ExpectPrevented:
+		return false, nil
+	default:
+		return false, fmt.Errorf("Invalid expect %s, expected %s or %s", expect, ExpectSucceeded, ExpectPrevented)
+	}
+}
+
+// checkAttack adds the check, successful when whether its attack succeeded is what was expected
+func checkAttack(v *verifier.LegacyVerifier, check string, succeeded, expectSucceeded bool) {
+	if succeeded == expectSucceeded {
+		v.Success(check)
+	} else {
+		v.Fail(check)
+	}
+}
@@ -0,0 +1,46 @@
+package experiments
+
+import (
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpect(t *testing.T) {
+	tests := []struct {
+		name            string
+		expect          string
+		defaultExpect   string
+		expectSucceeded bool
+		wantErr         bool
+	}{
+		{name: "Default succeeded", defaultExpect: ExpectSucceeded, expectSucceeded: true},
+		{name: "Default prevented", defaultExpect: ExpectPrevented, expectSucceeded: false},
+		{name: "Succeeded", expect: ExpectSucceeded, defaultExpect: ExpectPrevented, expectSucceeded: true},
+		{name: "Prevented", expect: ExpectPrevented, defaultExpect: ExpectSucceeded, expectSucceeded: false},
+		{name: "Invalid", expect: "denied", defaultExpect: ExpectSucceeded, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectSucceeded, err := parseExpect(test.expect, test.defaultExpect)
+			if test.wantErr {
+				assert.EqualError(t, err, "Invalid expect denied, expected succeeded or prevented")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectSucceeded, expectSucceeded)
+
+			v := verifier.NewLegacy("expect", "", "", "", "")
+			checkAttack(v, "succeeded", true, expectSucceeded)
+			checkAttack(v, "prevented", false, expectSucceeded)
+			if expectSucceeded {
+				assert.Equal(t, map[string]string{"succeeded": verifier.Success, "prevented": verifier.Fail}, v.GetOutcome().Result)
+			} else {
+				assert.Equal(t, map[string]string{"succeeded": verifier.Fail, "prevented": verifier.Success}, v.GetOutcome().Result)
+			}
+		})
+	}
+}
@@ -5,11 +5,21 @@ package experiments
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/operantai/woodpecker/internal/k8s"
 	"github.com/operantai/woodpecker/internal/output"
+	"github.com/operantai/woodpecker/internal/report"
+	"github.com/operantai/woodpecker/internal/results"
 	"github.com/operantai/woodpecker/internal/verifier"
+	"golang.org/x/sync/errgroup"
 )
 
 // Experiment interface
@@ -26,7 +36,8 @@ type Experiment interface {
 	Technique() string
 	// Run runs the experiment, returning an error if it fails
 	Run(ctx context.Context, experimentConfig *ExperimentConfig) error
-	// Verify verifies the experiment, returning an error if it fails
+	// Verify verifies the experiment, returning an error if it fails. A check succeeds when the
+	// attack it attempts ended as the experiment expects, see ExpectSucceeded.
 	Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error)
 	// Cleanup cleans up the experiment, returning an error if it fails
 	Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error
@@ -37,172 +48,653 @@ type Runner struct {
 	ctx               context.Context
 	experiments       map[string]Experiment
 	experimentsConfig map[string]*ExperimentConfig
+	resultStore       results.ResultStore
+	runID             string
+	parallelism       int
+	failFast          bool
+	outputFile        string
+	metadata          report.Metadata
+	templating        Templating
+	selector          *Selector
+	dryRun            string
+	// order lists the experiments so that each comes after the experiments it depends on
+	order []*ExperimentConfig
 }
 
-// NewRunner returns a new Runner
-func NewRunner(ctx context.Context, experimentFiles []string) *Runner {
-	experimentMap := make(map[string]Experiment)
+// RunnerOption configures optional Runner settings
+type RunnerOption func(*Runner)
+
+// WithResultStore sets the store experiment results are written to and read from
+func WithResultStore(store results.ResultStore) RunnerOption {
+	return func(r *Runner) {
+		r.resultStore = store
+	}
+}
+
+// WithRunID selects the run experiment results are written to or read from. Without it Run
+// starts a new run, and verify and clean use the latest run of each experiment.
+func WithRunID(id string) RunnerOption {
+	return func(r *Runner) {
+		r.runID = id
+	}
+}
+
+// WithParallelism sets how many experiments are run, verified or cleaned up at the same time
+func WithParallelism(n int) RunnerOption {
+	return func(r *Runner) {
+		r.parallelism = n
+	}
+}
+
+// WithFailFast stops running or verifying experiments at the first failure
+func WithFailFast(failFast bool) RunnerOption {
+	return func(r *Runner) {
+		r.failFast = failFast
+	}
+}
+
+// WithOutputFile writes the verification outcomes to a file, in the output format or the format
+// matching the file extension, only printing a summary to the terminal
+func WithOutputFile(path string) RunnerOption {
+	return func(r *Runner) {
+		r.outputFile = path
+	}
+}
+
+// WithReportMetadata sets the metadata of the reports of verified experiments
+func WithReportMetadata(metadata report.Metadata) RunnerOption {
+	return func(r *Runner) {
+		r.metadata = metadata
+	}
+}
+
+// WithTemplating renders the experiment files with the values and environment overlay
+func WithTemplating(templating Templating) RunnerOption {
+	return func(r *Runner) {
+		r.templating = templating
+	}
+}
+
+// WithSelector only processes the experiments the selector selects, and the experiments they
+// depend on
+func WithSelector(selector *Selector) RunnerOption {
+	return func(r *Runner) {
+		r.selector = selector
+	}
+}
+
+// WithDryRun sets the dry-run mode, DryRunServer submits the objects of the experiments with
+// server-side dry-run instead of creating them
+func WithDryRun(mode string) RunnerOption {
+	return func(r *Runner) {
+		r.dryRun = mode
+	}
+}
+
+// NewRunner returns a new Runner for the experiments in the given files. Files can also be
+// directories, glob patterns, URLs, OCI artifacts or - for stdin, see loadSources.
+func NewRunner(ctx context.Context, experimentFiles []string, options ...RunnerOption) (*Runner, error) {
+	types := newExperimentTypes()
+	experimentMap := types.experiments
 	experimentConfigMap := make(map[string]*ExperimentConfig)
 
-	// Create a map of experiment types to experiments
-	for _, e := range ExperimentsRegistry {
-		experimentMap[e.Type()] = e
+	r := &Runner{
+		ctx:               ctx,
+		experiments:       experimentMap,
+		experimentsConfig: experimentConfigMap,
+		parallelism:       1,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	switch r.dryRun {
+	case "", DryRunNone, DryRunServer:
+	default:
+		return nil, &ConfigError{Err: fmt.Errorf("Invalid dry-run mode %s, expected %s or %s", r.dryRun, DryRunNone, DryRunServer)}
+	}
+
+	sources, err := loadSources(ctx, experimentFiles)
+	if err != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("Failed to load experiment files: %w", err)}
 	}
 
 	// Parse the experiment configs
-	for _, e := range experimentFiles {
-		experimentConfigs, err := parseExperimentConfigs(e)
+	for _, s := range sources {
+		experimentConfigs, err := parseSource(s, r.templating)
 		if err != nil {
-			output.WriteFatal("Failed to parse experiment configs: %s", err)
+			return nil, &ConfigError{Err: fmt.Errorf("Failed to parse experiment configs: %w", err)}
 		}
 
 		for i, eConf := range experimentConfigs {
-			if _, exists := experimentMap[eConf.Metadata.Type]; exists {
-				experimentConfigMap[eConf.Metadata.Name] = &experimentConfigs[i]
-			} else {
-				output.WriteError("Experiment %s does not exist", eConf.Metadata.Type)
+			if _, err := types.lookup(ctx, eConf.Metadata.Type); err != nil {
+				return nil, &ConfigError{Err: err}
+			}
+			if _, exists := experimentConfigMap[eConf.Metadata.Name]; exists {
+				return nil, &ConfigError{Err: fmt.Errorf("%s: Experiment %s is defined more than once", s.name, eConf.Metadata.Name)}
 			}
+			experimentConfigMap[eConf.Metadata.Name] = &experimentConfigs[i]
 		}
 	}
 
-	return &Runner{
-		ctx:               ctx,
-		experiments:       experimentMap,
-		experimentsConfig: experimentConfigMap,
+	order, err := orderExperiments(experimentConfigMap)
+	if err != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("Failed to parse experiment configs: %w", err)}
+	}
+	r.order, err = selectExperiments(order, experimentMap, r.selector)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	// Only the selected experiments are run, verified and cleaned up
+	for name, e := range experimentConfigMap {
+		if !slices.Contains(r.order, e) {
+			delete(experimentConfigMap, name)
+		}
+	}
+	if r.dryRun == DryRunServer {
+		var unsupported []string
+		for _, e := range r.order {
+			if !supportsDryRun(experimentMap[e.Metadata.Type]) {
+				unsupported = append(unsupported, fmt.Sprintf("%s (%s)", e.Metadata.Name, e.Metadata.Type))
+			}
+		}
+		if len(unsupported) > 0 {
+			return nil, &ConfigError{Err: fmt.Errorf("Experiments %s do not support --dry-run=%s", strings.Join(unsupported, ", "), DryRunServer)}
+		}
+	}
+	if r.resultStore == nil {
+		store, err := results.NewLocalStore(results.DefaultLocalDir)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open result store: %w", err)
+		}
+		r.resultStore = store
+	}
+	for _, e := range r.experimentsConfig {
+		e.resultStore = r.resultStore
+		e.dryRun = r.dryRun == DryRunServer
 	}
+	return r, nil
 }
 
-// Run runs all experiments in the Runner
-func (r *Runner) Run() {
+// Run runs all experiments in the Runner, returning the errors of the experiments that failed
+func (r *Runner) Run() error {
+	// Every invocation of Run writes its results under a new run ID, unless one was given
+	if r.runID == "" {
+		r.runID = uuid.NewString()
+	}
+	run, err := r.resultStore.GetRun(r.ctx, r.runID)
+	if err != nil {
+		run = &results.Run{ID: r.runID, StartedAt: time.Now()}
+	}
 	for _, e := range r.experimentsConfig {
+		e.runID = r.runID
+		if !run.HasExperiment(e.Metadata.Type, e.Metadata.Name) {
+			run.Experiments = append(run.Experiments, e.resultKey())
+		}
+	}
+	if err := r.putRun(run); err != nil {
+		return err
+	}
+	output.WriteInfo("Starting run %s", r.runID)
+
+	err = r.forEachExperiment(false, func(ctx context.Context, e *ExperimentConfig) error {
 		experiment := r.experiments[e.Metadata.Type]
-		output.WriteInfo("Running experiment %s", e.Metadata.Name)
-		if err := experiment.Run(r.ctx, e); err != nil {
-			output.WriteError("Experiment %s failed with error: %s", e.Metadata.Name, err)
+		prefix := r.logPrefix(e)
+		if e.dryRun {
+			output.WriteInfo("%sRunning experiment %s with server-side dry-run", prefix, e.Metadata.Name)
+		} else {
+			output.WriteInfo("%sRunning experiment %s", prefix, e.Metadata.Name)
+		}
+		if err := experiment.Run(ctx, e); err != nil {
+			return &ExperimentError{Experiment: e.Metadata.Name, Err: fmt.Errorf("Experiment %s failed with error: %w", e.Metadata.Name, err)}
+		}
+		output.WriteInfo("%sFinished running experiment %s. Check results using woodpecker experiment verify command. \n", prefix, e.Metadata.Name)
+		return nil
+	})
+
+	run.FinishedAt = time.Now()
+	return errors.Join(err, r.putRun(run))
+}
+
+// forEachExperiment calls fn for every experiment in dependency order, running up to the Runner
+// parallelism at the same time. An experiment starts once the experiments it depends on are done
+// and is skipped if one of them failed. With reverse set, an experiment starts once the experiments
+// depending on it are done and is never skipped, so that they can be torn down in order.
+// With fail fast set, the first error cancels the context shared by the other experiments and
+// experiments that have not started yet are skipped, unless reverse is set.
+// It returns the errors returned by fn joined together.
+func (r *Runner) forEachExperiment(reverse bool, fn func(ctx context.Context, e *ExperimentConfig) error) error {
+	limit := r.parallelism
+	if limit < 1 {
+		limit = 1
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+
+	order := r.order
+	prerequisites := func(e *ExperimentConfig) []string {
+		return e.Metadata.DependsOn
+	}
+	if reverse {
+		order = make([]*ExperimentConfig, len(r.order))
+		for i, e := range r.order {
+			order[len(r.order)-1-i] = e
+		}
+		dependentsByName := dependents(r.order)
+		prerequisites = func(e *ExperimentConfig) []string {
+			return dependentsByName[e.Metadata.Name]
+		}
+	}
+
+	done := make(map[string]chan struct{}, len(order))
+	for _, e := range order {
+		done[e.Metadata.Name] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	failed := make(map[string]bool)
+	fail := func(e *ExperimentConfig, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed[e.Metadata.Name] = true
+		if err != nil {
+			errs = append(errs, err)
+			if r.failFast && !reverse {
+				cancel()
+			}
 		}
-		output.WriteInfo("Finished running experiment %s. Check results using woodpecker experiment verify command. \n", e.Metadata.Name)
 	}
+
+	// Experiments are started in order, so the experiments they wait for already hold a slot
+	var eg errgroup.Group
+	eg.SetLimit(limit)
+	for _, e := range order {
+		eg.Go(func() error {
+			defer close(done[e.Metadata.Name])
+			for _, name := range prerequisites(e) {
+				select {
+				case <-done[name]:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				fail(e, nil)
+				return nil
+			}
+
+			if !reverse {
+				mu.Lock()
+				var failedDependency string
+				for _, name := range prerequisites(e) {
+					if failed[name] {
+						failedDependency = name
+						break
+					}
+				}
+				mu.Unlock()
+				if failedDependency != "" {
+					output.WriteWarning("%sSkipping experiment %s, its dependency %s did not succeed", r.logPrefix(e), e.Metadata.Name, failedDependency)
+					fail(e, nil)
+					return nil
+				}
+			}
+
+			if err := fn(ctx, e); err != nil {
+				fail(e, err)
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	if err := r.ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
-// RunVerifiers runs all verifiers in the Runner for the provided experiments
-func (r *Runner) RunVerifiers(outputFormat string) {
-	if outputFormat != "" {
-		// Handle JSON/YAML output
-		outcomes := []*verifier.LegacyOutcome{}
+// logPrefix returns the prefix of log lines about an experiment, so that interleaved output of
+// experiments running in parallel stays readable
+func (r *Runner) logPrefix(e *ExperimentConfig) string {
+	if r.parallelism <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("[%s] ", e.Metadata.Name)
+}
+
+// verifyAll verifies every experiment, returning the outcomes by experiment along with the
+// errors of the verifiers that failed. Failed checks are not errors, but with fail fast set
+// they stop the verification of the remaining experiments.
+func (r *Runner) verifyAll() (map[*ExperimentConfig]*verifier.LegacyOutcome, error) {
+	var mu sync.Mutex
+	var errs []error
+	outcomes := make(map[*ExperimentConfig]*verifier.LegacyOutcome)
+	_ = r.forEachExperiment(false, func(ctx context.Context, e *ExperimentConfig) error {
+		experiment := r.experiments[e.Metadata.Type]
+		outcome, err := experiment.Verify(ctx, e)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			err = &ExperimentError{Experiment: e.Metadata.Name, Err: fmt.Errorf("Verifier %s failed: %w", e.Metadata.Name, err)}
+			errs = append(errs, err)
+			return err
+		}
+		outcomes[e] = outcome
+		if r.failFast && checksFailed(map[*ExperimentConfig]*verifier.LegacyOutcome{e: outcome}) {
+			return ErrChecksFailed
+		}
+		return nil
+	})
+	errs = append(errs, r.ctx.Err())
+	return outcomes, errors.Join(errs...)
+}
+
+// putRun records the run in the result store
+func (r *Runner) putRun(run *results.Run) error {
+	if err := r.resultStore.PutRun(r.ctx, run); err != nil {
+		return fmt.Errorf("Failed to record run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// resolveRuns points every experiment at the run its results are read from: the run given
+// to the Runner, otherwise the latest run the experiment was part of
+func (r *Runner) resolveRuns() error {
+	if r.runID != "" {
+		if _, err := r.resultStore.GetRun(r.ctx, r.runID); err != nil {
+			if errors.Is(err, results.ErrRunNotFound) {
+				return &ConfigError{Err: fmt.Errorf("Run %s not found", r.runID)}
+			}
+			return fmt.Errorf("Failed to find run %s: %w", r.runID, err)
+		}
 		for _, e := range r.experimentsConfig {
-			experiment := r.experiments[e.Metadata.Type]
-			outcome, err := experiment.Verify(r.ctx, e)
+			e.runID = r.runID
+		}
+		return nil
+	}
+
+	runs, err := r.resultStore.ListRuns(r.ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to list runs: %w", err)
+	}
+	for _, e := range r.experimentsConfig {
+		// Results written without a run record are matched across every run
+		e.runID = ""
+		for i := len(runs) - 1; i >= 0; i-- {
+			if runs[i].HasExperiment(e.Metadata.Type, e.Metadata.Name) {
+				e.runID = runs[i].ID
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// recordVerification stores the pass/fail counts of the outcomes on the runs they belong to,
+// keeping the counts of the experiments of those runs that were not verified
+func (r *Runner) recordVerification(outcomes map[*ExperimentConfig]*verifier.LegacyOutcome) error {
+	runs := make(map[string]*results.Run)
+	for e, outcome := range outcomes {
+		if e.runID == "" {
+			continue
+		}
+		run, ok := runs[e.runID]
+		if !ok {
+			var err error
+			run, err = r.resultStore.GetRun(r.ctx, e.runID)
 			if err != nil {
-				output.WriteFatal("Verifier %s failed: %s", e.Metadata.Name, err)
+				continue
 			}
-			outcomes = append(outcomes, outcome)
+			runs[e.runID] = run
 		}
+		passed, failed := countResults(map[*ExperimentConfig]*verifier.LegacyOutcome{e: outcome})
+		run.RecordVerification(results.Verification{
+			ExperimentType: e.Metadata.Type,
+			Experiment:     e.Metadata.Name,
+			Passed:         passed,
+			Failed:         failed,
+		})
+	}
+
+	var errs []error
+	for _, run := range runs {
+		run.VerifiedAt = time.Now()
+		errs = append(errs, r.putRun(run))
+	}
+	return errors.Join(errs...)
+}
+
+// RunVerifiers runs all verifiers in the Runner for the provided experiments. It returns
+// ErrChecksFailed if any check failed.
+func (r *Runner) RunVerifiers(outputFormat string) error {
+	if err := validateFormat(outputFormat); err != nil {
+		return err
+	}
+	if err := r.resolveRuns(); err != nil {
+		return err
+	}
+	return r.verify(outputFormat)
+}
 
-		structuredOutput := verifier.LegacyStructuredOutput{
-			Results: outcomes,
+// verify verifies the experiments once, records the outcome on their runs and writes it
+func (r *Runner) verify(outputFormat string) error {
+	// The report is written even when verifiers failed, with their experiments without results
+	rep, verifyErr := r.verifyReport()
+	if err := r.writeReport(rep, outputFormat); err != nil {
+		return errors.Join(verifyErr, err)
+	}
+	if verifyErr != nil {
+		return verifyErr
+	}
+	if rep.Summary().ChecksFailed() {
+		return ErrChecksFailed
+	}
+	return nil
+}
+
+// verifyReport verifies every experiment and records the outcome on their runs, returning the
+// outcomes as a report in the order the experiments run along with the errors of the verifiers
+// that failed. Experiments whose verifier failed, or that were skipped, are reported without
+// results.
+func (r *Runner) verifyReport() (*report.Report, error) {
+	verified, err := r.verifyAll()
+	err = errors.Join(err, r.recordVerification(verified))
+
+	rep := &report.Report{Metadata: r.metadata, Outcomes: []*verifier.LegacyOutcome{}}
+	if rep.Metadata.GeneratedAt.IsZero() {
+		rep.Metadata.GeneratedAt = time.Now()
+	}
+	runIDs := make(map[string]bool)
+	for _, e := range r.order {
+		// Experiments skipped because of a failed dependency have no outcome
+		outcome, ok := verified[e]
+		if !ok {
+			experiment := r.experiments[e.Metadata.Type]
+			outcome = verifier.NewLegacy(
+				e.Metadata.Name,
+				experiment.Description(),
+				experiment.Framework(),
+				experiment.Tactic(),
+				experiment.Technique(),
+			).GetOutcome()
 		}
-		switch strings.ToLower(outputFormat) {
-		case "json":
-			output.WriteJSON(structuredOutput)
-		case "yaml":
-			output.WriteYAML(structuredOutput)
-		default:
-			output.WriteError("Unknown output format: %s", outputFormat)
+		rep.Outcomes = append(rep.Outcomes, outcome)
+		if e.runID != "" && !runIDs[e.runID] {
+			runIDs[e.runID] = true
+			rep.Metadata.RunIDs = append(rep.Metadata.RunIDs, e.runID)
 		}
-		return
 	}
+	return rep, err
+}
 
-	// Handle table output - show each test result as a separate row
-	table := output.NewTable([]string{"Experiment", "Description", "Framework", "Tactic", "Technique", "Test", "Result"})
+// Test runs the experiments, waits up to the timeout for the resources they deploy to be ready,
+// verifies them and finally cleans them up, even when the Runner context is cancelled.
+// It returns ErrChecksFailed if any check failed.
+func (r *Runner) Test(outputFormat string, timeout time.Duration) (err error) {
+	if err := validateFormat(outputFormat); err != nil {
+		return err
+	}
+	defer func() {
+		// The Runner context may be cancelled, clean up with a fresh deadline instead
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.ctx), timeout)
+		defer cancel()
+		r.ctx = ctx
+		err = errors.Join(err, r.Cleanup())
+	}()
 
-	for _, e := range r.experimentsConfig {
-		experiment := r.experiments[e.Metadata.Type]
-		outcome, err := experiment.Verify(r.ctx, e)
-		if err != nil {
-			output.WriteFatal("Verifier %s failed: %s", e.Metadata.Name, err)
+	runErr := r.Run()
+	if r.ctx.Err() != nil {
+		return fmt.Errorf("Run %s was interrupted: %w", r.runID, r.ctx.Err())
+	}
+	if runErr != nil && r.failFast {
+		return runErr
+	}
+	// Nothing is deployed in dry-run mode
+	if r.dryRun != DryRunServer {
+		r.WaitForReadiness(timeout)
+	}
+	return errors.Join(runErr, r.verify(outputFormat))
+}
+
+// WaitForReadiness waits up to the timeout for the Kubernetes resources deployed by the experiments
+// to be rolled out, experiments that are not ready in time are verified anyway
+func (r *Runner) WaitForReadiness(timeout time.Duration) {
+	// Experiments in the local namespace run against Docker rather than Kubernetes
+	var clusterExperiments int
+	for _, e := range r.order {
+		if e.Metadata.Namespace != "local" {
+			clusterExperiments++
 		}
+	}
+	if clusterExperiments == 0 {
+		return
+	}
+	client, err := k8s.NewClient()
+	if err != nil {
+		output.WriteWarning("Not waiting for experiments to be ready: %s", err)
+		return
+	}
 
-		// If there are no specific test results, show overall experiment result
-		if len(outcome.Result) == 0 {
-			table.AddRow([]string{
-				outcome.Experiment,
-				outcome.Description,
-				outcome.Framework,
-				outcome.Tactic,
-				outcome.Technique,
-				"Overall",
-				"No results",
-			})
-		} else {
-			// Show each individual test result as a separate row
-			for testName, result := range outcome.Result {
-				// Add status emoji for better visual feedback
-				status := result
-				if result == verifier.Success {
-					status = "✓ " + result
-				} else if result == verifier.Fail {
-					status = "✗ " + result
-				}
+	_ = r.forEachExperiment(false, func(ctx context.Context, e *ExperimentConfig) error {
+		if e.Metadata.Namespace == "local" {
+			return nil
+		}
+		prefix := r.logPrefix(e)
+		output.WriteInfo("%sWaiting for experiment %s to be ready", prefix, e.Metadata.Name)
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := k8s.WaitForExperiment(waitCtx, client.Clientset, e.Metadata.Namespace, e.Metadata.Name, 2*time.Second); err != nil {
+			output.WriteWarning("%sExperiment %s is not ready, verifying anyway: %s", prefix, e.Metadata.Name, err)
+		}
+		return nil
+	})
+}
 
-				table.AddRow([]string{
-					outcome.Experiment,
-					outcome.Description,
-					outcome.Framework,
-					outcome.Tactic,
-					outcome.Technique,
-					testName,
-					status,
-				})
-			}
+// validateFormat returns a ConfigError if outcomes cannot be written in the output format
+func validateFormat(outputFormat string) error {
+	if outputFormat != "" && !slices.Contains(report.Formats(), strings.ToLower(outputFormat)) {
+		return &ConfigError{Err: fmt.Errorf("%w: %s", report.ErrUnknownFormat, outputFormat)}
+	}
+	return nil
+}
+
+// writeReport writes the report to the output file with a summary on the terminal when the
+// Runner has one, otherwise it prints the report in the given format, a table by default
+func (r *Runner) writeReport(rep *report.Report, outputFormat string) error {
+	summary := rep.Summary()
+	if r.outputFile != "" {
+		format := outputFormat
+		if format == "" {
+			format = report.FormatFromPath(r.outputFile)
+		}
+		if err := writeReportFile(rep, r.outputFile, format); err != nil {
+			return err
 		}
+		output.WriteInfo("Results written to %s", r.outputFile)
+		printSummary(summary)
+		return nil
 	}
 
-	table.Render()
+	if err := rep.Render(outputFormat); err != nil {
+		return err
+	}
+	// Structured formats are meant for other programs, only tables are followed by a summary
+	if outputFormat == "" || strings.ToLower(outputFormat) == report.Table {
+		printSummary(summary)
+	}
+	return nil
+}
 
-	// Show summary
-	r.printSummary()
+// writeReportFile writes the report to a file in the given format
+func writeReportFile(rep *report.Report, path, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to create output file: %w", err)
+	}
+	if err := rep.Write(f, format); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to write output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed to write output file: %w", err)
+	}
+	return nil
 }
 
 // printSummary prints a summary of all experiment results
-func (r *Runner) printSummary() {
-	totalTests := 0
-	passedTests := 0
-	failedTests := 0
+func printSummary(summary report.Summary) {
+	fmt.Printf("\nSummary: %d total tests, %d passed, %d failed\n", summary.Checks, summary.Passed, summary.Failed)
 
-	for _, e := range r.experimentsConfig {
-		experiment := r.experiments[e.Metadata.Type]
-		outcome, err := experiment.Verify(r.ctx, e)
-		if err != nil {
-			continue
-		}
+	if !summary.ChecksFailed() {
+		output.WriteSuccess("All tests passed!")
+	}
+	if summary.Failed > 0 {
+		output.WriteWarning("%d test(s) failed", summary.Failed)
+	}
+	if summary.WithoutResults > 0 {
+		output.WriteWarning("%d experiment(s) without results", summary.WithoutResults)
+	}
+}
 
+// countResults returns the number of passed and failed checks in the outcomes
+func countResults(outcomes map[*ExperimentConfig]*verifier.LegacyOutcome) (passed, failed int) {
+	for _, outcome := range outcomes {
 		for _, result := range outcome.Result {
-			totalTests++
 			if result == verifier.Success {
-				passedTests++
+				passed++
 			} else {
-				failedTests++
+				failed++
 			}
 		}
 	}
+	return passed, failed
+}
 
-	fmt.Printf("\nSummary: %d total tests, %d passed, %d failed\n", totalTests, passedTests, failedTests)
-
-	if failedTests == 0 {
-		output.WriteSuccess("All tests passed!")
-	} else {
-		output.WriteWarning("%d test(s) failed", failedTests)
+// checksFailed reports whether any check failed, or any experiment produced no results to check
+func checksFailed(outcomes map[*ExperimentConfig]*verifier.LegacyOutcome) bool {
+	for _, outcome := range outcomes {
+		if len(outcome.Result) == 0 {
+			return true
+		}
 	}
+	_, failed := countResults(outcomes)
+	return failed > 0
 }
 
-// Cleanup cleans up all experiments in the Runner
-func (r *Runner) Cleanup() {
-	for _, e := range r.experimentsConfig {
-		output.WriteInfo("Cleaning up experiment %s", e.Metadata.Name)
+// Cleanup cleans up all experiments in the Runner, returning the errors of the experiments that
+// could not be cleaned up
+func (r *Runner) Cleanup() error {
+	if err := r.resolveRuns(); err != nil {
+		return err
+	}
+	// Experiments are cleaned up before the experiments they depend on
+	return r.forEachExperiment(true, func(ctx context.Context, e *ExperimentConfig) error {
+		prefix := r.logPrefix(e)
+		output.WriteInfo("%sCleaning up experiment %s", prefix, e.Metadata.Name)
 		experiment := r.experiments[e.Metadata.Type]
-		if err := experiment.Cleanup(r.ctx, e); err != nil {
-			output.WriteError("Experiment %s cleanup failed: %s", e.Metadata.Name, err)
+		if err := experiment.Cleanup(ctx, e); err != nil {
+			return fmt.Errorf("Experiment %s cleanup failed: %w", e.Metadata.Name, err)
 		}
-
-	}
+		return nil
+	})
 }
@@ -149,13 +149,7 @@ func (p *LLMDataLeakageExperiment) Run(ctx context.Context, experimentConfig *Ex
 		return fmt.Errorf("Failed to marshal experiment results: %w", err)
 	}
 
-	file, err := createTempFile(p.Type(), config.Metadata.Name)
-	if err != nil {
-		return fmt.Errorf("Unable to create file cache for experiment results %w", err)
-	}
-
-	_, err = file.Write(resultJSON)
-	if err != nil {
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
 		return fmt.Errorf("Failed to write experiment results: %w", err)
 	}
 	return nil
@@ -179,7 +173,7 @@ func (p *LLMDataLeakageExperiment) Verify(ctx context.Context, experimentConfig
 		config.Technique(),
 	)
 
-	rawResults, err := getTempFileContentsForExperiment(p.Type(), config.Metadata.Name)
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
 	if err != nil {
 		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
 	}
@@ -281,7 +275,7 @@ func (p *LLMDataLeakageExperiment) Cleanup(ctx context.Context, experimentConfig
 		return err
 	}
 
-	if err := removeTempFilesForExperiment(p.Type(), config.Metadata.Name); err != nil {
+	if err := removeResultsForExperiment(ctx, experimentConfig); err != nil {
 		return err
 	}
 
@@ -0,0 +1,403 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// BackdoorCronJobExperimentConfig attempts to persist in the cluster with a CronJob, checking
+// whether it was admitted and whether its first Job ran
+type BackdoorCronJobExperimentConfig struct {
+	Metadata   ExperimentMetadata `yaml:"metadata"`
+	Parameters BackdoorCronJob    `yaml:"parameters"`
+}
+
+type BackdoorCronJob struct {
+	// Namespace of the CronJob, e.g. kube-system, the namespace of the experiment by default
+	Namespace string `yaml:"namespace"`
+	// Name of the CronJob, e.g. one looking like a system component, the name of the experiment by
+	// default
+	Name string `yaml:"name"`
+	// Schedule defaults to every minute
+	Schedule string   `yaml:"schedule"`
+	Image    string   `yaml:"image"`
+	Command  []string `yaml:"command"`
+	// HostPath is a path of the node mounted at /host in the Job pods
+	HostPath   string `yaml:"hostPath"`
+	Privileged bool   `yaml:"privileged"`
+	// ServiceAccountName is the identity the Job pods run as
+	ServiceAccountName string `yaml:"serviceAccountName"`
+	// Impersonate is the user creating the CronJob, e.g. system:serviceaccount:<namespace>:<name>,
+	// the user of the kubeconfig by default
+	Impersonate string `yaml:"impersonate"`
+	// Timeout bounds how long to wait for the first Job to finish, 2m by default
+	Timeout string `yaml:"timeout"`
+	// Expect is what is expected of the backdoor, succeeded by default or prevented to prove it is
+	// denied or cannot run
+	Expect string `yaml:"expect"`
+}
+
+// BackdoorCronJobResult is the outcome of creating the CronJob
+type BackdoorCronJobResult struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Admitted  bool   `json:"admitted"`
+	Message   string `json:"message,omitempty"`
+}
+
+// BackdoorJobResult is the outcome of the first Job of the CronJob
+type BackdoorJobResult struct {
+	Job       string `json:"job,omitempty"`
+	Succeeded bool   `json:"succeeded"`
+	Message   string `json:"message,omitempty"`
+}
+
+func (p *BackdoorCronJobExperimentConfig) Type() string {
+	return "backdoor-cronjob"
+}
+
+func (p *BackdoorCronJobExperimentConfig) Description() string {
+	return "Persist in the cluster with a CronJob, optionally hidden in kube-system with a privileged or hostPath template"
+}
+
+func (p *BackdoorCronJobExperimentConfig) Technique() string {
+	return categories.MITRE.Persistence.KubernetesCronJob.Technique
+}
+
+func (p *BackdoorCronJobExperimentConfig) Tactic() string {
+	return categories.MITRE.Persistence.KubernetesCronJob.Tactic
+}
+
+func (p *BackdoorCronJobExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+func (p *BackdoorCronJobExperimentConfig) SupportsDryRun() bool {
+	return true
+}
+
+func (p *BackdoorCronJobExperimentConfig) namespace() string {
+	if p.Parameters.Namespace != "" {
+		return p.Parameters.Namespace
+	}
+	return p.Metadata.Namespace
+}
+
+func (p *BackdoorCronJobExperimentConfig) name() string {
+	if p.Parameters.Name != "" {
+		return p.Parameters.Name
+	}
+	return p.Metadata.Name
+}
+
+// selector selects the CronJob, and the Jobs and Pods it spawned
+func (p *BackdoorCronJobExperimentConfig) selector() string {
+	return "experiment=" + p.Metadata.Name
+}
+
+// cronJob returns the CronJob, whose Jobs run once without retries
+func (p *BackdoorCronJobExperimentConfig) cronJob() *batchv1.CronJob {
+	params := p.Parameters
+	labels := map[string]string{"experiment": p.Metadata.Name}
+	schedule := params.Schedule
+	if schedule == "" {
+		schedule = "* * * * *"
+	}
+	image := params.Image
+	if image == "" {
+		image = "alpine:latest"
+	}
+	command := params.Command
+	if len(command) == 0 {
+		command = []string{"sh", "-c", "id && hostname"}
+	}
+
+	container := corev1.Container{
+		Name:    "job",
+		Image:   image,
+		Command: command,
+	}
+	podSpec := corev1.PodSpec{
+		ServiceAccountName: params.ServiceAccountName,
+		RestartPolicy:      corev1.RestartPolicyNever,
+	}
+	if params.Privileged {
+		container.SecurityContext = &corev1.SecurityContext{Privileged: pointer.Bool(true)}
+	}
+	if params.HostPath != "" {
+		container.VolumeMounts = []corev1.VolumeMount{{Name: "host", MountPath: "/host"}}
+		podSpec.Volumes = []corev1.Volume{{
+			Name:         "host",
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: params.HostPath}},
+		}}
+	}
+	podSpec.Containers = []corev1.Container{container}
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p.name(),
+			Namespace: p.namespace(),
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   schedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: pointer.Int32(1),
+			FailedJobsHistoryLimit:     pointer.Int32(1),
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: pointer.Int32(0),
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec:       podSpec,
+					},
+				},
+			},
+		},
+	}
+}
+
+// create creates the CronJob, recording whether admission allowed it. In dry-run mode it is only
+// submitted.
+func (p *BackdoorCronJobExperimentConfig) create(ctx context.Context, clientset kubernetes.Interface, admission *admission) (*BackdoorCronJobResult, error) {
+	cronJob := p.cronJob()
+	_, err := clientset.BatchV1().CronJobs(cronJob.Namespace).Create(ctx, cronJob, admission.options())
+	if admission.dryRun {
+		return nil, admission.check("CronJob", cronJob.Namespace, cronJob.Name, err)
+	}
+	result := &BackdoorCronJobResult{Namespace: cronJob.Namespace, Name: cronJob.Name, Admitted: err == nil}
+	if err != nil {
+		if !isAdmissionDenial(err) {
+			return nil, fmt.Errorf("Failed to create CronJob %s: %w", cronJob.Name, err)
+		}
+		result.Message = err.Error()
+	}
+	return result, nil
+}
+
+// firstJob waits for the first Job of the CronJob to finish
+func (p *BackdoorCronJobExperimentConfig) firstJob(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration) (*BackdoorJobResult, error) {
+	result := &BackdoorJobResult{}
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		jobs, err := clientset.BatchV1().Jobs(p.namespace()).List(ctx, metav1.ListOptions{LabelSelector: p.selector()})
+		if err != nil {
+			return false, err
+		}
+		for _, job := range jobs.Items {
+			result.Job = job.Name
+			switch {
+			case job.Status.Succeeded > 0:
+				result.Succeeded = true
+				return true, nil
+			case job.Status.Failed > 0:
+				result.Message = fmt.Sprintf("Job %s failed", job.Name)
+				for _, condition := range job.Status.Conditions {
+					if condition.Type == batchv1.JobFailed {
+						result.Message = fmt.Sprintf("Job %s failed: %s", job.Name, condition.Message)
+					}
+				}
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		result.Message = fmt.Sprintf("No Job finished within %s", timeout)
+		if result.Job != "" {
+			result.Message = fmt.Sprintf("Job %s did not finish within %s", result.Job, timeout)
+		}
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (p *BackdoorCronJobExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config BackdoorCronJobExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	if _, err := parseExpect(config.Parameters.Expect, ExpectSucceeded); err != nil {
+		return err
+	}
+	clientset, err := impersonate(client, config.Parameters.Impersonate)
+	if err != nil {
+		return err
+	}
+
+	admission := newAdmission(experimentConfig)
+	result, err := config.create(ctx, clientset, admission)
+	if err != nil {
+		return err
+	}
+	if admission.dryRun {
+		return admission.store(ctx, experimentConfig)
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *BackdoorCronJobExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	var config BackdoorCronJobExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseTimeout(config.Parameters.Timeout, 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return nil, err
+	}
+	if admission != nil {
+		admission.verify(v, expectSucceeded)
+		return v.GetOutcome(), nil
+	}
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var result BackdoorCronJobResult
+		if err := json.Unmarshal(rawResult, &result); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		jobResult := &BackdoorJobResult{Message: "The CronJob was not admitted"}
+		if result.Admitted {
+			if jobResult, err = config.firstJob(ctx, client.Clientset, timeout); err != nil {
+				return nil, fmt.Errorf("Failed to list the Jobs of CronJob %s: %w", result.Name, err)
+			}
+		}
+		verifyBackdoorCronJob(v, &result, jobResult, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verifyBackdoorCronJob adds two checks: admitted, whose attack succeeded when the CronJob was
+// created, and first-job-ran, whose attack succeeded when its first Job succeeded. A check is
+// successful when that was expected.
+func verifyBackdoorCronJob(v *verifier.LegacyVerifier, result *BackdoorCronJobResult, jobResult *BackdoorJobResult, expectSucceeded bool) {
+	checkAttack(v, "admitted", result.Admitted, expectSucceeded)
+	v.StoreResultOutputs("admitted", *result)
+	checkAttack(v, "first-job-ran", jobResult.Succeeded, expectSucceeded)
+	v.StoreResultOutputs("first-job-ran", *jobResult)
+}
+
+// cleanup deletes the CronJob, then the Jobs and Pods it spawned. A CronJob of the same name not
+// created by the experiment is left alone.
+func (p *BackdoorCronJobExperimentConfig) cleanup(ctx context.Context, clientset kubernetes.Interface) error {
+	namespace := p.namespace()
+	listOptions := metav1.ListOptions{LabelSelector: p.selector()}
+	cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	for _, cronJob := range cronJobs.Items {
+		if cronJob.Name != p.name() {
+			continue
+		}
+		err := clientset.BatchV1().CronJobs(namespace).Delete(ctx, cronJob.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	background := metav1.DeletePropagationBackground
+	for _, job := range jobs.Items {
+		err := clientset.BatchV1().Jobs(namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &background})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	// Pods of deleted Jobs may outlive them until garbage collected
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		err := clientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *BackdoorCronJobExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config BackdoorCronJobExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return err
+	}
+	if admission == nil {
+		if err := config.cleanup(ctx, client.Clientset); err != nil {
+			return err
+		}
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
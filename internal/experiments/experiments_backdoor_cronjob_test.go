@@ -0,0 +1,193 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestBackdoorCronJob(t *testing.T) {
+	p := &BackdoorCronJobExperimentConfig{
+		Metadata: ExperimentMetadata{Name: "backdoor", Namespace: "default"},
+		Parameters: BackdoorCronJob{
+			Namespace:          "kube-system",
+			Name:               "kube-node-gc",
+			HostPath:           "/",
+			Privileged:         true,
+			ServiceAccountName: "node-gc",
+		},
+	}
+	cronJob := p.cronJob()
+	assert.Equal(t, "kube-system", cronJob.Namespace)
+	assert.Equal(t, "kube-node-gc", cronJob.Name)
+	assert.Equal(t, "* * * * *", cronJob.Spec.Schedule)
+	pod := cronJob.Spec.JobTemplate.Spec.Template
+	assert.Equal(t, map[string]string{"experiment": "backdoor"}, pod.Labels)
+	assert.Equal(t, "node-gc", pod.Spec.ServiceAccountName)
+	assert.True(t, *pod.Spec.Containers[0].SecurityContext.Privileged)
+	assert.Equal(t, "/", pod.Spec.Volumes[0].HostPath.Path)
+	assert.Equal(t, "/host", pod.Spec.Containers[0].VolumeMounts[0].MountPath)
+
+	p.Parameters = BackdoorCronJob{}
+	cronJob = p.cronJob()
+	assert.Equal(t, "default", cronJob.Namespace)
+	assert.Equal(t, "backdoor", cronJob.Name)
+	assert.Nil(t, cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].SecurityContext)
+	assert.Empty(t, cronJob.Spec.JobTemplate.Spec.Template.Spec.Volumes)
+}
+
+func TestBackdoorCronJobCreate(t *testing.T) {
+	p := &BackdoorCronJobExperimentConfig{
+		Metadata:   ExperimentMetadata{Name: "backdoor", Namespace: "default"},
+		Parameters: BackdoorCronJob{Namespace: "kube-system", Name: "kube-node-gc"},
+	}
+	experimentConfig := &ExperimentConfig{Metadata: p.Metadata}
+	tests := []struct {
+		name     string
+		err      error
+		expected *BackdoorCronJobResult
+		fails    bool
+	}{
+		{
+			name:     "Admitted",
+			expected: &BackdoorCronJobResult{Namespace: "kube-system", Name: "kube-node-gc", Admitted: true},
+		},
+		{
+			name: "Denied",
+			err:  apierrors.NewForbidden(batchv1.Resource("cronjobs"), "kube-node-gc", errors.New("denied by policy")),
+			expected: &BackdoorCronJobResult{
+				Namespace: "kube-system",
+				Name:      "kube-node-gc",
+				Message:   `cronjobs.batch "kube-node-gc" is forbidden: denied by policy`,
+			},
+		},
+		{
+			name:  "Failure other than a denial",
+			err:   apierrors.NewInternalError(assert.AnError),
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			if test.err != nil {
+				clientset.PrependReactor("create", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, test.err
+				})
+			}
+			result, err := p.create(context.Background(), clientset, newAdmission(experimentConfig))
+			if test.fails {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestBackdoorCronJobFirstJobAndCleanup(t *testing.T) {
+	p := &BackdoorCronJobExperimentConfig{
+		Metadata:   ExperimentMetadata{Name: "backdoor", Namespace: "default"},
+		Parameters: BackdoorCronJob{Namespace: "kube-system", Name: "kube-node-gc"},
+	}
+	labels := map[string]string{"experiment": "backdoor"}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-node-gc-28000000", Namespace: "kube-system", Labels: labels},
+		Status: batchv1.JobStatus{
+			Failed:     1,
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Message: "Job has reached the specified backoff limit"}},
+		},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kube-node-gc-28000000-x2", Namespace: "kube-system", Labels: labels}}
+	// A CronJob of the same name the experiment did not create
+	existing := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "kube-node-gc", Namespace: "kube-system"}}
+	ctx := context.Background()
+
+	clientset := fake.NewSimpleClientset(job, pod)
+	result, err := p.firstJob(ctx, clientset, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, &BackdoorJobResult{Job: "kube-node-gc-28000000", Message: "Job kube-node-gc-28000000 failed: Job has reached the specified backoff limit"}, result)
+
+	result, err = p.firstJob(ctx, fake.NewSimpleClientset(), 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, result.Succeeded)
+	assert.Equal(t, "No Job finished within 10ms", result.Message)
+
+	_, err = clientset.BatchV1().CronJobs("kube-system").Create(ctx, p.cronJob(), metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, p.cleanup(ctx, clientset))
+	cronJobs, err := clientset.BatchV1().CronJobs("kube-system").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, cronJobs.Items)
+	jobs, err := clientset.BatchV1().Jobs("kube-system").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, jobs.Items)
+	pods, err := clientset.CoreV1().Pods("kube-system").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, pods.Items)
+
+	clientset = fake.NewSimpleClientset(existing)
+	require.NoError(t, p.cleanup(ctx, clientset))
+	_, err = clientset.BatchV1().CronJobs("kube-system").Get(ctx, "kube-node-gc", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestVerifyBackdoorCronJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    BackdoorCronJobResult
+		jobResult BackdoorJobResult
+		expect    string
+		expected  map[string]string
+	}{
+		{
+			name:      "Persisted",
+			result:    BackdoorCronJobResult{Admitted: true},
+			jobResult: BackdoorJobResult{Job: "kube-node-gc-28000000", Succeeded: true},
+			expected:  map[string]string{"admitted": verifier.Success, "first-job-ran": verifier.Success},
+		},
+		{
+			name:      "Admitted but the Job was blocked",
+			result:    BackdoorCronJobResult{Admitted: true},
+			jobResult: BackdoorJobResult{Message: "No Job finished within 2m0s"},
+			expected:  map[string]string{"admitted": verifier.Success, "first-job-ran": verifier.Fail},
+		},
+		{
+			name:      "Denied",
+			result:    BackdoorCronJobResult{Message: "denied by policy"},
+			jobResult: BackdoorJobResult{Message: "The CronJob was not admitted"},
+			expected:  map[string]string{"admitted": verifier.Fail, "first-job-ran": verifier.Fail},
+		},
+		{
+			name:      "Denied as expected",
+			result:    BackdoorCronJobResult{Message: "denied by policy"},
+			jobResult: BackdoorJobResult{Message: "The CronJob was not admitted"},
+			expect:    ExpectPrevented,
+			expected:  map[string]string{"admitted": verifier.Success, "first-job-ran": verifier.Success},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectSucceeded, err := parseExpect(test.expect, ExpectSucceeded)
+			require.NoError(t, err)
+			v := verifier.NewLegacy("backdoor", "", "", "", "")
+			verifyBackdoorCronJob(v, &test.result, &test.jobResult, expectSucceeded)
+			assert.Equal(t, test.expected, v.GetOutcome().Result)
+		})
+	}
+}
@@ -45,6 +45,10 @@ func (p *ClusterAdminBindingExperimentConfig) Framework() string {
 	return string(categories.Mitre)
 }
 
+func (p *ClusterAdminBindingExperimentConfig) SupportsDryRun() bool {
+	return true
+}
+
 func (p *ClusterAdminBindingExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
 	client, err := k8s.NewClient()
 	if err != nil {
@@ -71,8 +75,9 @@ func (p *ClusterAdminBindingExperimentConfig) Run(ctx context.Context, experimen
 	}
 
 	clientset := client.Clientset
-	_, err = clientset.CoreV1().ServiceAccounts(config.Metadata.Namespace).Create(ctx, sa, metav1.CreateOptions{})
-	if err != nil {
+	admission := newAdmission(experimentConfig)
+	_, err = clientset.CoreV1().ServiceAccounts(config.Metadata.Namespace).Create(ctx, sa, admission.options())
+	if err := admission.check("ServiceAccount", config.Metadata.Namespace, sa.Name, err); err != nil {
 		return err
 	}
 
@@ -97,8 +102,8 @@ func (p *ClusterAdminBindingExperimentConfig) Run(ctx context.Context, experimen
 		},
 	}
 
-	_, err = clientset.RbacV1().ClusterRoleBindings().Create(ctx, clusterRoleBinding, metav1.CreateOptions{})
-	if err != nil {
+	_, err = clientset.RbacV1().ClusterRoleBindings().Create(ctx, clusterRoleBinding, admission.options())
+	if err := admission.check("ClusterRoleBinding", "", clusterRoleBinding.Name, err); err != nil {
 		return err
 	}
 
@@ -141,8 +146,13 @@ func (p *ClusterAdminBindingExperimentConfig) Run(ctx context.Context, experimen
 			},
 		},
 	}
-	_, err = clientset.AppsV1().Deployments(config.Metadata.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
-	return err
+	// The service account is not persisted in dry-run mode, so a pod using it would be denied
+	// regardless of policy. Only the deployment is submitted.
+	_, err = clientset.AppsV1().Deployments(config.Metadata.Namespace).Create(ctx, deployment, admission.options())
+	if err := admission.check("Deployment", config.Metadata.Namespace, deployment.Name, err); err != nil {
+		return err
+	}
+	return admission.store(ctx, experimentConfig)
 }
 
 func (p *ClusterAdminBindingExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
@@ -165,6 +175,15 @@ func (p *ClusterAdminBindingExperimentConfig) Verify(ctx context.Context, experi
 		config.Technique(),
 	)
 
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return nil, err
+	}
+	if admission != nil {
+		admission.verify(v, true)
+		return v.GetOutcome(), nil
+	}
+
 	listOptions := metav1.ListOptions{
 		LabelSelector: "experiment=" + config.Metadata.Name,
 	}
@@ -203,6 +222,15 @@ func (p *ClusterAdminBindingExperimentConfig) Cleanup(ctx context.Context, exper
 		return err
 	}
 
+	// Nothing was created in dry-run mode
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return err
+	}
+	if admission != nil {
+		return removeResultsForExperiment(ctx, experimentConfig)
+	}
+
 	clientset := client.Clientset
 	err = clientset.AppsV1().Deployments(config.Metadata.Namespace).Delete(ctx, config.Metadata.Name, metav1.DeleteOptions{})
 	if err != nil {
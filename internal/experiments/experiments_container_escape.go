@@ -0,0 +1,294 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// ContainerEscapeExperimentConfig attempts to escape from a running privileged, host PID or
+// hostPath container to its node, with one check per escape primitive
+type ContainerEscapeExperimentConfig struct {
+	Metadata   ExperimentMetadata `yaml:"metadata"`
+	Parameters ContainerEscape    `yaml:"parameters"`
+}
+
+type ContainerEscape struct {
+	Target struct {
+		// Pod is the name of the pod to escape from
+		Pod string `yaml:"pod"`
+		// Selector is a label selector of the pods to escape from, the first running pod is used
+		Selector string `yaml:"selector"`
+		// Container defaults to the first container of the pod
+		Container string `yaml:"container"`
+	} `yaml:"target"`
+	// HostPath is where the filesystem of the host is mounted in the container, /host by default
+	HostPath string `yaml:"hostPath"`
+	// Primitives limits the attempts to the named escape primitives, all of them by default
+	Primitives []string `yaml:"primitives"`
+	// Timeout bounds how long to wait for the pod to run, 1m by default
+	Timeout string `yaml:"timeout"`
+	// Expect is what is expected of the escapes, succeeded by default or prevented to prove the
+	// container is isolated from its node
+	Expect string `yaml:"expect"`
+}
+
+type ContainerEscapeResult struct {
+	Pod        string                           `json:"pod"`
+	Container  string                           `json:"container"`
+	Primitives []ContainerEscapePrimitiveResult `json:"primitives"`
+}
+
+type ContainerEscapePrimitiveResult struct {
+	Primitive string   `json:"primitive"`
+	Technique string   `json:"technique"`
+	Command   []string `json:"command"`
+	Output    string   `json:"output"`
+	Error     string   `json:"error,omitempty"`
+	// Escaped is set when the primitive reached the host
+	Escaped bool `json:"escaped"`
+}
+
+// escapePrimitive is a way to reach the host from a container. Its script exits with a non-zero
+// status when it fails, and must not print secrets of the host as they end up in the results.
+type escapePrimitive struct {
+	name      string
+	technique string
+	script    func(hostPath, marker string) string
+}
+
+// runtimeSockets are the sockets of common container runtimes
+var runtimeSockets = []string{
+	"/run/containerd/containerd.sock",
+	"/run/k3s/containerd/containerd.sock",
+	"/var/run/docker.sock",
+	"/run/crio/crio.sock",
+	"/var/run/crio/crio.sock",
+}
+
+// escapePrimitives lists the escape primitives in the order they are attempted
+var escapePrimitives = []escapePrimitive{
+	{
+		// Only the host PID namespace makes PID 1 a process of the host rather than of the container
+		name:      "nsenter-host-pid-1",
+		technique: categories.MITRE.PrivilegeEscalation.PrivilegedContainer.Technique,
+		script: func(hostPath, marker string) string {
+			return `[ "$(readlink /proc/1/ns/mnt)" != "$(readlink /proc/self/ns/mnt)" ] || { echo "PID 1 is not a process of the host"; exit 1; }; ` +
+				`nsenter -t 1 -m -u -i -n -p -- cat /etc/hostname`
+		},
+	},
+	{
+		// Only the user names are printed, never the password hashes
+		name:      "read-host-shadow",
+		technique: categories.MITRE.PrivilegeEscalation.HostPathMount.Technique,
+		script: func(hostPath, marker string) string {
+			return fmt.Sprintf(`cut -d: -f1 %s/etc/shadow | grep -x root`, hostPath)
+		},
+	},
+	{
+		name:      "write-kubelet-dir",
+		technique: categories.MITRE.Persistence.WriteableHostPathMount.Technique,
+		script: func(hostPath, marker string) string {
+			file := fmt.Sprintf("%s/var/lib/kubelet/%s", hostPath, marker)
+			return fmt.Sprintf(`touch %[1]s && rm -f %[1]s && echo %[1]s`, file)
+		},
+	},
+	{
+		name:      "runtime-socket",
+		technique: categories.MITRE.Execution.NewContainer.Technique,
+		script: func(hostPath, marker string) string {
+			var sockets []string
+			for _, socket := range runtimeSockets {
+				sockets = append(sockets, socket, hostPath+socket)
+			}
+			return fmt.Sprintf(`for s in %s; do [ -S "$s" ] && [ -w "$s" ] && echo "$s"; done | grep .`, strings.Join(sockets, " "))
+		},
+	},
+}
+
+// execFunc runs a command in a container, like k8s.Client.ExecuteRemoteCommand
+type execFunc func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error)
+
+func (p *ContainerEscapeExperimentConfig) Type() string {
+	return "container-escape"
+}
+
+func (p *ContainerEscapeExperimentConfig) Description() string {
+	return "Attempt to escape from a privileged, host PID or hostPath container to its node"
+}
+
+func (p *ContainerEscapeExperimentConfig) Technique() string {
+	return categories.MITRE.PrivilegeEscalation.PrivilegedContainer.Technique
+}
+
+func (p *ContainerEscapeExperimentConfig) Tactic() string {
+	return categories.MITRE.PrivilegeEscalation.PrivilegedContainer.Tactic
+}
+
+func (p *ContainerEscapeExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+// primitives returns the escape primitives to attempt
+func (p *ContainerEscapeExperimentConfig) primitives() ([]escapePrimitive, error) {
+	var primitives []escapePrimitive
+	var names []string
+	for _, primitive := range escapePrimitives {
+		names = append(names, primitive.name)
+		if len(p.Parameters.Primitives) == 0 || slices.Contains(p.Parameters.Primitives, primitive.name) {
+			primitives = append(primitives, primitive)
+		}
+	}
+	for _, name := range p.Parameters.Primitives {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("Unknown escape primitive %s, expected one of %s", name, strings.Join(names, ", "))
+		}
+	}
+	return primitives, nil
+}
+
+// escape waits for the target pod to run, then attempts every primitive in it
+func (p *ContainerEscapeExperimentConfig) escape(ctx context.Context, clientset kubernetes.Interface, exec execFunc) (*ContainerEscapeResult, error) {
+	primitives, err := p.primitives()
+	if err != nil {
+		return nil, err
+	}
+	target := p.Parameters.Target
+	if (target.Pod == "") == (target.Selector == "") {
+		return nil, fmt.Errorf("Experiment %s needs either a target pod or a target selector", p.Metadata.Name)
+	}
+	timeout, err := parseTimeout(p.Parameters.Timeout, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseExpect(p.Parameters.Expect, ExpectSucceeded); err != nil {
+		return nil, err
+	}
+	hostPath := strings.TrimSuffix(p.Parameters.HostPath, "/")
+	if p.Parameters.HostPath == "" {
+		hostPath = "/host"
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var pod *corev1.Pod
+	if target.Pod != "" {
+		err = k8s.WaitForPodRunning(waitCtx, clientset, p.Metadata.Namespace, target.Pod, 2*time.Second)
+		if err == nil {
+			pod, err = clientset.CoreV1().Pods(p.Metadata.Namespace).Get(ctx, target.Pod, metav1.GetOptions{})
+		}
+	} else {
+		pod, err = k8s.WaitForRunningPod(waitCtx, clientset, p.Metadata.Namespace, target.Selector, 2*time.Second)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find a running pod to escape from: %w", err)
+	}
+	container := target.Container
+	if container == "" {
+		container = pod.Spec.Containers[0].Name
+	}
+
+	result := &ContainerEscapeResult{Pod: pod.Name, Container: container}
+	marker := ".woodpecker-" + p.Metadata.Name
+	for _, primitive := range primitives {
+		command := []string{"sh", "-c", primitive.script(hostPath, marker)}
+		primitiveResult := ContainerEscapePrimitiveResult{Primitive: primitive.name, Technique: primitive.technique, Command: command}
+		stdout, stderr, err := exec(ctx, p.Metadata.Namespace, pod.Name, container, command)
+		primitiveResult.Output = strings.TrimSpace(stdout + stderr)
+		if err != nil {
+			primitiveResult.Error = err.Error()
+		}
+		primitiveResult.Escaped = err == nil
+		result.Primitives = append(result.Primitives, primitiveResult)
+	}
+	return result, nil
+}
+
+func (p *ContainerEscapeExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config ContainerEscapeExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+
+	result, err := config.escape(ctx, client.Clientset, client.ExecuteRemoteCommand)
+	if err != nil {
+		return err
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *ContainerEscapeExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config ContainerEscapeExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var result ContainerEscapeResult
+		if err := json.Unmarshal(rawResult, &result); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		verifyContainerEscape(v, &result, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verifyContainerEscape adds a check per escape primitive. The attack of a check succeeded when
+// the primitive reached the host, the check is successful when that was expected.
+func verifyContainerEscape(v *verifier.LegacyVerifier, result *ContainerEscapeResult, expectSucceeded bool) {
+	for _, primitive := range result.Primitives {
+		checkAttack(v, primitive.Primitive, primitive.Escaped, expectSucceeded)
+		v.StoreResultOutputs(primitive.Primitive, primitive)
+	}
+}
+
+// Cleanup only removes the results, the primitives leave nothing behind on the host
+func (p *ContainerEscapeExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
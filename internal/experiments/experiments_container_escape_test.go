@@ -0,0 +1,107 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestContainerEscapeExperiment(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "escape-target-7d9f", Namespace: "default", Labels: map[string]string{"experiment": "escape-target"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "shell"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	// The host filesystem is readable, but the kubelet directory is read-only and PID 1 is not
+	// a process of the host
+	exec := func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+		script := command[2]
+		switch {
+		case strings.Contains(script, "nsenter"):
+			return "PID 1 is not a process of the host\n", "", errors.New("command terminated with exit code 1")
+		case strings.Contains(script, "/host/etc/shadow"):
+			return "root\n", "", nil
+		case strings.Contains(script, "/host/var/lib/kubelet/.woodpecker-escape"):
+			return "touch: /host/var/lib/kubelet/.woodpecker-escape: Read-only file system\n", "", errors.New("command terminated with exit code 1")
+		default:
+			return "/host/run/containerd/containerd.sock\n", "", nil
+		}
+	}
+
+	tests := []struct {
+		name       string
+		parameters ContainerEscape
+		expected   map[string]string
+		err        string
+	}{
+		{
+			name: "Every primitive",
+			expected: map[string]string{
+				"nsenter-host-pid-1": verifier.Fail,
+				"read-host-shadow":   verifier.Success,
+				"write-kubelet-dir":  verifier.Fail,
+				"runtime-socket":     verifier.Success,
+			},
+		},
+		{
+			name:       "Selected primitive",
+			parameters: ContainerEscape{Primitives: []string{"read-host-shadow"}},
+			expected:   map[string]string{"read-host-shadow": verifier.Success},
+		},
+		{
+			name:       "Escapes expected to be prevented",
+			parameters: ContainerEscape{Primitives: []string{"read-host-shadow", "write-kubelet-dir"}, Expect: ExpectPrevented},
+			expected: map[string]string{
+				"read-host-shadow":  verifier.Fail,
+				"write-kubelet-dir": verifier.Success,
+			},
+		},
+		{
+			name:       "Invalid expect",
+			parameters: ContainerEscape{Expect: "escaped"},
+			err:        "Invalid expect escaped, expected succeeded or prevented",
+		},
+		{
+			name:       "Unknown primitive",
+			parameters: ContainerEscape{Primitives: []string{"dirty-pipe"}},
+			err:        "Unknown escape primitive dirty-pipe",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &ContainerEscapeExperimentConfig{
+				Metadata:   ExperimentMetadata{Name: "escape", Namespace: "default"},
+				Parameters: test.parameters,
+			}
+			p.Parameters.Target.Selector = "experiment=escape-target"
+			result, err := p.escape(context.Background(), fake.NewSimpleClientset(pod), exec)
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "escape-target-7d9f", result.Pod)
+			assert.Equal(t, "shell", result.Container)
+
+			expectSucceeded, err := parseExpect(test.parameters.Expect, ExpectSucceeded)
+			require.NoError(t, err)
+			v := verifier.NewLegacy("escape", "", "", "", "")
+			verifyContainerEscape(v, result, expectSucceeded)
+			assert.Equal(t, test.expected, v.GetOutcome().Result)
+		})
+	}
+
+	p := &ContainerEscapeExperimentConfig{Metadata: ExperimentMetadata{Name: "escape", Namespace: "default"}}
+	_, err := p.escape(context.Background(), fake.NewSimpleClientset(pod), exec)
+	assert.EqualError(t, err, "Experiment escape needs either a target pod or a target selector")
+}
@@ -134,13 +134,7 @@ func (p *ExecuteAPIExperimentConfig) Run(ctx context.Context, experimentConfig *
 			return fmt.Errorf("Failed to marshal experiment results: %w", err)
 		}
 
-		file, err := createTempFile(p.Type(), config.Metadata.Name)
-		if err != nil {
-			return fmt.Errorf("Unable to create file cache for experiment results %w", err)
-		}
-
-		_, err = file.Write(resultJSON)
-		if err != nil {
+		if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
 			return fmt.Errorf("Failed to write experiment results: %w", err)
 		}
 	}
@@ -164,7 +158,7 @@ func (p *ExecuteAPIExperimentConfig) Verify(ctx context.Context, experimentConfi
 		config.Technique(),
 	)
 
-	rawResults, err := getTempFileContentsForExperiment(p.Type(), config.Metadata.Name)
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
 	if err != nil {
 		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
 	}
@@ -202,7 +196,7 @@ func (p *ExecuteAPIExperimentConfig) Cleanup(ctx context.Context, experimentConf
 		return err
 	}
 
-	if err := removeTempFilesForExperiment(p.Type(), config.Metadata.Name); err != nil {
+	if err := removeResultsForExperiment(ctx, experimentConfig); err != nil {
 		return err
 	}
 
@@ -50,6 +50,10 @@ func (p *HostPathMountExperimentConfig) Framework() string {
 	return string(categories.Mitre)
 }
 
+func (p *HostPathMountExperimentConfig) SupportsDryRun() bool {
+	return true
+}
+
 func (p *HostPathMountExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
 	client, err := k8s.NewClient()
 	if err != nil {
@@ -119,8 +123,11 @@ func (p *HostPathMountExperimentConfig) Run(ctx context.Context, experimentConfi
 			},
 		},
 	}
-	_, err = clientset.AppsV1().Deployments(hostPathMountExperimentConfig.Metadata.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
-	return err
+	admission := newAdmission(experimentConfig)
+	if err := admission.createDeployment(ctx, clientset, hostPathMountExperimentConfig.Metadata.Namespace, deployment); err != nil {
+		return err
+	}
+	return admission.store(ctx, experimentConfig)
 }
 
 func (p *HostPathMountExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
@@ -142,6 +149,14 @@ func (p *HostPathMountExperimentConfig) Verify(ctx context.Context, experimentCo
 		hostPathMountExperimentConfig.Tactic(),
 		hostPathMountExperimentConfig.Technique(),
 	)
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return nil, err
+	}
+	if admission != nil {
+		admission.verify(v, true)
+		return v.GetOutcome(), nil
+	}
 	listOptions := metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("app=%s", hostPathMountExperimentConfig.Metadata.Name),
 	}
@@ -183,6 +198,14 @@ func (p *HostPathMountExperimentConfig) Cleanup(ctx context.Context, experimentC
 	if err != nil {
 		return err
 	}
+	// Nothing was created in dry-run mode
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return err
+	}
+	if admission != nil {
+		return removeResultsForExperiment(ctx, experimentConfig)
+	}
 	clientset := client.Clientset
 	return clientset.AppsV1().Deployments(hostPathMountExperimentConfig.Metadata.Namespace).Delete(ctx, hostPathMountExperimentConfig.Metadata.Name, metav1.DeleteOptions{})
 }
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/executor"
+	"github.com/operantai/woodpecker/internal/imds"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// InstanceMetadataExperimentConfig deploys the executor, which probes the metadata services of
+// cloud providers from its pod for the credentials of the managed identity of the node
+type InstanceMetadataExperimentConfig struct {
+	Metadata   ExperimentMetadata `yaml:"metadata"`
+	Parameters InstanceMetadata   `yaml:"parameters"`
+}
+
+type InstanceMetadata struct {
+	ExecutorConfig executor.RemoteExecuteAPI `yaml:"executorConfig"`
+	// Providers limits the probes to the named providers, all of them by default
+	Providers []string `yaml:"providers"`
+	// Addresses overrides the link-local addresses of the metadata services, e.g. with the address
+	// of a fake metadata server
+	Addresses imds.Addresses `yaml:"addresses"`
+	// RequestTimeout bounds every request to a metadata service, 2s by default
+	RequestTimeout string `yaml:"requestTimeout"`
+	// Timeout bounds how long to wait for the executor and its probes, 2m by default
+	Timeout string `yaml:"timeout"`
+	// Expect is what is expected of the probes, succeeded by default or prevented to prove the
+	// metadata services are blocked
+	Expect string `yaml:"expect"`
+}
+
+// InstanceMetadataCheck is the output of a check, with the MITRE technique it stands for
+type InstanceMetadataCheck struct {
+	Technique string `json:"technique"`
+	imds.Result
+}
+
+func (p *InstanceMetadataExperimentConfig) Type() string {
+	return "instance-metadata"
+}
+
+func (p *InstanceMetadataExperimentConfig) Description() string {
+	return "Obtain the credentials of the cloud identity of a node from its instance metadata service"
+}
+
+func (p *InstanceMetadataExperimentConfig) Technique() string {
+	return categories.MITRE.Discovery.InstanceMetadataAPI.Technique
+}
+
+func (p *InstanceMetadataExperimentConfig) Tactic() string {
+	return categories.MITRE.Discovery.InstanceMetadataAPI.Tactic
+}
+
+func (p *InstanceMetadataExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+func (p *InstanceMetadataExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config InstanceMetadataExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(config.Parameters.Timeout, 2*time.Minute)
+	if err != nil {
+		return err
+	}
+	if _, err := parseExpect(config.Parameters.Expect, ExpectSucceeded); err != nil {
+		return err
+	}
+	path := config.Parameters.ExecutorConfig.Target.Path
+	if path == "" {
+		path = "/experiment/imds"
+	}
+	query := url.Values{"provider": config.Parameters.Providers}
+	for key, value := range map[string]string{
+		"aws":     config.Parameters.Addresses.AWS,
+		"gcp":     config.Parameters.Addresses.GCP,
+		"azure":   config.Parameters.Addresses.Azure,
+		"timeout": config.Parameters.RequestTimeout,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Deploy(ctx, client.Clientset); err != nil {
+		return err
+	}
+	var results []imds.Result
+	if err := queryExecutor(ctx, client, executorConfig, path, query, timeout, &results); err != nil {
+		return err
+	}
+
+	resultJSON, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *InstanceMetadataExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config InstanceMetadataExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var results []imds.Result
+		if err := json.Unmarshal(rawResult, &results); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		verifyInstanceMetadata(v, results, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verifyInstanceMetadata adds two checks per provider: <provider>/metadata, whose attack succeeded
+// when its metadata service answered, and <provider>/credentials, whose attack succeeded when
+// credentials were obtained. A check is successful when that was expected.
+func verifyInstanceMetadata(v *verifier.LegacyVerifier, results []imds.Result, expectSucceeded bool) {
+	check := func(name string, succeeded bool, technique string, result imds.Result) {
+		checkAttack(v, name, succeeded, expectSucceeded)
+		v.StoreResultOutputs(name, InstanceMetadataCheck{Technique: technique, Result: result})
+	}
+	for _, result := range results {
+		check(result.Provider+"/metadata", result.Reachable, categories.MITRE.Discovery.InstanceMetadataAPI.Technique, result)
+		check(result.Provider+"/credentials", result.Credentials, categories.MITRE.Credentials.AccessManagedIdentityCredentials.Technique, result)
+	}
+}
+
+func (p *InstanceMetadataExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config InstanceMetadataExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Cleanup(ctx, client.Clientset); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
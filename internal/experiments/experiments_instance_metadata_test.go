@@ -0,0 +1,42 @@
+package experiments
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/imds"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyInstanceMetadata(t *testing.T) {
+	server := httptest.NewServer(&imds.FakeServer{RequireIMDSv2: true})
+	defer server.Close()
+	p := imds.NewProber(imds.Addresses{AWS: server.URL, GCP: server.URL}, time.Second)
+	results, err := p.Probe(context.Background(), []string{imds.AWSIMDSv1, imds.AWSIMDSv2, imds.GCP})
+	require.NoError(t, err)
+
+	v := verifier.NewLegacy("imds", "", "", "", "")
+	verifyInstanceMetadata(v, results, true)
+	outcome := v.GetOutcome()
+	assert.Equal(t, map[string]string{
+		"aws-imdsv1/metadata":    verifier.Success,
+		"aws-imdsv1/credentials": verifier.Fail,
+		"aws-imdsv2/metadata":    verifier.Success,
+		"aws-imdsv2/credentials": verifier.Success,
+		"gcp/metadata":           verifier.Success,
+		"gcp/credentials":        verifier.Success,
+	}, outcome.Result)
+
+	output := outcome.ResultOutputs["gcp/credentials"][0].(InstanceMetadataCheck)
+	assert.Equal(t, "Access Managed Identity Credentials", output.Technique)
+	assert.Equal(t, "fake-node@fake-project.iam.gserviceaccount.com", output.Identity)
+
+	v = verifier.NewLegacy("imds", "", "", "", "")
+	verifyInstanceMetadata(v, results, false)
+	assert.Equal(t, verifier.Success, v.GetOutcome().Result["aws-imdsv1/credentials"])
+	assert.Equal(t, verifier.Fail, v.GetOutcome().Result["gcp/credentials"])
+}
@@ -86,13 +86,7 @@ func (k *KubeExec) Run(ctx context.Context, experimentConfig *ExperimentConfig)
 		return fmt.Errorf("Failed to marshal experiment results: %w", err)
 	}
 
-	file, err := createTempFile(k.Type(), config.Metadata.Name)
-	if err != nil {
-		return fmt.Errorf("Unable to create file cache for experiment results %w", err)
-	}
-
-	_, err = file.Write(resultJSON)
-	if err != nil {
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
 		return fmt.Errorf("Failed to write experiment results: %w", err)
 	}
 	return nil
@@ -115,7 +109,7 @@ func (k *KubeExec) Verify(ctx context.Context, experimentConfig *ExperimentConfi
 		config.Technique(),
 	)
 
-	rawResults, err := getTempFileContentsForExperiment(k.Type(), config.Metadata.Name)
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
 	if err != nil {
 		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
 	}
@@ -177,7 +171,7 @@ func (k *KubeExec) Cleanup(ctx context.Context, experimentConfig *ExperimentConf
 		return err
 	}
 
-	if err := removeTempFilesForExperiment(k.Type(), config.Metadata.Name); err != nil {
+	if err := removeResultsForExperiment(ctx, experimentConfig); err != nil {
 		return err
 	}
 
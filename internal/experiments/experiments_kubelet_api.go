@@ -0,0 +1,209 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/executor"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/kubelet"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// KubeletAPIExperimentConfig deploys the executor, which probes the kubelets of the nodes from
+// its pod, anonymously and with the token of its service account
+type KubeletAPIExperimentConfig struct {
+	Metadata   ExperimentMetadata `yaml:"metadata"`
+	Parameters KubeletAPI         `yaml:"parameters"`
+}
+
+type KubeletAPI struct {
+	// ExecutorConfig sets the service account whose token is sent to the kubelets
+	ExecutorConfig executor.RemoteExecuteAPI `yaml:"executorConfig"`
+	// Nodes limits the probes to the named nodes, every node by default
+	Nodes []string `yaml:"nodes"`
+	// ReadOnlyPort and Port are the ports of the kubelet, 10255 and 10250 by default
+	ReadOnlyPort int `yaml:"readOnlyPort"`
+	Port         int `yaml:"port"`
+	// RequestTimeout bounds every request to a kubelet, 2s by default
+	RequestTimeout string `yaml:"requestTimeout"`
+	// Timeout bounds how long to wait for the executor and its probes, 2m by default
+	Timeout string `yaml:"timeout"`
+	// Expect is what is expected of the probes, succeeded by default or prevented to prove the
+	// kubelets deny them
+	Expect string `yaml:"expect"`
+}
+
+func (p *KubeletAPIExperimentConfig) Type() string {
+	return "kubelet-api"
+}
+
+func (p *KubeletAPIExperimentConfig) Description() string {
+	return "Access the kubelet API of the nodes from a pod, anonymously and with its service account token"
+}
+
+func (p *KubeletAPIExperimentConfig) Technique() string {
+	return categories.MITRE.Discovery.AccessKubeletAPI.Technique
+}
+
+func (p *KubeletAPIExperimentConfig) Tactic() string {
+	return categories.MITRE.Discovery.AccessKubeletAPI.Tactic
+}
+
+func (p *KubeletAPIExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+func (p *KubeletAPIExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config KubeletAPIExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(config.Parameters.Timeout, 2*time.Minute)
+	if err != nil {
+		return err
+	}
+	if _, err := parseExpect(config.Parameters.Expect, ExpectSucceeded); err != nil {
+		return err
+	}
+	path := config.Parameters.ExecutorConfig.Target.Path
+	if path == "" {
+		path = "/experiment/kubelet"
+	}
+
+	// The nodes are listed here, as the service account of the executor may not list them
+	list, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to list nodes: %w", err)
+	}
+	query := url.Values{}
+	for _, node := range kubelet.NodesFromList(list) {
+		if len(config.Parameters.Nodes) == 0 || slices.Contains(config.Parameters.Nodes, node.Name) {
+			query.Add("node", node.Name+"="+node.Address)
+		}
+	}
+	if len(query["node"]) == 0 {
+		return fmt.Errorf("Experiment %s found no nodes with an internal IP to probe", config.Metadata.Name)
+	}
+	if config.Parameters.ReadOnlyPort != 0 {
+		query.Set("readOnlyPort", strconv.Itoa(config.Parameters.ReadOnlyPort))
+	}
+	if config.Parameters.Port != 0 {
+		query.Set("port", strconv.Itoa(config.Parameters.Port))
+	}
+	if config.Parameters.RequestTimeout != "" {
+		query.Set("timeout", config.Parameters.RequestTimeout)
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Deploy(ctx, client.Clientset); err != nil {
+		return err
+	}
+	var results []kubelet.NodeResult
+	if err := queryExecutor(ctx, client, executorConfig, path, query, timeout, &results); err != nil {
+		return err
+	}
+
+	resultJSON, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *KubeletAPIExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config KubeletAPIExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var results []kubelet.NodeResult
+		if err := json.Unmarshal(rawResult, &results); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		verifyKubeletAPI(v, results, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verifyKubeletAPI adds two checks per node: <node>/unauthenticated, whose attack succeeded when
+// the kubelet authorized an anonymous request, and <node>/over-privileged, whose attack succeeded
+// when it authorized a request with the service account token. A check is successful when that
+// was expected. The outputs are the authorized requests.
+func verifyKubeletAPI(v *verifier.LegacyVerifier, results []kubelet.NodeResult, expectSucceeded bool) {
+	for _, node := range results {
+		for _, token := range []bool{false, true} {
+			check := node.Node + "/unauthenticated"
+			if token {
+				check = node.Node + "/over-privileged"
+			}
+			var allowed []kubelet.Result
+			for _, result := range node.Results {
+				if result.Token == token && result.Allowed {
+					allowed = append(allowed, result)
+				}
+			}
+			checkAttack(v, check, len(allowed) > 0, expectSucceeded)
+			v.StoreResultOutputs(check, allowed)
+		}
+	}
+}
+
+func (p *KubeletAPIExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config KubeletAPIExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Cleanup(ctx, client.Clientset); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
@@ -0,0 +1,49 @@
+package experiments
+
+import (
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/kubelet"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyKubeletAPI(t *testing.T) {
+	results := []kubelet.NodeResult{
+		{
+			Node: "node-1",
+			Results: []kubelet.Result{
+				{Port: 10255, Endpoint: "pods", Status: 200, Allowed: true},
+				{Port: 10250, Endpoint: "pods", Status: 401, Message: "401 Unauthorized"},
+				{Port: 10250, Endpoint: "pods", Token: true, Status: 403, Message: "403 Forbidden"},
+			},
+		},
+		{
+			Node: "node-2",
+			Results: []kubelet.Result{
+				{Port: 10255, Endpoint: "pods", Message: "connection refused"},
+				{Port: 10250, Endpoint: "exec", Token: true, Status: 404, Allowed: true},
+			},
+		},
+	}
+
+	v := verifier.NewLegacy("kubelet", "", "", "", "")
+	verifyKubeletAPI(v, results, true)
+	outcome := v.GetOutcome()
+	assert.Equal(t, map[string]string{
+		"node-1/unauthenticated": verifier.Success,
+		"node-1/over-privileged": verifier.Fail,
+		"node-2/unauthenticated": verifier.Fail,
+		"node-2/over-privileged": verifier.Success,
+	}, outcome.Result)
+	assert.Equal(t, []interface{}{[]kubelet.Result{results[0].Results[0]}}, outcome.ResultOutputs["node-1/unauthenticated"])
+
+	v = verifier.NewLegacy("kubelet", "", "", "", "")
+	verifyKubeletAPI(v, results, false)
+	assert.Equal(t, map[string]string{
+		"node-1/unauthenticated": verifier.Fail,
+		"node-1/over-privileged": verifier.Success,
+		"node-2/unauthenticated": verifier.Success,
+		"node-2/over-privileged": verifier.Fail,
+	}, v.GetOutcome().Result)
+}
@@ -0,0 +1,464 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/executor"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/operantai/woodpecker/internal/webhook"
+)
+
+// webhookProbeLabel labels the probes of the experiment, the only objects routed through its webhook
+const webhookProbeLabel = "webhook-probe"
+
+// webhookCertDir is where the Secret of the serving certificate is mounted in the executor
+const webhookCertDir = "/etc/woodpecker/webhook"
+
+// MaliciousAdmissionWebhookExperimentConfig registers a mutating webhook served by the executor,
+// checking whether pod creates are routed through it, whether it can inject into pods and whether
+// it can read Secrets
+type MaliciousAdmissionWebhookExperimentConfig struct {
+	Metadata   ExperimentMetadata        `yaml:"metadata"`
+	Parameters MaliciousAdmissionWebhook `yaml:"parameters"`
+}
+
+type MaliciousAdmissionWebhook struct {
+	ExecutorConfig executor.RemoteExecuteAPI `yaml:"executorConfig"`
+	// SidecarImage is the image of the sidecar injected into pods
+	SidecarImage string `yaml:"sidecarImage"`
+	// Impersonate is the user registering the webhook, e.g. system:serviceaccount:<namespace>:<name>,
+	// the user of the kubeconfig by default
+	Impersonate string `yaml:"impersonate"`
+	// RoutingTimeout bounds how long to wait for the API server to route pod creates through the
+	// webhook, 30s by default
+	RoutingTimeout string `yaml:"routingTimeout"`
+	// Timeout bounds how long to wait for the executor, 2m by default
+	Timeout string `yaml:"timeout"`
+	// Expect is what is expected of the webhook, succeeded by default or prevented to prove it
+	// cannot be registered or abused
+	Expect string `yaml:"expect"`
+}
+
+// MaliciousAdmissionWebhookResult is what the webhook could do while it was registered
+type MaliciousAdmissionWebhookResult struct {
+	Configuration string `json:"configuration"`
+	Registered    bool   `json:"registered"`
+	Message       string `json:"message,omitempty"`
+	// EnvInjected and SidecarInjected are set when the probe pod came back from admission with them
+	EnvInjected     bool `json:"envInjected"`
+	SidecarInjected bool `json:"sidecarInjected"`
+	// Reviews are the admission requests of the probes routed through the webhook
+	Reviews []webhook.Review `json:"reviews"`
+}
+
+// MaliciousAdmissionWebhookCheck is the output of a check, with its tactic as the checks of the
+// experiment span Persistence and Credential Access
+type MaliciousAdmissionWebhookCheck struct {
+	Tactic  string           `json:"tactic"`
+	Message string           `json:"message,omitempty"`
+	Reviews []webhook.Review `json:"reviews,omitempty"`
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Type() string {
+	return "malicious-admission-webhook"
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Description() string {
+	return "Register a mutating admission webhook injecting into pods and reading Secrets"
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Technique() string {
+	return categories.MITRE.Persistence.MaliciousAdmissionController.Technique
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Tactic() string {
+	return categories.MITRE.Persistence.MaliciousAdmissionController.Tactic
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+// configurationName is the name of the MutatingWebhookConfiguration, which is cluster-scoped
+func (p *MaliciousAdmissionWebhookExperimentConfig) configurationName() string {
+	return fmt.Sprintf("woodpecker-%s-%s", p.Metadata.Namespace, p.Metadata.Name)
+}
+
+// serviceName is the name of the Service of the webhook, next to the Service of the executor
+func (p *MaliciousAdmissionWebhookExperimentConfig) serviceName() string {
+	return p.Metadata.Name + "-webhook"
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) probeName() string {
+	return p.Metadata.Name + "-probe"
+}
+
+// certSecretName is the name of the Secret of the serving certificate of the webhook
+func (p *MaliciousAdmissionWebhookExperimentConfig) certSecretName() string {
+	return p.Metadata.Name + "-webhook-tls"
+}
+
+// certSecret returns the kubernetes.io/tls Secret of the serving certificate, mounted in the
+// executor so that its key never appears in the executor Deployment
+func (p *MaliciousAdmissionWebhookExperimentConfig) certSecret(certs *webhook.Certificates) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p.certSecretName(),
+			Namespace: p.Metadata.Namespace,
+			Labels:    map[string]string{"experiment": p.Metadata.Name},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certs.Cert,
+			corev1.TLSPrivateKeyKey: certs.Key,
+		},
+	}
+}
+
+// webhookConfiguration returns the MutatingWebhookConfiguration, which only routes the creates of
+// the probes and is ignored when the webhook fails, so that it can never block the cluster
+func (p *MaliciousAdmissionWebhookExperimentConfig) webhookConfiguration(caBundle []byte) *admissionregistrationv1.MutatingWebhookConfiguration {
+	failurePolicy := admissionregistrationv1.Ignore
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	scope := admissionregistrationv1.NamespacedScope
+	path := webhook.Path
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   p.configurationName(),
+			Labels: map[string]string{"experiment": p.Metadata.Name},
+		},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{{
+			Name: fmt.Sprintf("%s.%s.woodpecker.operant.ai", p.Metadata.Name, p.Metadata.Namespace),
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Namespace: p.Metadata.Namespace,
+					Name:      p.serviceName(),
+					Path:      &path,
+					Port:      pointer.Int32(443),
+				},
+				CABundle: caBundle,
+			},
+			Rules: []admissionregistrationv1.RuleWithOperations{{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods", "secrets"},
+					Scope:       &scope,
+				},
+			}},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{corev1.LabelMetadataName: p.Metadata.Namespace},
+			},
+			ObjectSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{webhookProbeLabel: p.Metadata.Name},
+			},
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+			TimeoutSeconds:          pointer.Int32(5),
+		}},
+	}
+}
+
+// webhookService returns the Service of the webhook, in front of the TLS port of the executor
+func (p *MaliciousAdmissionWebhookExperimentConfig) webhookService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p.serviceName(),
+			Namespace: p.Metadata.Namespace,
+			Labels:    map[string]string{"experiment": p.Metadata.Name},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": p.Metadata.Name},
+			Ports: []corev1.ServicePort{{
+				Port:       443,
+				TargetPort: intstr.FromInt(webhook.Port),
+			}},
+		},
+	}
+}
+
+// register registers the webhook, recording whether it was allowed to
+func (p *MaliciousAdmissionWebhookExperimentConfig) register(ctx context.Context, clientset kubernetes.Interface, caBundle []byte, result *MaliciousAdmissionWebhookResult) error {
+	result.Configuration = p.configurationName()
+	_, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(ctx, p.webhookConfiguration(caBundle), metav1.CreateOptions{})
+	if err != nil {
+		if !isAdmissionDenial(err) {
+			return fmt.Errorf("Failed to register webhook %s: %w", result.Configuration, err)
+		}
+		result.Message = err.Error()
+		return nil
+	}
+	result.Registered = true
+	return nil
+}
+
+// probe creates a pod and a Secret with server-side dry-run, so that they are only admitted. The pod
+// is created again until it comes back mutated or the timeout expires, as the API server may take
+// a moment to route requests through a new webhook.
+func (p *MaliciousAdmissionWebhookExperimentConfig) probe(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration, result *MaliciousAdmissionWebhookResult) error {
+	labels := map[string]string{webhookProbeLabel: p.Metadata.Name}
+	options := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: p.probeName(), Namespace: p.Metadata.Namespace, Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "probe",
+				Image:   "alpine:latest",
+				Command: []string{"sh", "-c", "while true; do sleep 3600; done"},
+			}},
+		},
+	}
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		admitted, err := clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod.DeepCopy(), options)
+		if err != nil {
+			// The mutated pod may be denied by other admission controllers
+			if isAdmissionDenial(err) {
+				result.Message = err.Error()
+				return true, nil
+			}
+			return false, fmt.Errorf("Failed to create probe pod: %w", err)
+		}
+		for _, container := range admitted.Spec.Containers {
+			if container.Name == webhook.DefaultSidecarName {
+				result.SidecarInjected = true
+			} else if slices.ContainsFunc(container.Env, func(env corev1.EnvVar) bool { return env.Name == webhook.DefaultEnvName }) {
+				result.EnvInjected = true
+			}
+		}
+		return result.EnvInjected || result.SidecarInjected, nil
+	})
+	if err != nil && !wait.Interrupted(err) {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: p.probeName(), Namespace: p.Metadata.Namespace, Labels: labels},
+		Data:       map[string][]byte{"canary": []byte("woodpecker")},
+	}
+	_, err = clientset.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, options)
+	if err != nil && !isAdmissionDenial(err) {
+		return fmt.Errorf("Failed to create probe Secret: %w", err)
+	}
+	return nil
+}
+
+// deregister deletes the webhook configuration, if it exists
+func (p *MaliciousAdmissionWebhookExperimentConfig) deregister(ctx context.Context, clientset kubernetes.Interface) error {
+	err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Delete(ctx, p.configurationName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Failed to delete webhook %s: %w", p.configurationName(), err)
+	}
+	return nil
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) (err error) {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config MaliciousAdmissionWebhookExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(config.Parameters.Timeout, 2*time.Minute)
+	if err != nil {
+		return err
+	}
+	routingTimeout, err := parseTimeout(config.Parameters.RoutingTimeout, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	if _, err := parseExpect(config.Parameters.Expect, ExpectSucceeded); err != nil {
+		return err
+	}
+	clientset, err := impersonate(client, config.Parameters.Impersonate)
+	if err != nil {
+		return err
+	}
+	path := config.Parameters.ExecutorConfig.Target.Path
+	if path == "" {
+		path = "/experiment/webhook"
+	}
+
+	// The certificates are generated for every run and only handed to the executor, through a
+	// Secret mounted in its pod
+	service := config.serviceName()
+	certs, err := webhook.NewCertificates([]string{
+		fmt.Sprintf("%s.%s.svc", service, config.Metadata.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", service, config.Metadata.Namespace),
+	}, 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Clientset.CoreV1().Secrets(config.Metadata.Namespace).Create(ctx, config.certSecret(certs), metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("Failed to create webhook certificate Secret: %w", err)
+	}
+	api := config.Parameters.ExecutorConfig
+	api.ImageParameters = append(slices.Clone(api.ImageParameters), webhook.CertDirEnv+"="+webhookCertDir)
+	if config.Parameters.SidecarImage != "" {
+		api.ImageParameters = append(api.ImageParameters, webhook.SidecarImageEnv+"="+config.Parameters.SidecarImage)
+	}
+	executorConfig := newExecutor(config.Metadata, api)
+	executorConfig.Parameters.SecretVolumes = []executor.SecretVolume{{SecretName: config.certSecretName(), MountPath: webhookCertDir}}
+	if err := executorConfig.Deploy(ctx, client.Clientset); err != nil {
+		return err
+	}
+	if _, err := client.Clientset.CoreV1().Services(config.Metadata.Namespace).Create(ctx, config.webhookService(), metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("Failed to create webhook Service: %w", err)
+	}
+	// The webhook is only registered once it is served
+	var reviews []webhook.Review
+	if err := queryExecutor(ctx, client, executorConfig, path, nil, timeout, &reviews); err != nil {
+		return err
+	}
+
+	// The webhook only stays registered while it is probed, even when the run fails or is
+	// interrupted
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		err = errors.Join(err, config.deregister(ctx, client.Clientset))
+	}()
+	result := &MaliciousAdmissionWebhookResult{}
+	if err := config.register(ctx, clientset, certs.CA, result); err != nil {
+		return err
+	}
+	if result.Registered {
+		if err := config.probe(ctx, client.Clientset, routingTimeout, result); err != nil {
+			return err
+		}
+		if err := queryExecutor(ctx, client, executorConfig, path, nil, timeout, &result.Reviews); err != nil {
+			return err
+		}
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config MaliciousAdmissionWebhookExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var result MaliciousAdmissionWebhookResult
+		if err := json.Unmarshal(rawResult, &result); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		config.verify(v, &result, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verify adds five checks, whose attacks succeeded when: registered, the webhook could be
+// registered, routed, the probe pod was routed through it, env-injection and sidecar-injection,
+// the probe pod came back from admission with them, and secret-read, the webhook could read the
+// values of the probe Secret. A check is successful when that was expected.
+func (p *MaliciousAdmissionWebhookExperimentConfig) verify(v *verifier.LegacyVerifier, result *MaliciousAdmissionWebhookResult, expectSucceeded bool) {
+	persistence := categories.MITRE.Persistence.MaliciousAdmissionController.Tactic
+	credentials := categories.MITRE.Credentials.MaliciousAdmissionController.Tactic
+	var pods, secrets []webhook.Review
+	for _, review := range result.Reviews {
+		if review.Name != p.probeName() {
+			continue
+		}
+		switch review.Kind {
+		case "Pod":
+			pods = append(pods, review)
+		case "Secret":
+			secrets = append(secrets, review)
+		}
+	}
+	readSecret := slices.ContainsFunc(secrets, func(review webhook.Review) bool { return review.SecretValues })
+
+	check := func(name string, succeeded bool, output MaliciousAdmissionWebhookCheck) {
+		checkAttack(v, name, succeeded, expectSucceeded)
+		v.StoreResultOutputs(name, output)
+	}
+	check("registered", result.Registered, MaliciousAdmissionWebhookCheck{Tactic: persistence, Message: result.Message})
+	check("routed", len(pods) > 0, MaliciousAdmissionWebhookCheck{Tactic: persistence, Reviews: pods})
+	check("env-injection", result.EnvInjected, MaliciousAdmissionWebhookCheck{Tactic: persistence})
+	check("sidecar-injection", result.SidecarInjected, MaliciousAdmissionWebhookCheck{Tactic: persistence})
+	check("secret-read", readSecret, MaliciousAdmissionWebhookCheck{Tactic: credentials, Reviews: secrets})
+}
+
+func (p *MaliciousAdmissionWebhookExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config MaliciousAdmissionWebhookExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+
+	// The webhook is deregistered first, in case the run was killed before it could do it
+	if err := config.deregister(ctx, client.Clientset); err != nil {
+		return err
+	}
+	err = client.Clientset.CoreV1().Services(config.Metadata.Namespace).Delete(ctx, config.serviceName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	err = client.Clientset.CoreV1().Secrets(config.Metadata.Namespace).Delete(ctx, config.certSecretName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Failed to delete webhook certificate Secret: %w", err)
+	}
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Cleanup(ctx, client.Clientset); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
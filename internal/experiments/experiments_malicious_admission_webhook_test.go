@@ -0,0 +1,186 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/operantai/woodpecker/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMaliciousAdmissionWebhookRegistration(t *testing.T) {
+	p := &MaliciousAdmissionWebhookExperimentConfig{Metadata: ExperimentMetadata{Name: "webhook", Namespace: "default"}}
+	configuration := p.webhookConfiguration([]byte("ca"))
+	require.Len(t, configuration.Webhooks, 1)
+	hook := configuration.Webhooks[0]
+	assert.Equal(t, "woodpecker-default-webhook", configuration.Name)
+	assert.Equal(t, admissionregistrationv1.Ignore, *hook.FailurePolicy)
+	assert.Equal(t, "webhook-webhook", hook.ClientConfig.Service.Name)
+	assert.Equal(t, []byte("ca"), hook.ClientConfig.CABundle)
+	assert.Equal(t, map[string]string{webhookProbeLabel: "webhook"}, hook.ObjectSelector.MatchLabels)
+	assert.Equal(t, map[string]string{corev1.LabelMetadataName: "default"}, hook.NamespaceSelector.MatchLabels)
+
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	result := &MaliciousAdmissionWebhookResult{}
+	require.NoError(t, p.register(ctx, clientset, []byte("ca"), result))
+	assert.True(t, result.Registered)
+	_, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, configuration.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, p.deregister(ctx, clientset))
+	_, err = clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, configuration.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	// Deregistering again, as cleanup does after the run, is a no-op
+	require.NoError(t, p.deregister(ctx, clientset))
+
+	clientset = fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(admissionregistrationv1.Resource("mutatingwebhookconfigurations"), configuration.Name, errors.New("denied by RBAC"))
+	})
+	result = &MaliciousAdmissionWebhookResult{}
+	require.NoError(t, p.register(ctx, clientset, []byte("ca"), result))
+	assert.False(t, result.Registered)
+	assert.Contains(t, result.Message, "denied by RBAC")
+}
+
+func TestMaliciousAdmissionWebhookCertSecret(t *testing.T) {
+	p := &MaliciousAdmissionWebhookExperimentConfig{Metadata: ExperimentMetadata{Name: "webhook", Namespace: "default"}}
+	certs := &webhook.Certificates{CA: []byte("ca"), Cert: []byte("cert"), Key: []byte("key")}
+	secret := p.certSecret(certs)
+	assert.Equal(t, "webhook-webhook-tls", secret.Name)
+	assert.Equal(t, "default", secret.Namespace)
+	assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")}, secret.Data)
+}
+
+func TestMaliciousAdmissionWebhookProbe(t *testing.T) {
+	p := &MaliciousAdmissionWebhookExperimentConfig{Metadata: ExperimentMetadata{Name: "webhook", Namespace: "default"}}
+	ctx := context.Background()
+
+	// The API server routes the pod through the webhook from its second create
+	clientset := fake.NewSimpleClientset()
+	var creates int
+	var secret *corev1.Secret
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		assert.Equal(t, "webhook", pod.Labels[webhookProbeLabel])
+		if creates > 1 {
+			pod.Spec.Containers[0].Env = []corev1.EnvVar{{Name: webhook.DefaultEnvName, Value: "true"}}
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: webhook.DefaultSidecarName})
+		}
+		return true, pod, nil
+	})
+	clientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret = action.(k8stesting.CreateAction).GetObject().(*corev1.Secret)
+		return true, secret, nil
+	})
+	result := &MaliciousAdmissionWebhookResult{}
+	require.NoError(t, p.probe(ctx, clientset, 10*time.Second, result))
+	assert.Equal(t, 2, creates)
+	assert.True(t, result.EnvInjected)
+	assert.True(t, result.SidecarInjected)
+	require.NotNil(t, secret)
+	assert.Equal(t, "webhook-probe", secret.Name)
+	assert.Equal(t, "webhook", secret.Labels[webhookProbeLabel])
+
+	// Never routed, the fake clientset does not support dry-run
+	clientset = fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, action.(k8stesting.CreateAction).GetObject(), nil
+	})
+	result = &MaliciousAdmissionWebhookResult{}
+	require.NoError(t, p.probe(ctx, clientset, 10*time.Millisecond, result))
+	assert.False(t, result.EnvInjected)
+	assert.False(t, result.SidecarInjected)
+}
+
+func TestVerifyMaliciousAdmissionWebhook(t *testing.T) {
+	p := &MaliciousAdmissionWebhookExperimentConfig{Metadata: ExperimentMetadata{Name: "webhook", Namespace: "default"}}
+	pod := webhook.Review{Kind: "Pod", Namespace: "default", Name: "webhook-probe", Operation: "CREATE", DryRun: true, Patched: []string{"env", "sidecar"}}
+	secret := webhook.Review{Kind: "Secret", Namespace: "default", Name: "webhook-probe", Operation: "CREATE", DryRun: true, SecretKeys: []string{"canary"}, SecretValues: true}
+	tests := []struct {
+		name     string
+		result   MaliciousAdmissionWebhookResult
+		expect   string
+		expected map[string]string
+	}{
+		{
+			name: "Persisted and read Secrets",
+			result: MaliciousAdmissionWebhookResult{
+				Registered:      true,
+				EnvInjected:     true,
+				SidecarInjected: true,
+				Reviews:         []webhook.Review{pod, secret},
+			},
+			expected: map[string]string{
+				"registered":        verifier.Success,
+				"routed":            verifier.Success,
+				"env-injection":     verifier.Success,
+				"sidecar-injection": verifier.Success,
+				"secret-read":       verifier.Success,
+			},
+		},
+		{
+			name: "Routed but the mutation was reverted",
+			result: MaliciousAdmissionWebhookResult{
+				Registered: true,
+				Reviews:    []webhook.Review{pod, {Kind: "Secret", Name: "other", SecretValues: true}},
+			},
+			expected: map[string]string{
+				"registered":        verifier.Success,
+				"routed":            verifier.Success,
+				"env-injection":     verifier.Fail,
+				"sidecar-injection": verifier.Fail,
+				"secret-read":       verifier.Fail,
+			},
+		},
+		{
+			name:   "Registration denied",
+			result: MaliciousAdmissionWebhookResult{Message: "denied by RBAC"},
+			expected: map[string]string{
+				"registered":        verifier.Fail,
+				"routed":            verifier.Fail,
+				"env-injection":     verifier.Fail,
+				"sidecar-injection": verifier.Fail,
+				"secret-read":       verifier.Fail,
+			},
+		},
+		{
+			name:   "Registration denied as expected",
+			result: MaliciousAdmissionWebhookResult{Message: "denied by RBAC"},
+			expect: ExpectPrevented,
+			expected: map[string]string{
+				"registered":        verifier.Success,
+				"routed":            verifier.Success,
+				"env-injection":     verifier.Success,
+				"sidecar-injection": verifier.Success,
+				"secret-read":       verifier.Success,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectSucceeded, err := parseExpect(test.expect, ExpectSucceeded)
+			require.NoError(t, err)
+			v := verifier.NewLegacy("webhook", "", "", "", "")
+			p.verify(v, &test.result, expectSucceeded)
+			outcome := v.GetOutcome()
+			assert.Equal(t, test.expected, outcome.Result)
+			assert.Equal(t, "Credential Access", outcome.ResultOutputs["secret-read"][0].(MaliciousAdmissionWebhookCheck).Tactic)
+		})
+	}
+}
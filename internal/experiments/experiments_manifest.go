@@ -0,0 +1,382 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// Expectations of the manifest experiment
+const (
+	// ManifestCreated expects every object to be admitted
+	ManifestCreated = "created"
+	// ManifestDenied expects every object to be rejected by admission
+	ManifestDenied = "denied"
+)
+
+// experimentLabel labels the objects created by an experiment with its name
+const experimentLabel = "experiment"
+
+// ManifestExperiment applies Kubernetes manifests of any kind, expecting admission to create or
+// deny them, and optionally runs commands in the pods it created
+type ManifestExperiment struct {
+	Metadata   ExperimentMetadata `yaml:"metadata"`
+	Parameters ManifestParameters `yaml:"parameters"`
+
+	// untrusted is set for experiments of remote files, which cannot read manifest files
+	untrusted bool
+}
+
+type ManifestParameters struct {
+	// Manifests are inline YAML manifests, documents are separated by ---
+	Manifests string `yaml:"manifests"`
+	// Files are paths of YAML manifests
+	Files  []string `yaml:"files"`
+	Expect struct {
+		// Result is created, the default, or denied
+		Result string `yaml:"result"`
+		// MessageRegex must match the message of denied objects
+		MessageRegex string `yaml:"messageRegex"`
+	} `yaml:"expect"`
+	// Exec runs commands in created pods, once they are running
+	Exec []ManifestExec `yaml:"exec"`
+	// Timeout bounds how long to wait for pods to run, 1m by default
+	Timeout string `yaml:"timeout"`
+}
+
+type ManifestExec struct {
+	Pod                 string   `yaml:"pod"`
+	Container           string   `yaml:"container"`
+	Command             []string `yaml:"command"`
+	ExpectedOutputRegex string   `yaml:"expectedOutputRegex"`
+}
+
+type ManifestResult struct {
+	// DryRun is set when the objects were submitted with server-side dry-run
+	DryRun   bool                   `json:"dryRun,omitempty"`
+	Objects  []ManifestObjectResult `json:"objects"`
+	Commands []ManifestExecResult   `json:"commands,omitempty"`
+}
+
+type ManifestObjectResult struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Created   bool   `json:"created"`
+	// Message is the reason admission denied the object
+	Message string `json:"message,omitempty"`
+}
+
+type ManifestExecResult struct {
+	Pod       string   `json:"pod"`
+	Container string   `json:"container"`
+	Command   []string `json:"command"`
+	Stdout    string   `json:"stdout"`
+	Stderr    string   `json:"stderr"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func (m *ManifestExperiment) Type() string {
+	return "manifest"
+}
+
+func (m *ManifestExperiment) Description() string {
+	return "Apply Kubernetes manifests and check whether admission creates or denies them"
+}
+
+func (m *ManifestExperiment) Technique() string {
+	return categories.MITRE.Execution.NewContainer.Technique
+}
+
+func (m *ManifestExperiment) Tactic() string {
+	return categories.MITRE.Execution.NewContainer.Tactic
+}
+
+func (m *ManifestExperiment) Framework() string {
+	return string(categories.Mitre)
+}
+
+func (m *ManifestExperiment) SupportsDryRun() bool {
+	return true
+}
+
+// objects returns the objects of the inline and referenced manifests, labelled with the name of
+// the experiment
+func (m *ManifestExperiment) objects() ([]*unstructured.Unstructured, error) {
+	manifests := []string{m.Parameters.Manifests}
+	if m.untrusted && len(m.Parameters.Files) > 0 {
+		return nil, fmt.Errorf("Failed to read manifest: %w", errUntrusted)
+	}
+	for _, file := range m.Parameters.Files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read manifest: %w", err)
+		}
+		manifests = append(manifests, string(contents))
+	}
+	objects, err := k8s.DecodeManifests([]byte(strings.Join(manifests, "\n---\n")))
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("Experiment %s has no manifests", m.Metadata.Name)
+	}
+	for _, object := range objects {
+		labels := object.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[experimentLabel] = m.Metadata.Name
+		object.SetLabels(labels)
+	}
+	return objects, nil
+}
+
+func (m *ManifestExperiment) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config ManifestExperiment
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	config.untrusted = experimentConfig.untrusted
+	resources, err := client.NewResources()
+	if err != nil {
+		return err
+	}
+
+	result, err := config.apply(ctx, resources, newAdmission(experimentConfig).options())
+	if err != nil {
+		return err
+	}
+	result.DryRun = experimentConfig.dryRun
+	// Nothing runs in dry-run mode, so there are no pods to exec into
+	if len(config.Parameters.Exec) > 0 && config.Parameters.Expect.Result != ManifestDenied && !result.DryRun {
+		timeout, err := parseTimeout(config.Parameters.Timeout, time.Minute)
+		if err != nil {
+			return err
+		}
+		result.Commands = config.exec(ctx, client, timeout)
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+// apply creates the objects of the manifests. Objects rejected by the API server, e.g. by an
+// admission controller or webhook, are recorded as denied, other errors fail the experiment.
+func (m *ManifestExperiment) apply(ctx context.Context, resources *k8s.Resources, options metav1.CreateOptions) (*ManifestResult, error) {
+	switch m.Parameters.Expect.Result {
+	case "", ManifestCreated, ManifestDenied:
+	default:
+		return nil, fmt.Errorf("Invalid expected result %s, expected %s or %s", m.Parameters.Expect.Result, ManifestCreated, ManifestDenied)
+	}
+	objects, err := m.objects()
+	if err != nil {
+		return nil, err
+	}
+	result := &ManifestResult{}
+	for _, object := range objects {
+		resource, err := resources.For(object, m.Metadata.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		objectResult := ManifestObjectResult{Kind: object.GetKind(), Name: object.GetName(), Namespace: object.GetNamespace()}
+		_, err = resource.Create(ctx, object, options)
+		switch {
+		case err == nil:
+			objectResult.Created = true
+		case isAdmissionDenial(err):
+			objectResult.Message = err.Error()
+		default:
+			return nil, fmt.Errorf("Failed to create %s %s: %w", object.GetKind(), object.GetName(), err)
+		}
+		result.Objects = append(result.Objects, objectResult)
+	}
+	return result, nil
+}
+
+// exec runs the commands in their pods once they are running
+func (m *ManifestExperiment) exec(ctx context.Context, client *k8s.Client, timeout time.Duration) []ManifestExecResult {
+	var results []ManifestExecResult
+	for _, e := range m.Parameters.Exec {
+		result := ManifestExecResult{Pod: e.Pod, Container: e.Container, Command: e.Command}
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := k8s.WaitForPodRunning(waitCtx, client.Clientset, m.Metadata.Namespace, e.Pod, 2*time.Second)
+		cancel()
+		if err == nil {
+			result.Stdout, result.Stderr, err = client.ExecuteRemoteCommand(ctx, m.Metadata.Namespace, e.Pod, e.Container, e.Command)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (m *ManifestExperiment) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config ManifestExperiment
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var result ManifestResult
+		if err := json.Unmarshal(rawResult, &result); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		if err := config.verify(v, &result); err != nil {
+			return nil, err
+		}
+	}
+	return v.GetOutcome(), nil
+}
+
+// verify adds a check per object, whose attack succeeded when admission created it, successful
+// when that was expected: created, the default, or denied with a message matching messageRegex.
+// It adds a check per command, whose attack succeeded, and that is successful, when its output
+// matches its regular expression.
+func (m *ManifestExperiment) verify(v *verifier.LegacyVerifier, result *ManifestResult) error {
+	var messageRegex *regexp.Regexp
+	if m.Parameters.Expect.MessageRegex != "" {
+		var err error
+		if messageRegex, err = regexp.Compile(m.Parameters.Expect.MessageRegex); err != nil {
+			return fmt.Errorf("Invalid messageRegex: %w", err)
+		}
+	}
+	for _, object := range result.Objects {
+		check := fmt.Sprintf("%s/%s", strings.ToLower(object.Kind), object.Name)
+		expected := object.Created
+		if m.Parameters.Expect.Result == ManifestDenied {
+			expected = !object.Created && (messageRegex == nil || messageRegex.MatchString(object.Message))
+		}
+		if expected {
+			v.Success(check)
+		} else {
+			v.Fail(check)
+		}
+		v.StoreResultOutputs(check, object)
+	}
+
+	for i, command := range result.Commands {
+		check := fmt.Sprintf("exec %s/%s: %s", command.Pod, command.Container, strings.Join(command.Command, " "))
+		var pattern string
+		if i < len(m.Parameters.Exec) {
+			pattern = m.Parameters.Exec[i].ExpectedOutputRegex
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid expectedOutputRegex: %w", err)
+		}
+		if command.Error == "" && command.Stderr == "" && regex.MatchString(command.Stdout) {
+			v.Success(check)
+		} else {
+			v.Fail(check)
+		}
+		v.StoreResultOutputs(check, command)
+	}
+	return nil
+}
+
+func (m *ManifestExperiment) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config ManifestExperiment
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	config.untrusted = experimentConfig.untrusted
+	resources, err := client.NewResources()
+	if err != nil {
+		return err
+	}
+	if err := config.deleteObjects(ctx, resources); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
+
+// deleteObjects deletes the objects labelled with the name of the experiment, of every kind and
+// namespace of the manifests
+func (m *ManifestExperiment) deleteObjects(ctx context.Context, resources *k8s.Resources) error {
+	objects, err := m.objects()
+	if err != nil {
+		return err
+	}
+	listOptions := metav1.ListOptions{LabelSelector: experimentLabel + "=" + m.Metadata.Name}
+	propagation := metav1.DeletePropagationBackground
+	seen := make(map[string]bool)
+	var errs []error
+	for _, object := range objects {
+		resource, err := resources.For(object, m.Metadata.Namespace)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		key := schema.FromAPIVersionAndKind(object.GetAPIVersion(), object.GetKind()).String() + "/" + object.GetNamespace()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		list, err := resource.List(ctx, listOptions)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to list %s: %w", object.GetKind(), err))
+			continue
+		}
+		for _, item := range list.Items {
+			err := resource.Delete(ctx, item.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("Failed to delete %s %s: %w", object.GetKind(), item.GetName(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,177 @@
+package experiments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testManifests = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: privileged
+spec:
+  containers:
+    - name: shell
+      image: alpine
+      securityContext:
+        privileged: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  labels:
+    app: settings
+data:
+  key: value
+`
+
+func newTestResources() (*k8s.Resources, *dynamicfake.FakeDynamicClient) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		pods:       "PodList",
+		configMaps: "ConfigMapList",
+	})
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	// Pods are denied, as by the restricted Pod Security Standard
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(pods.GroupResource(), "privileged", assert.AnError)
+	})
+	return &k8s.Resources{Client: client, Mapper: mapper}, client
+}
+
+func TestManifestExperiment(t *testing.T) {
+	tests := []struct {
+		name         string
+		result       string
+		messageRegex string
+		expected     map[string]string
+	}{
+		{
+			name:     "Created",
+			result:   ManifestCreated,
+			expected: map[string]string{"pod/privileged": verifier.Fail, "configmap/settings": verifier.Success},
+		},
+		{
+			name:     "Denied",
+			result:   ManifestDenied,
+			expected: map[string]string{"pod/privileged": verifier.Success, "configmap/settings": verifier.Fail},
+		},
+		{
+			name:         "Denied with a message",
+			result:       ManifestDenied,
+			messageRegex: "forbidden: assert.AnError",
+			expected:     map[string]string{"pod/privileged": verifier.Success, "configmap/settings": verifier.Fail},
+		},
+		{
+			name:         "Denied with another message",
+			result:       ManifestDenied,
+			messageRegex: "violates PodSecurity",
+			expected:     map[string]string{"pod/privileged": verifier.Fail, "configmap/settings": verifier.Fail},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			resources, client := newTestResources()
+			m := &ManifestExperiment{
+				Metadata: ExperimentMetadata{Name: "manifest", Namespace: "default", Type: "manifest"},
+			}
+			m.Parameters.Manifests = testManifests
+			m.Parameters.Expect.Result = test.result
+			m.Parameters.Expect.MessageRegex = test.messageRegex
+
+			result, err := m.apply(ctx, resources, metav1.CreateOptions{})
+			require.NoError(t, err)
+			require.Len(t, result.Objects, 2)
+			assert.Equal(t, "default", result.Objects[1].Namespace)
+
+			v := verifier.NewLegacy(m.Metadata.Name, m.Description(), m.Framework(), m.Tactic(), m.Technique())
+			require.NoError(t, m.verify(v, result))
+			assert.Equal(t, test.expected, v.GetOutcome().Result)
+
+			// Created objects are labelled, so that they are cleaned up
+			configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+			configMap, err := client.Resource(configMaps).Namespace("default").Get(ctx, "settings", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"app": "settings", experimentLabel: "manifest"}, configMap.GetLabels())
+
+			require.NoError(t, m.deleteObjects(ctx, resources))
+			list, err := client.Resource(configMaps).Namespace("default").List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Empty(t, list.Items)
+		})
+	}
+}
+
+func TestManifestExperimentExecChecks(t *testing.T) {
+	m := &ManifestExperiment{Metadata: ExperimentMetadata{Name: "manifest"}}
+	m.Parameters.Exec = []ManifestExec{
+		{Pod: "shell", Container: "shell", Command: []string{"id"}, ExpectedOutputRegex: "uid=0"},
+		{Pod: "shell", Container: "shell", Command: []string{"cat", "/etc/shadow"}, ExpectedOutputRegex: "root:"},
+		{Pod: "shell", Container: "shell", Command: []string{"ls"}},
+	}
+	result := &ManifestResult{Commands: []ManifestExecResult{
+		{Pod: "shell", Container: "shell", Command: []string{"id"}, Stdout: "uid=0(root) gid=0(root)"},
+		{Pod: "shell", Container: "shell", Command: []string{"cat", "/etc/shadow"}, Stderr: "Permission denied"},
+		{Pod: "shell", Container: "shell", Command: []string{"ls"}, Error: "Pod default/shell is Failed"},
+	}}
+
+	v := verifier.NewLegacy(m.Metadata.Name, m.Description(), m.Framework(), m.Tactic(), m.Technique())
+	require.NoError(t, m.verify(v, result))
+	assert.Equal(t, map[string]string{
+		"exec shell/shell: id":              verifier.Success,
+		"exec shell/shell: cat /etc/shadow": verifier.Fail,
+		"exec shell/shell: ls":              verifier.Fail,
+	}, v.GetOutcome().Result)
+}
+
+func TestManifestExperimentInvalid(t *testing.T) {
+	resources, _ := newTestResources()
+	m := &ManifestExperiment{Metadata: ExperimentMetadata{Name: "manifest"}}
+	_, err := m.apply(context.Background(), resources, metav1.CreateOptions{})
+	assert.EqualError(t, err, "Experiment manifest has no manifests")
+
+	m.Parameters.Manifests = testManifests
+	m.Parameters.Expect.Result = "admitted"
+	_, err = m.apply(context.Background(), resources, metav1.CreateOptions{})
+	assert.EqualError(t, err, "Invalid expected result admitted, expected created or denied")
+
+	m.Parameters.Manifests = "kind: Pod\nmetadata:\n  name: pod\n"
+	m.Parameters.Expect.Result = ""
+	_, err = m.apply(context.Background(), resources, metav1.CreateOptions{})
+	assert.EqualError(t, err, `Manifest "pod" is missing its apiVersion or kind`)
+	// Experiments of untrusted remote files cannot read manifest files
+	m = &ManifestExperiment{Metadata: ExperimentMetadata{Name: "manifest"}, untrusted: true}
+	m.Parameters.Files = []string{"/etc/passwd"}
+	_, err = m.apply(context.Background(), resources, metav1.CreateOptions{})
+	assert.ErrorIs(t, err, errUntrusted)
+	// Malformed manifests are errors, not denials, even when objects are expected to be denied
+	resources, client := newTestResources()
+	client.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "settings", field.ErrorList{field.Invalid(field.NewPath("data"), "key", "invalid key")})
+	})
+	m = &ManifestExperiment{Metadata: ExperimentMetadata{Name: "manifest"}}
+	m.Parameters.Manifests = testManifests
+	m.Parameters.Expect.Result = ManifestDenied
+	_, err = m.apply(context.Background(), resources, metav1.CreateOptions{})
+	assert.ErrorContains(t, err, "Failed to create ConfigMap settings")
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/executor"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/network"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// NetworkMappingExperimentConfig deploys the executor, which maps the network of the cluster from
+// its pod. By default it passes only when runtime security tooling prevents or flags the mapping.
+type NetworkMappingExperimentConfig struct {
+	Metadata   ExperimentMetadata `yaml:"metadata"`
+	Parameters NetworkMapping     `yaml:"parameters"`
+}
+
+type NetworkMapping struct {
+	ExecutorConfig executor.RemoteExecuteAPI `yaml:"executorConfig"`
+	// ClusterDomain is the domain of the cluster DNS, cluster.local by default
+	ClusterDomain string `yaml:"clusterDomain"`
+	// Namespaces and Services are looked up in the cluster DNS, with SRV lookups of the PortNames
+	// of the services found, common names by default
+	Namespaces []string `yaml:"namespaces"`
+	Services   []string `yaml:"services"`
+	PortNames  []string `yaml:"portNames"`
+	// CIDRs are scanned for the Ports, the pod CIDRs of the nodes and the /24 of the kubernetes
+	// Service by default, up to MaxHosts hosts, 256 by default
+	CIDRs       []string `yaml:"cidrs"`
+	Ports       []int    `yaml:"ports"`
+	MaxHosts    int      `yaml:"maxHosts"`
+	Concurrency int      `yaml:"concurrency"`
+	// Banners grabs the banners of open ports
+	Banners bool `yaml:"banners"`
+	// RequestTimeout bounds every lookup and connection, 1s by default
+	RequestTimeout string `yaml:"requestTimeout"`
+	// Timeout bounds how long to wait for the executor and its mapping, 5m by default
+	Timeout   string                  `yaml:"timeout"`
+	Detection NetworkMappingDetection `yaml:"detection"`
+	// Expect is what is expected of the mapping, prevented by default to prove runtime security
+	// tooling prevents or flags it, or succeeded to go unnoticed
+	Expect string `yaml:"expect"`
+}
+
+// NetworkMappingDetection is how the experiment finds out that the mapping was flagged
+type NetworkMappingDetection struct {
+	// EventRegex matches the reason, message or source of the Kubernetes events about the executor
+	// raised by runtime security tooling
+	EventRegex string `yaml:"eventRegex"`
+	// Wait is how long to wait for the mapping to be flagged, 30s by default
+	Wait string `yaml:"wait"`
+}
+
+// defaultDetectionEventRegex matches the events of common runtime security tools
+const defaultDetectionEventRegex = `(?i)falco|tetragon|sysdig|kubearmor|network.?scan|port.?scan|reconnaissance|suspicious`
+
+// NetworkMappingResult is the result of the experiment
+type NetworkMappingResult struct {
+	// Started is when the executor was asked to map the network
+	Started time.Time              `json:"started"`
+	Mapping *network.MappingResult `json:"mapping,omitempty"`
+	// Interrupted is set when the connection to the executor was cut during the mapping
+	Interrupted string `json:"interrupted,omitempty"`
+}
+
+// NetworkMappingCheck is the output of a check
+type NetworkMappingCheck struct {
+	// Prevented is set when the mapping was interrupted, or its stage found nothing while some of
+	// its lookups or connections were refused
+	Prevented bool `json:"prevented"`
+	// Flagged lists the detections of the mapping
+	Flagged []string    `json:"flagged,omitempty"`
+	Found   interface{} `json:"found,omitempty"`
+}
+
+func (p *NetworkMappingExperimentConfig) Type() string {
+	return "network-mapping"
+}
+
+func (p *NetworkMappingExperimentConfig) Description() string {
+	return "Map the cluster network from a pod and check that runtime security tooling prevents or flags it"
+}
+
+func (p *NetworkMappingExperimentConfig) Technique() string {
+	return categories.MITRE.Discovery.NetworkMapping.Technique
+}
+
+func (p *NetworkMappingExperimentConfig) Tactic() string {
+	return categories.MITRE.Discovery.NetworkMapping.Tactic
+}
+
+func (p *NetworkMappingExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+// defaultMappingCIDRs returns the pod CIDRs of the nodes and the /24 of the kubernetes Service
+func defaultMappingCIDRs(ctx context.Context, clientset kubernetes.Interface) ([]string, error) {
+	var cidrs []string
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		if len(node.Spec.PodCIDRs) > 0 {
+			cidrs = append(cidrs, node.Spec.PodCIDRs...)
+		} else if node.Spec.PodCIDR != "" {
+			cidrs = append(cidrs, node.Spec.PodCIDR)
+		}
+	}
+	service, err := clientset.CoreV1().Services("default").Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("Failed to get the kubernetes Service: %w", err)
+	}
+	if err == nil {
+		if addr, err := netip.ParseAddr(service.Spec.ClusterIP); err == nil && addr.Is4() {
+			prefix, _ := addr.Prefix(24)
+			cidrs = append(cidrs, prefix.String())
+		}
+	}
+	return cidrs, nil
+}
+
+func (p *NetworkMappingExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config NetworkMappingExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(config.Parameters.Timeout, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	if _, err := parseExpect(config.Parameters.Expect, ExpectPrevented); err != nil {
+		return err
+	}
+	path := config.Parameters.ExecutorConfig.Target.Path
+	if path == "" {
+		path = "/experiment/mapping"
+	}
+	cidrs := config.Parameters.CIDRs
+	if len(cidrs) == 0 {
+		if cidrs, err = defaultMappingCIDRs(ctx, client.Clientset); err != nil {
+			return err
+		}
+	}
+	request := network.MappingRequest{
+		ClusterDomain: config.Parameters.ClusterDomain,
+		Namespaces:    config.Parameters.Namespaces,
+		Services:      config.Parameters.Services,
+		PortNames:     config.Parameters.PortNames,
+		CIDRs:         cidrs,
+		Ports:         config.Parameters.Ports,
+		MaxHosts:      config.Parameters.MaxHosts,
+		Concurrency:   config.Parameters.Concurrency,
+		Banners:       config.Parameters.Banners,
+		Timeout:       config.Parameters.RequestTimeout,
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Deploy(ctx, client.Clientset); err != nil {
+		return err
+	}
+	result := NetworkMappingResult{Started: time.Now()}
+	err = postExecutor(ctx, client, executorConfig, path, request, timeout, &result.Mapping)
+	switch {
+	case err == nil:
+	case errors.Is(err, errExecutorNotRunning) || ctx.Err() != nil:
+		return err
+	// A mapping that did not finish in time says nothing about whether it was prevented
+	case wait.Interrupted(err) || errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("Mapping of experiment %s did not finish within %s: %w", config.Metadata.Name, timeout, err)
+	// Once the executor ran, losing the connection to it means something stopped it
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || network.IsRefused(err):
+		result.Mapping = nil
+		result.Interrupted = err.Error()
+	default:
+		return err
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+// detections returns why the executor was flagged: events matching the pattern about it, and its
+// pods being deleted or killed since the mapping started. Containers that ran out of memory or
+// failed on their own are not killed.
+func (p *NetworkMappingExperimentConfig) detections(ctx context.Context, clientset kubernetes.Interface, pattern *regexp.Regexp, started time.Time) ([]string, error) {
+	var detections []string
+	events, err := clientset.CoreV1().Events(p.Metadata.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list events: %w", err)
+	}
+	for _, event := range events.Items {
+		name := event.InvolvedObject.Name
+		if name != p.Metadata.Name && !strings.HasPrefix(name, p.Metadata.Name+"-") {
+			continue
+		}
+		text := strings.Join([]string{event.Reason, event.Message, event.Source.Component, event.ReportingController}, " ")
+		if pattern.MatchString(text) {
+			detections = append(detections, fmt.Sprintf("Event %s on %s %s: %s", event.Reason, strings.ToLower(event.InvolvedObject.Kind), name, event.Message))
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods(p.Metadata.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + p.Metadata.Name})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list executor pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		detections = append(detections, "The executor pod was deleted")
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			detections = append(detections, fmt.Sprintf("Pod %s is being deleted", pod.Name))
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+				if terminated != nil && terminated.FinishedAt.Time.After(started) && killed(terminated) {
+					detections = append(detections, fmt.Sprintf("Container %s of pod %s was killed with exit code %d: %s %s", status.Name, pod.Name, terminated.ExitCode, terminated.Reason, terminated.Message))
+					break
+				}
+			}
+		}
+	}
+	return detections, nil
+}
+
+// killed reports whether a container was killed with SIGKILL or SIGTERM, as runtime security
+// tooling does, rather than running out of memory or exiting on its own. The runtime reports such
+// kills with the reason Error, so they are told apart by exit code or signal.
+func killed(terminated *corev1.ContainerStateTerminated) bool {
+	if terminated.Reason == "OOMKilled" {
+		return false
+	}
+	switch {
+	case terminated.Signal == int32(syscall.SIGKILL), terminated.Signal == int32(syscall.SIGTERM):
+		return true
+	case terminated.ExitCode == 128+int32(syscall.SIGKILL), terminated.ExitCode == 128+int32(syscall.SIGTERM):
+		return true
+	}
+	return false
+}
+
+func (p *NetworkMappingExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	var config NetworkMappingExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	eventRegex := config.Parameters.Detection.EventRegex
+	if eventRegex == "" {
+		eventRegex = defaultDetectionEventRegex
+	}
+	pattern, err := regexp.Compile(eventRegex)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid event regex %s: %w", eventRegex, err)
+	}
+	detectionWait, err := parseTimeout(config.Parameters.Detection.Wait, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectPrevented)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var result NetworkMappingResult
+		if err := json.Unmarshal(rawResult, &result); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+
+		// Runtime security tooling may take a while to flag the mapping
+		var detections []string
+		err := wait.PollUntilContextTimeout(ctx, 2*time.Second, detectionWait, true, func(ctx context.Context) (bool, error) {
+			var err error
+			detections, err = config.detections(ctx, client.Clientset, pattern, result.Started)
+			return len(detections) > 0, err
+		})
+		if err != nil && !wait.Interrupted(err) {
+			return nil, err
+		}
+		verifyNetworkMapping(v, &result, config.Parameters.Banners, detections, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verifyNetworkMapping adds a check per stage of the mapping: dns-enumeration, tcp-scan and, when
+// banners were grabbed, banner-grab. The attack of a stage succeeded unless it was prevented or
+// the mapping was flagged, the check is successful when that was expected: by default when the
+// stage was prevented or the mapping flagged. A stage was prevented
+// when the mapping was interrupted, or it found nothing while some of its lookups or connections
+// were refused. A stage that found nothing because its lookups and connections timed out or
+// targeted nothing was not prevented.
+func verifyNetworkMapping(v *verifier.LegacyVerifier, result *NetworkMappingResult, banners bool, detections []string, expectSucceeded bool) {
+	check := func(name string, found interface{}, foundNothing bool, failures network.Failures) {
+		prevented := result.Interrupted != "" || foundNothing && failures.Refused > 0
+		output := NetworkMappingCheck{Prevented: prevented, Flagged: detections}
+		if !foundNothing {
+			output.Found = found
+		}
+		checkAttack(v, name, !output.Prevented && len(detections) == 0, expectSucceeded)
+		v.StoreResultOutputs(name, output)
+	}
+
+	mapping := result.Mapping
+	if mapping == nil {
+		mapping = &network.MappingResult{}
+	}
+	check("dns-enumeration", mapping.Records, len(mapping.Records) == 0, mapping.DNSFailures)
+	check("tcp-scan", mapping.Hosts, len(mapping.Hosts) == 0, mapping.TCPFailures)
+	if banners {
+		var grabbed []string
+		for _, host := range mapping.Hosts {
+			for _, port := range host.Ports {
+				if port.Banner != "" {
+					grabbed = append(grabbed, fmt.Sprintf("%s:%d %s", host.Address, port.Port, port.Banner))
+				}
+			}
+		}
+		// Without open ports, grabbing banners was prevented when the scan was
+		failures := mapping.BannerFailures
+		if len(mapping.Hosts) == 0 {
+			failures.Refused += mapping.TCPFailures.Refused
+		}
+		check("banner-grab", grabbed, len(grabbed) == 0, failures)
+	}
+}
+
+func (p *NetworkMappingExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config NetworkMappingExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Cleanup(ctx, client.Clientset); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
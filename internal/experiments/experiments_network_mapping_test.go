@@ -0,0 +1,161 @@
+package experiments
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/network"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNetworkMappingDetections(t *testing.T) {
+	p := &NetworkMappingExperimentConfig{Metadata: ExperimentMetadata{Name: "mapping", Namespace: "default"}}
+	pattern := regexp.MustCompile(defaultDetectionEventRegex)
+	started := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	terminated := func(reason string, exitCode int32, finished time.Time) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode, Message: "killed by policy", FinishedAt: metav1.NewTime(finished)}}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "mapping-6d8b-x2", Namespace: "default", Labels: map[string]string{"app": "mapping"}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			// The runtime reports a SIGKILL with the reason Error
+			{Name: "mapping", LastTerminationState: terminated("Error", 137, started.Add(time.Minute))},
+			{Name: "scanner", State: terminated("Error", 143, started.Add(time.Minute))},
+			// Killed before the mapping, out of memory or exiting on its own
+			{Name: "restarted", LastTerminationState: terminated("Error", 137, started.Add(-time.Minute))},
+			{Name: "oom", State: terminated("OOMKilled", 137, started.Add(time.Minute))},
+			{Name: "crashed", State: terminated("Error", 1, started.Add(time.Minute))},
+			{Name: "completed", State: terminated("Completed", 0, started.Add(time.Minute))},
+		}},
+	}
+	event := func(name, object, reason, message string) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: object},
+			Reason:         reason,
+			Message:        message,
+		}
+	}
+
+	detections, err := p.detections(context.Background(), fake.NewSimpleClientset(
+		event("scheduled", "mapping-6d8b-x2", "Scheduled", "Successfully assigned default/mapping-6d8b-x2"),
+		event("falco", "mapping-6d8b-x2", "FalcoAlert", "Network scan detected from container mapping"),
+		event("other", "web-0", "FalcoAlert", "Shell spawned in container web"),
+		pod,
+	), pattern, started)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Event FalcoAlert on pod mapping-6d8b-x2: Network scan detected from container mapping",
+		"Container mapping of pod mapping-6d8b-x2 was killed with exit code 137: Error killed by policy",
+		"Container scanner of pod mapping-6d8b-x2 was killed with exit code 143: Error killed by policy",
+	}, detections)
+
+	detections, err = p.detections(context.Background(), fake.NewSimpleClientset(), pattern, started)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"The executor pod was deleted"}, detections)
+}
+
+func TestVerifyNetworkMapping(t *testing.T) {
+	mapping := &network.MappingResult{
+		Records: []network.DNSRecord{{Name: "kubernetes.default.svc.cluster.local", Type: "A", Values: []string{"10.96.0.1"}}},
+		Hosts:   []network.Host{{Address: "10.244.0.5", Ports: []network.OpenPort{{Port: 6379}}}},
+	}
+	tests := []struct {
+		name       string
+		result     NetworkMappingResult
+		detections []string
+		expected   map[string]string
+	}{
+		{
+			name:   "Mapped unnoticed",
+			result: NetworkMappingResult{Mapping: mapping},
+			expected: map[string]string{
+				"dns-enumeration": verifier.Fail,
+				"tcp-scan":        verifier.Fail,
+				"banner-grab":     verifier.Fail,
+			},
+		},
+		{
+			name: "Found nothing as the mapping timed out",
+			result: NetworkMappingResult{Mapping: &network.MappingResult{
+				DNSFailures: network.Failures{TimedOut: 40},
+				TCPFailures: network.Failures{TimedOut: 3072},
+			}},
+			expected: map[string]string{
+				"dns-enumeration": verifier.Fail,
+				"tcp-scan":        verifier.Fail,
+				"banner-grab":     verifier.Fail,
+			},
+		},
+		{
+			name: "Refused",
+			result: NetworkMappingResult{Mapping: &network.MappingResult{
+				DNSFailures: network.Failures{Refused: 40},
+				TCPFailures: network.Failures{Refused: 12, TimedOut: 3060},
+			}},
+			expected: map[string]string{
+				"dns-enumeration": verifier.Success,
+				"tcp-scan":        verifier.Success,
+				"banner-grab":     verifier.Success,
+			},
+		},
+		{
+			name: "Open ports without banners",
+			result: NetworkMappingResult{Mapping: &network.MappingResult{
+				Hosts:       mapping.Hosts,
+				TCPFailures: network.Failures{Refused: 11},
+			}},
+			expected: map[string]string{
+				"dns-enumeration": verifier.Fail,
+				"tcp-scan":        verifier.Fail,
+				"banner-grab":     verifier.Fail,
+			},
+		},
+		{
+			name:       "Flagged",
+			result:     NetworkMappingResult{Mapping: mapping},
+			detections: []string{"Event FalcoAlert on pod mapping-6d8b-x2: Network scan detected"},
+			expected: map[string]string{
+				"dns-enumeration": verifier.Success,
+				"tcp-scan":        verifier.Success,
+				"banner-grab":     verifier.Success,
+			},
+		},
+		{
+			name:   "Interrupted",
+			result: NetworkMappingResult{Interrupted: "connection reset by peer"},
+			expected: map[string]string{
+				"dns-enumeration": verifier.Success,
+				"tcp-scan":        verifier.Success,
+				"banner-grab":     verifier.Success,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := verifier.NewLegacy("mapping", "", "", "", "")
+			verifyNetworkMapping(v, &test.result, true, test.detections, false)
+			assert.Equal(t, test.expected, v.GetOutcome().Result)
+
+			// Expecting the mapping to succeed inverts every check
+			inverted := make(map[string]string)
+			for check, result := range test.expected {
+				inverted[check] = verifier.Success
+				if result == verifier.Success {
+					inverted[check] = verifier.Fail
+				}
+			}
+			v = verifier.NewLegacy("mapping", "", "", "", "")
+			verifyNetworkMapping(v, &test.result, true, test.detections, true)
+			assert.Equal(t, inverted, v.GetOutcome().Result)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/executor"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/network"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// NetworkReachabilityExperimentConfig deploys the executor in the source namespace, which
+// connects to the Services and Pods of other namespaces, and compares what it reached with what
+// NetworkPolicies are expected to allow
+type NetworkReachabilityExperimentConfig struct {
+	Metadata   ExperimentMetadata  `yaml:"metadata"`
+	Parameters NetworkReachability `yaml:"parameters"`
+}
+
+type NetworkReachability struct {
+	ExecutorConfig executor.RemoteExecuteAPI `yaml:"executorConfig"`
+	// TargetNamespaces are the namespaces whose Services and Pods are probed, every namespace by
+	// default
+	TargetNamespaces []string `yaml:"targetNamespaces"`
+	// Kinds limits the targets to service or pod, both by default
+	Kinds []string `yaml:"kinds"`
+	// Protocols limits the probes to tcp, http or dns, all of them by default
+	Protocols []string `yaml:"protocols"`
+	// MaxTargets bounds the targets of each kind per namespace, 20 by default
+	MaxTargets int `yaml:"maxTargets"`
+	// ClusterDomain is the domain of the cluster DNS, cluster.local by default
+	ClusterDomain string `yaml:"clusterDomain"`
+	// Expected is what NetworkPolicies should allow. Targets matched by no rule are expected to be
+	// reachable in the source namespace and unreachable outside of it.
+	Expected []ReachabilityExpectation `yaml:"expected"`
+	// RequestTimeout bounds every probe, 2s by default
+	RequestTimeout string `yaml:"requestTimeout"`
+	// Timeout bounds how long to wait for the executor and its probes, 5m by default
+	Timeout string `yaml:"timeout"`
+}
+
+// ReachabilityExpectation is whether the targets of a namespace, optionally of a kind and name,
+// should be reachable. The most specific rule matching a target applies.
+type ReachabilityExpectation struct {
+	Namespace string `yaml:"namespace"`
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Reachable bool   `yaml:"reachable"`
+}
+
+// ReachabilityMatrix is the result of the experiment
+type ReachabilityMatrix struct {
+	Source  string                       `json:"source"`
+	Results []network.ReachabilityResult `json:"results"`
+}
+
+// ReachabilityCheck is the output of the check of a target
+type ReachabilityCheck struct {
+	Expected bool `json:"expected"`
+	network.ReachabilityResult
+}
+
+// NamespaceReachability is the output of the check of a namespace, a row of the matrix
+type NamespaceReachability struct {
+	Reachable   int `json:"reachable"`
+	Unreachable int `json:"unreachable"`
+	// Unexpected lists the targets whose reachability is not the expected one
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+func (p *NetworkReachabilityExperimentConfig) Type() string {
+	return "network-reachability"
+}
+
+func (p *NetworkReachabilityExperimentConfig) Description() string {
+	return "Connect to Services and Pods across namespaces and compare what is reachable with what NetworkPolicies should allow"
+}
+
+func (p *NetworkReachabilityExperimentConfig) Technique() string {
+	return categories.MITRE.LateralMovement.ClusterInternalNetworking.Technique
+}
+
+func (p *NetworkReachabilityExperimentConfig) Tactic() string {
+	return categories.MITRE.LateralMovement.ClusterInternalNetworking.Tactic
+}
+
+func (p *NetworkReachabilityExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+// targets enumerates the Services and Pods of the target namespaces, leaving out the executor
+func (p *NetworkReachabilityExperimentConfig) targets(ctx context.Context, clientset kubernetes.Interface) ([]network.Target, error) {
+	kinds := p.Parameters.Kinds
+	if len(kinds) == 0 {
+		kinds = []string{network.ServiceTarget, network.PodTarget}
+	}
+	for _, kind := range kinds {
+		if kind != network.ServiceTarget && kind != network.PodTarget {
+			return nil, fmt.Errorf("Unknown kind %s, expected service or pod", kind)
+		}
+	}
+	limit := p.Parameters.MaxTargets
+	if limit == 0 {
+		limit = 20
+	}
+	clusterDomain := p.Parameters.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = "cluster.local"
+	}
+
+	namespaces := p.Parameters.TargetNamespaces
+	if len(namespaces) == 0 {
+		list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list namespaces: %w", err)
+		}
+		for _, namespace := range list.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	var targets []network.Target
+	isExecutor := func(namespace string, labels map[string]string, name string) bool {
+		return namespace == p.Metadata.Namespace && (name == p.Metadata.Name || labels["app"] == p.Metadata.Name)
+	}
+	for _, namespace := range namespaces {
+		if slices.Contains(kinds, network.ServiceTarget) {
+			services, err := clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to list Services of namespace %s: %w", namespace, err)
+			}
+			items := slices.DeleteFunc(services.Items, func(s corev1.Service) bool {
+				return isExecutor(s.Namespace, s.Labels, s.Name)
+			})
+			targets = append(targets, network.ServiceTargets(items, clusterDomain, limit)...)
+		}
+		if slices.Contains(kinds, network.PodTarget) {
+			pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to list Pods of namespace %s: %w", namespace, err)
+			}
+			items := slices.DeleteFunc(pods.Items, func(p corev1.Pod) bool {
+				return isExecutor(p.Namespace, p.Labels, p.Name)
+			})
+			targets = append(targets, network.PodTargets(items, limit)...)
+		}
+	}
+	return targets, nil
+}
+
+// expected returns whether a target should be reachable
+func (p *NetworkReachabilityExperimentConfig) expected(target network.Target) bool {
+	reachable := target.Namespace == p.Metadata.Namespace
+	specificity := -1
+	for _, expectation := range p.Parameters.Expected {
+		if expectation.Namespace != target.Namespace ||
+			(expectation.Kind != "" && expectation.Kind != target.Kind) ||
+			(expectation.Name != "" && expectation.Name != target.Name) {
+			continue
+		}
+		s := 0
+		if expectation.Kind != "" {
+			s++
+		}
+		if expectation.Name != "" {
+			s += 2
+		}
+		if s > specificity {
+			reachable, specificity = expectation.Reachable, s
+		}
+	}
+	return reachable
+}
+
+func (p *NetworkReachabilityExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config NetworkReachabilityExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(config.Parameters.Timeout, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	path := config.Parameters.ExecutorConfig.Target.Path
+	if path == "" {
+		path = "/experiment/reachability"
+	}
+	targets, err := config.targets(ctx, client.Clientset)
+	if err != nil {
+		return err
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Deploy(ctx, client.Clientset); err != nil {
+		return err
+	}
+	matrix := ReachabilityMatrix{Source: config.Metadata.Namespace}
+	request := network.ReachabilityRequest{
+		Targets:   targets,
+		Protocols: config.Parameters.Protocols,
+		Timeout:   config.Parameters.RequestTimeout,
+	}
+	if err := postExecutor(ctx, client, executorConfig, path, request, timeout, &matrix.Results); err != nil {
+		return err
+	}
+
+	resultJSON, err := json.Marshal(matrix)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *NetworkReachabilityExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config NetworkReachabilityExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var matrix ReachabilityMatrix
+		if err := json.Unmarshal(rawResult, &matrix); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		config.verify(v, &matrix)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verify adds a check per target, named <namespace>/<kind>/<name>:<port>, whose attack succeeded
+// when the target was reachable, successful when that was expected, and a check per namespace,
+// successful when the reachability of every one of its targets was expected
+func (p *NetworkReachabilityExperimentConfig) verify(v *verifier.LegacyVerifier, matrix *ReachabilityMatrix) {
+	rows := make(map[string]*NamespaceReachability)
+	var namespaces []string
+	for _, result := range matrix.Results {
+		namespace := result.Target.Namespace
+		row, ok := rows[namespace]
+		if !ok {
+			row = &NamespaceReachability{}
+			rows[namespace] = row
+			namespaces = append(namespaces, namespace)
+		}
+		if result.Reachable {
+			row.Reachable++
+		} else {
+			row.Unreachable++
+		}
+
+		check := result.Target.String()
+		expected := p.expected(result.Target)
+		if result.Reachable == expected {
+			v.Success(check)
+		} else {
+			v.Fail(check)
+			row.Unexpected = append(row.Unexpected, check)
+		}
+		v.StoreResultOutputs(check, ReachabilityCheck{Expected: expected, ReachabilityResult: result})
+	}
+
+	for _, namespace := range namespaces {
+		row := rows[namespace]
+		if len(row.Unexpected) == 0 {
+			v.Success(namespace)
+		} else {
+			v.Fail(namespace)
+		}
+		v.StoreResultOutputs(namespace, *row)
+	}
+}
+
+func (p *NetworkReachabilityExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config NetworkReachabilityExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Cleanup(ctx, client.Clientset); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
@@ -0,0 +1,89 @@
+package experiments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/network"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNetworkReachabilityTargets(t *testing.T) {
+	service := func(namespace, name string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.1", Ports: []corev1.ServicePort{{Port: 80}}},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "reachability-5f7d", Namespace: "frontend", Labels: map[string]string{"app": "reachability"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Ports: []corev1.ContainerPort{{ContainerPort: 4000}}}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.244.0.9"},
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "frontend"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}},
+		service("frontend", "reachability"),
+		service("frontend", "web"),
+		service("payments", "api"),
+		pod,
+	)
+
+	p := &NetworkReachabilityExperimentConfig{Metadata: ExperimentMetadata{Name: "reachability", Namespace: "frontend"}}
+	targets, err := p.targets(context.Background(), clientset)
+	require.NoError(t, err)
+	var names []string
+	for _, target := range targets {
+		names = append(names, target.String())
+	}
+	// The executor is left out
+	assert.ElementsMatch(t, []string{"frontend/service/web:80", "payments/service/api:80"}, names)
+
+	p.Parameters.Kinds = []string{"ingress"}
+	_, err = p.targets(context.Background(), clientset)
+	assert.EqualError(t, err, "Unknown kind ingress, expected service or pod")
+}
+
+func TestNetworkReachabilityVerify(t *testing.T) {
+	p := &NetworkReachabilityExperimentConfig{
+		Metadata: ExperimentMetadata{Name: "reachability", Namespace: "frontend"},
+		Parameters: NetworkReachability{Expected: []ReachabilityExpectation{
+			{Namespace: "payments", Reachable: false},
+			{Namespace: "payments", Kind: network.ServiceTarget, Name: "api", Reachable: true},
+		}},
+	}
+	target := func(namespace, kind, name string) network.Target {
+		return network.Target{Namespace: namespace, Kind: kind, Name: name, Port: 80}
+	}
+	matrix := &ReachabilityMatrix{Source: "frontend", Results: []network.ReachabilityResult{
+		{Target: target("frontend", network.ServiceTarget, "web"), Reachable: true},
+		{Target: target("payments", network.ServiceTarget, "api"), Reachable: true},
+		{Target: target("payments", network.PodTarget, "api-0"), Reachable: true},
+		{Target: target("payments", network.ServiceTarget, "db"), Reachable: false},
+		{Target: target("monitoring", network.ServiceTarget, "prometheus"), Reachable: false},
+	}}
+
+	v := verifier.NewLegacy("reachability", "", "", "", "")
+	p.verify(v, matrix)
+	outcome := v.GetOutcome()
+	assert.Equal(t, map[string]string{
+		"frontend/service/web:80":          verifier.Success,
+		"payments/service/api:80":          verifier.Success,
+		"payments/pod/api-0:80":            verifier.Fail,
+		"payments/service/db:80":           verifier.Success,
+		"monitoring/service/prometheus:80": verifier.Success,
+		"frontend":                         verifier.Success,
+		"payments":                         verifier.Fail,
+		"monitoring":                       verifier.Success,
+	}, outcome.Result)
+	assert.Equal(t, []interface{}{NamespaceReachability{
+		Reachable:   2,
+		Unreachable: 1,
+		Unexpected:  []string{"payments/pod/api-0:80"},
+	}}, outcome.ResultOutputs["payments"])
+}
@@ -0,0 +1,465 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// Levels of the Pod Security Standards
+const (
+	PodSecurityBaseline   = "baseline"
+	PodSecurityRestricted = "restricted"
+)
+
+// PodSecurityStandardsExperimentConfig submits a pod per control of the Kubernetes Pod Security
+// Standards, each violating only that control, and checks that the namespace enforces it
+type PodSecurityStandardsExperimentConfig struct {
+	Metadata   ExperimentMetadata   `yaml:"metadata"`
+	Parameters PodSecurityStandards `yaml:"parameters"`
+}
+
+type PodSecurityStandards struct {
+	// Level is the highest level to check, baseline or restricted, the default. The restricted
+	// level includes the controls of the baseline level.
+	Level string `yaml:"level"`
+	// Controls limits the check to the named controls, every control of the level by default
+	Controls []string `yaml:"controls"`
+	// Image of the pods, alpine:latest by default
+	Image string `yaml:"image"`
+	// Expect is what is expected of the violating pods, prevented by default to prove the
+	// namespace enforces the controls, or succeeded to be admitted
+	Expect string `yaml:"expect"`
+}
+
+type PodSecurityResult struct {
+	Controls []PodSecurityControlResult `json:"controls"`
+}
+
+type PodSecurityControlResult struct {
+	Control   string `json:"control"`
+	Level     string `json:"level"`
+	Tactic    string `json:"tactic"`
+	Technique string `json:"technique"`
+	Admitted  bool   `json:"admitted"`
+	// Mutated is set when the pod was admitted but no longer violates the control, e.g. because a
+	// mutating policy fixed it
+	Mutated bool `json:"mutated,omitempty"`
+	// Message is the reason admission denied the pod
+	Message string `json:"message,omitempty"`
+}
+
+// Enforced reports whether the namespace prevents the violation of the control
+func (r *PodSecurityControlResult) Enforced() bool {
+	return !r.Admitted || r.Mutated
+}
+
+// podSecurityControl is a control of the Pod Security Standards
+type podSecurityControl struct {
+	name      string
+	level     string
+	tactic    string
+	technique string
+	// violate changes a pod compliant with the restricted level so that it violates the control
+	violate func(pod *corev1.Pod)
+	// violates reports whether a pod still violates the control once admitted
+	violates func(pod *corev1.Pod) bool
+}
+
+// podSecurityControls lists the controls of https://kubernetes.io/docs/concepts/security/pod-security-standards/
+// in the order they are checked
+var podSecurityControls = func() []podSecurityControl {
+	privileged := categories.MITRE.PrivilegeEscalation.PrivilegedContainer
+	hostPath := categories.MITRE.PrivilegeEscalation.HostPathMount
+	exposed := categories.MITRE.InitialAccess.ExposedSensitiveInterfaces
+	control := func(name, level, tactic, technique string, violate func(*corev1.Pod), violates func(*corev1.Pod) bool) podSecurityControl {
+		return podSecurityControl{name: name, level: level, tactic: tactic, technique: technique, violate: violate, violates: violates}
+	}
+
+	return []podSecurityControl{
+		// Host process containers need the host network, so this pod violates host-network too
+		control("host-process", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				pod.Spec.HostNetwork = true
+				pod.Spec.SecurityContext.WindowsOptions = &corev1.WindowsSecurityContextOptions{HostProcess: pointer.Bool(true)}
+			},
+			func(pod *corev1.Pod) bool {
+				options := podSecurityContext(pod).WindowsOptions
+				return options != nil && options.HostProcess != nil && *options.HostProcess
+			}),
+		control("host-network", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) { pod.Spec.HostNetwork = true },
+			func(pod *corev1.Pod) bool { return pod.Spec.HostNetwork }),
+		control("host-pid", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) { pod.Spec.HostPID = true },
+			func(pod *corev1.Pod) bool { return pod.Spec.HostPID }),
+		control("host-ipc", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) { pod.Spec.HostIPC = true },
+			func(pod *corev1.Pod) bool { return pod.Spec.HostIPC }),
+		// Privileged containers cannot disallow privilege escalation, so this pod violates
+		// privilege-escalation too
+		control("privileged", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				securityContext := pod.Spec.Containers[0].SecurityContext
+				securityContext.Privileged = pointer.Bool(true)
+				securityContext.AllowPrivilegeEscalation = nil
+			},
+			func(pod *corev1.Pod) bool {
+				privileged := containerSecurityContext(pod).Privileged
+				return privileged != nil && *privileged
+			}),
+		control("capabilities", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].SecurityContext.Capabilities.Add = []corev1.Capability{"SYS_PTRACE"}
+			},
+			func(pod *corev1.Pod) bool {
+				capabilities := containerSecurityContext(pod).Capabilities
+				return capabilities != nil && slices.Contains(capabilities.Add, "SYS_PTRACE")
+			}),
+		control("host-path-volumes", PodSecurityBaseline, hostPath.Tactic, hostPath.Technique,
+			func(pod *corev1.Pod) {
+				addVolume(pod, corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/"}})
+			},
+			func(pod *corev1.Pod) bool {
+				return slices.ContainsFunc(pod.Spec.Volumes, func(v corev1.Volume) bool { return v.HostPath != nil })
+			}),
+		control("host-ports", PodSecurityBaseline, exposed.Tactic, exposed.Technique,
+			func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].Ports = []corev1.ContainerPort{{ContainerPort: 8080, HostPort: 8080}}
+			},
+			func(pod *corev1.Pod) bool {
+				return slices.ContainsFunc(pod.Spec.Containers[0].Ports, func(p corev1.ContainerPort) bool { return p.HostPort != 0 })
+			}),
+		control("apparmor", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				pod.Annotations = map[string]string{appArmorAnnotation(pod): "unconfined"}
+			},
+			func(pod *corev1.Pod) bool { return pod.Annotations[appArmorAnnotation(pod)] == "unconfined" }),
+		control("selinux", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				pod.Spec.SecurityContext.SELinuxOptions = &corev1.SELinuxOptions{Type: "spc_t"}
+			},
+			func(pod *corev1.Pod) bool {
+				options := podSecurityContext(pod).SELinuxOptions
+				return options != nil && options.Type == "spc_t"
+			}),
+		control("proc-mount", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				procMount := corev1.UnmaskedProcMount
+				pod.Spec.Containers[0].SecurityContext.ProcMount = &procMount
+			},
+			func(pod *corev1.Pod) bool {
+				procMount := containerSecurityContext(pod).ProcMount
+				return procMount != nil && *procMount == corev1.UnmaskedProcMount
+			}),
+		control("seccomp", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				pod.Spec.SecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}
+			},
+			func(pod *corev1.Pod) bool {
+				profile := podSecurityContext(pod).SeccompProfile
+				return profile != nil && profile.Type == corev1.SeccompProfileTypeUnconfined
+			}),
+		control("sysctls", PodSecurityBaseline, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				pod.Spec.SecurityContext.Sysctls = []corev1.Sysctl{{Name: "kernel.msgmax", Value: "65536"}}
+			},
+			func(pod *corev1.Pod) bool { return len(podSecurityContext(pod).Sysctls) > 0 }),
+		control("volume-types", PodSecurityRestricted, hostPath.Tactic, hostPath.Technique,
+			func(pod *corev1.Pod) {
+				addVolume(pod, corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "127.0.0.1", Path: "/"}})
+			},
+			func(pod *corev1.Pod) bool {
+				return slices.ContainsFunc(pod.Spec.Volumes, func(v corev1.Volume) bool { return v.NFS != nil })
+			}),
+		control("privilege-escalation", PodSecurityRestricted, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].SecurityContext.AllowPrivilegeEscalation = pointer.Bool(true)
+			},
+			func(pod *corev1.Pod) bool {
+				allow := containerSecurityContext(pod).AllowPrivilegeEscalation
+				return allow == nil || *allow
+			}),
+		control("run-as-non-root", PodSecurityRestricted, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) { pod.Spec.SecurityContext.RunAsNonRoot = nil },
+			func(pod *corev1.Pod) bool {
+				podNonRoot := podSecurityContext(pod).RunAsNonRoot
+				containerNonRoot := containerSecurityContext(pod).RunAsNonRoot
+				return (podNonRoot == nil || !*podNonRoot) && (containerNonRoot == nil || !*containerNonRoot)
+			}),
+		control("run-as-user", PodSecurityRestricted, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) { pod.Spec.SecurityContext.RunAsUser = pointer.Int64(0) },
+			func(pod *corev1.Pod) bool {
+				podUser := podSecurityContext(pod).RunAsUser
+				containerUser := containerSecurityContext(pod).RunAsUser
+				return (podUser != nil && *podUser == 0) || (containerUser != nil && *containerUser == 0)
+			}),
+		control("seccomp-restricted", PodSecurityRestricted, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) { pod.Spec.SecurityContext.SeccompProfile = nil },
+			func(pod *corev1.Pod) bool {
+				return podSecurityContext(pod).SeccompProfile == nil && containerSecurityContext(pod).SeccompProfile == nil
+			}),
+		control("capabilities-restricted", PodSecurityRestricted, privileged.Tactic, privileged.Technique,
+			func(pod *corev1.Pod) { pod.Spec.Containers[0].SecurityContext.Capabilities.Drop = nil },
+			func(pod *corev1.Pod) bool {
+				capabilities := containerSecurityContext(pod).Capabilities
+				return capabilities == nil || !slices.Contains(capabilities.Drop, "ALL")
+			}),
+	}
+}()
+
+// podSecurityContext returns the security context of a control pod, which admission may have
+// removed
+func podSecurityContext(pod *corev1.Pod) *corev1.PodSecurityContext {
+	if pod.Spec.SecurityContext == nil {
+		return &corev1.PodSecurityContext{}
+	}
+	return pod.Spec.SecurityContext
+}
+
+// containerSecurityContext returns the security context of the container of a control pod, which
+// admission may have removed
+func containerSecurityContext(pod *corev1.Pod) *corev1.SecurityContext {
+	if len(pod.Spec.Containers) == 0 || pod.Spec.Containers[0].SecurityContext == nil {
+		return &corev1.SecurityContext{}
+	}
+	return pod.Spec.Containers[0].SecurityContext
+}
+
+// appArmorAnnotation returns the annotation setting the AppArmor profile of the container of a
+// control pod
+func appArmorAnnotation(pod *corev1.Pod) string {
+	return "container.apparmor.security.beta.kubernetes.io/" + pod.Spec.Containers[0].Name
+}
+
+// addVolume mounts a volume into the container of a control pod
+func addVolume(pod *corev1.Pod, source corev1.VolumeSource) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{Name: "control", VolumeSource: source})
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "control", MountPath: "/control"})
+}
+
+func (p *PodSecurityStandardsExperimentConfig) Type() string {
+	return "pod-security-standards"
+}
+
+func (p *PodSecurityStandardsExperimentConfig) Description() string {
+	return "Check that a namespace enforces every control of the Pod Security Standards"
+}
+
+func (p *PodSecurityStandardsExperimentConfig) Technique() string {
+	return categories.MITRE.PrivilegeEscalation.PrivilegedContainer.Technique
+}
+
+func (p *PodSecurityStandardsExperimentConfig) Tactic() string {
+	return categories.MITRE.PrivilegeEscalation.PrivilegedContainer.Tactic
+}
+
+func (p *PodSecurityStandardsExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+// SupportsDryRun is always true, the pods of the controls are only ever submitted with
+// server-side dry-run
+func (p *PodSecurityStandardsExperimentConfig) SupportsDryRun() bool {
+	return true
+}
+
+// controls returns the controls to check
+func (p *PodSecurityStandardsExperimentConfig) controls() ([]podSecurityControl, error) {
+	level := p.Parameters.Level
+	switch level {
+	case "":
+		level = PodSecurityRestricted
+	case PodSecurityBaseline, PodSecurityRestricted:
+	default:
+		return nil, fmt.Errorf("Invalid level %s, expected %s or %s", level, PodSecurityBaseline, PodSecurityRestricted)
+	}
+
+	var controls []podSecurityControl
+	var names []string
+	for _, control := range podSecurityControls {
+		if level == PodSecurityBaseline && control.level == PodSecurityRestricted {
+			continue
+		}
+		names = append(names, control.name)
+		if len(p.Parameters.Controls) == 0 || slices.Contains(p.Parameters.Controls, control.name) {
+			controls = append(controls, control)
+		}
+	}
+	for _, name := range p.Parameters.Controls {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("Unknown control %s of level %s, expected one of %s", name, level, strings.Join(names, ", "))
+		}
+	}
+	return controls, nil
+}
+
+// compliantPod returns a pod compliant with the restricted level
+func (p *PodSecurityStandardsExperimentConfig) compliantPod(name string) *corev1.Pod {
+	image := p.Parameters.Image
+	if image == "" {
+		image = "alpine:latest"
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: p.Metadata.Namespace,
+			Labels: map[string]string{
+				experimentLabel: p.Metadata.Name,
+			},
+		},
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   pointer.Bool(true),
+				RunAsUser:      pointer.Int64(65534),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "control",
+					Image:   image,
+					Command: []string{"sleep", "infinity"},
+					SecurityContext: &corev1.SecurityContext{
+						AllowPrivilegeEscalation: pointer.Bool(false),
+						Capabilities: &corev1.Capabilities{
+							Drop: []corev1.Capability{"ALL"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// submit submits a compliant pod, then a pod per control with server-side dry-run. A denied
+// compliant pod fails the experiment, as the controls could not be told apart.
+func (p *PodSecurityStandardsExperimentConfig) submit(ctx context.Context, clientset kubernetes.Interface) (*PodSecurityResult, error) {
+	controls, err := p.controls()
+	if err != nil {
+		return nil, err
+	}
+	pods := clientset.CoreV1().Pods(p.Metadata.Namespace)
+	options := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+
+	if _, err := pods.Create(ctx, p.compliantPod(p.Metadata.Name), options); err != nil {
+		return nil, fmt.Errorf("Failed to submit a pod compliant with the %s level: %w", PodSecurityRestricted, err)
+	}
+
+	result := &PodSecurityResult{}
+	for _, control := range controls {
+		pod := p.compliantPod(fmt.Sprintf("%s-%s", p.Metadata.Name, control.name))
+		control.violate(pod)
+		controlResult := PodSecurityControlResult{
+			Control:   control.name,
+			Level:     control.level,
+			Tactic:    control.tactic,
+			Technique: control.technique,
+		}
+		admitted, err := pods.Create(ctx, pod, options)
+		switch {
+		case err == nil:
+			controlResult.Admitted = true
+			controlResult.Mutated = !control.violates(admitted)
+		case isAdmissionDenial(err):
+			controlResult.Message = err.Error()
+		default:
+			return nil, fmt.Errorf("Failed to submit the pod of control %s: %w", control.name, err)
+		}
+		result.Controls = append(result.Controls, controlResult)
+	}
+	return result, nil
+}
+
+func (p *PodSecurityStandardsExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config PodSecurityStandardsExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	if _, err := parseExpect(config.Parameters.Expect, ExpectPrevented); err != nil {
+		return err
+	}
+
+	result, err := config.submit(ctx, client.Clientset)
+	if err != nil {
+		return err
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *PodSecurityStandardsExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config PodSecurityStandardsExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectPrevented)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var result PodSecurityResult
+		if err := json.Unmarshal(rawResult, &result); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		verifyPodSecurity(v, &result, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verifyPodSecurity adds a check per control. The attack of a check succeeded when the namespace
+// admitted the pod violating the control, the check is successful when that was expected: by
+// default when the control is enforced.
+func verifyPodSecurity(v *verifier.LegacyVerifier, result *PodSecurityResult, expectSucceeded bool) {
+	for _, control := range result.Controls {
+		check := fmt.Sprintf("%s/%s", control.Level, control.Control)
+		checkAttack(v, check, !control.Enforced(), expectSucceeded)
+		v.StoreResultOutputs(check, control)
+	}
+}
+
+// Cleanup only removes the results, the pods were never persisted
+func (p *PodSecurityStandardsExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
@@ -0,0 +1,147 @@
+package experiments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPodSecurityControls(t *testing.T) {
+	p := &PodSecurityStandardsExperimentConfig{Metadata: ExperimentMetadata{Name: "pss", Namespace: "default"}}
+	compliant := p.compliantPod("compliant")
+	for _, control := range podSecurityControls {
+		t.Run(control.name, func(t *testing.T) {
+			assert.False(t, control.violates(compliant), "compliant pod violates %s", control.name)
+			pod := p.compliantPod(control.name)
+			control.violate(pod)
+			assert.True(t, control.violates(pod))
+		})
+	}
+}
+
+// newTestPolicyClientset returns a clientset denying host PID pods, and removing the host ports
+// of the pods it admits
+func newTestPolicyClientset(denyCompliant bool) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod).DeepCopy()
+		if pod.Spec.HostPID || denyCompliant {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("pods"), pod.Name, assert.AnError)
+		}
+		for i := range pod.Spec.Containers {
+			for j := range pod.Spec.Containers[i].Ports {
+				pod.Spec.Containers[i].Ports[j].HostPort = 0
+			}
+		}
+		return true, pod, nil
+	})
+	return clientset
+}
+
+func TestPodSecurityStandardsExperiment(t *testing.T) {
+	tests := []struct {
+		name          string
+		parameters    PodSecurityStandards
+		denyCompliant bool
+		expected      map[string]string
+		err           string
+	}{
+		{
+			name:       "Selected controls",
+			parameters: PodSecurityStandards{Controls: []string{"host-pid", "host-ports", "privileged", "run-as-user"}},
+			expected: map[string]string{
+				"baseline/host-pid":      verifier.Success,
+				"baseline/host-ports":    verifier.Success,
+				"baseline/privileged":    verifier.Fail,
+				"restricted/run-as-user": verifier.Fail,
+			},
+		},
+		{
+			name:       "Violations expected to be admitted",
+			parameters: PodSecurityStandards{Controls: []string{"host-pid", "host-ports", "privileged", "run-as-user"}, Expect: ExpectSucceeded},
+			expected: map[string]string{
+				"baseline/host-pid":      verifier.Fail,
+				"baseline/host-ports":    verifier.Fail,
+				"baseline/privileged":    verifier.Success,
+				"restricted/run-as-user": verifier.Success,
+			},
+		},
+		{
+			name:       "Restricted controls are not part of the baseline level",
+			parameters: PodSecurityStandards{Level: PodSecurityBaseline, Controls: []string{"run-as-user"}},
+			err:        "Unknown control run-as-user of level baseline",
+		},
+		{
+			name:       "Invalid level",
+			parameters: PodSecurityStandards{Level: "privileged"},
+			err:        "Invalid level privileged, expected baseline or restricted",
+		},
+		{
+			name:          "Compliant pod denied",
+			denyCompliant: true,
+			err:           "Failed to submit a pod compliant with the restricted level",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &PodSecurityStandardsExperimentConfig{
+				Metadata:   ExperimentMetadata{Name: "pss", Namespace: "default"},
+				Parameters: test.parameters,
+			}
+			result, err := p.submit(context.Background(), newTestPolicyClientset(test.denyCompliant))
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+
+			expectSucceeded, err := parseExpect(test.parameters.Expect, ExpectPrevented)
+			require.NoError(t, err)
+			v := verifier.NewLegacy("pss", "", "", "", "")
+			verifyPodSecurity(v, result, expectSucceeded)
+			outcome := v.GetOutcome()
+			assert.Equal(t, test.expected, outcome.Result)
+			assert.Equal(t, []interface{}{PodSecurityControlResult{
+				Control:   "host-ports",
+				Level:     PodSecurityBaseline,
+				Tactic:    "Initial Access",
+				Technique: "Exposed Sensitive Interfaces",
+				Admitted:  true,
+				Mutated:   true,
+			}}, outcome.ResultOutputs["baseline/host-ports"])
+		})
+	}
+
+	p := &PodSecurityStandardsExperimentConfig{Metadata: ExperimentMetadata{Name: "pss", Namespace: "default"}}
+	controls, err := p.controls()
+	require.NoError(t, err)
+	assert.Len(t, controls, len(podSecurityControls))
+}
+
+func TestPodSecurityStandardsWithoutAdmission(t *testing.T) {
+	// Without Pod Security Admission or a policy engine, every violating pod is admitted
+	p := &PodSecurityStandardsExperimentConfig{Metadata: ExperimentMetadata{Name: "pss", Namespace: "default"}}
+	result, err := p.submit(context.Background(), fake.NewSimpleClientset())
+	require.NoError(t, err)
+	require.Len(t, result.Controls, len(podSecurityControls))
+
+	expectSucceeded, err := parseExpect(p.Parameters.Expect, ExpectPrevented)
+	require.NoError(t, err)
+	v := verifier.NewLegacy("pss", "", "", "", "")
+	verifyPodSecurity(v, result, expectSucceeded)
+	outcome := v.GetOutcome()
+	require.Len(t, outcome.Result, len(podSecurityControls))
+	for check, result := range outcome.Result {
+		assert.Equal(t, verifier.Fail, result, check)
+	}
+}
@@ -60,6 +60,10 @@ func (p *PrivilegedContainerExperimentConfig) Framework() string {
 	return string(categories.Mitre)
 }
 
+func (p *PrivilegedContainerExperimentConfig) SupportsDryRun() bool {
+	return true
+}
+
 func (p *PrivilegedContainerExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
 	client, err := k8s.NewClient()
 	if err != nil {
@@ -134,10 +138,17 @@ func (p *PrivilegedContainerExperimentConfig) Run(ctx context.Context, experimen
 	container.SecurityContext = securityContext
 	deployment.Spec.Template.Spec.Containers[0] = container
 
-	_, err = clientset.AppsV1().Deployments(config.Metadata.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
-	return err
+	admission := newAdmission(experimentConfig)
+	if err := admission.createDeployment(ctx, clientset, config.Metadata.Namespace, deployment); err != nil {
+		return err
+	}
+	return admission.store(ctx, experimentConfig)
 }
 
+// Verify adds the Deployed check when verifier.deployed is set, whose attack succeeded when the
+// Deployment runs with the requested privileges, and the Command check when verifier.command is
+// set, whose attack succeeded when the command ran in every pod. The checks are successful when
+// their attack succeeded.
 func (p *PrivilegedContainerExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
 	client, err := k8s.NewClient()
 	if err != nil {
@@ -150,13 +161,6 @@ func (p *PrivilegedContainerExperimentConfig) Verify(ctx context.Context, experi
 		return nil, err
 	}
 
-	clientset := client.Clientset
-	deployment, err := clientset.AppsV1().Deployments(config.Metadata.Namespace).Get(ctx, config.Metadata.Name, metav1.GetOptions{})
-	if err != nil {
-		return nil, err
-	}
-	params := config.Parameters
-
 	v := verifier.NewLegacy(
 		config.Metadata.Name,
 		config.Description(),
@@ -165,6 +169,22 @@ func (p *PrivilegedContainerExperimentConfig) Verify(ctx context.Context, experi
 		config.Technique(),
 	)
 
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return nil, err
+	}
+	if admission != nil {
+		admission.verify(v, true)
+		return v.GetOutcome(), nil
+	}
+
+	clientset := client.Clientset
+	deployment, err := clientset.AppsV1().Deployments(config.Metadata.Namespace).Get(ctx, config.Metadata.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	params := config.Parameters
+
 	// Find the container by name, as it may not be the first container in the list due to sidecar injection
 	container, err := client.FindContainerByName(deployment.Spec.Template.Spec.Containers, config.Metadata.Name)
 	if err != nil {
@@ -234,6 +254,14 @@ func (p *PrivilegedContainerExperimentConfig) Cleanup(ctx context.Context, exper
 	if err != nil {
 		return err
 	}
+	// Nothing was created in dry-run mode
+	admission, err := getAdmissionResult(ctx, experimentConfig)
+	if err != nil {
+		return err
+	}
+	if admission != nil {
+		return removeResultsForExperiment(ctx, experimentConfig)
+	}
 	clientset := client.Clientset
 	return clientset.AppsV1().Deployments(config.Metadata.Namespace).Delete(ctx, config.Metadata.Name, metav1.DeleteOptions{})
 }
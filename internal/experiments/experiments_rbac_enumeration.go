@@ -0,0 +1,183 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/executor"
+	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/rbac"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// RBACEnumerationExperimentConfig deploys the executor with a service account, which reviews and
+// attempts sensitive permissions with the token mounted in its pod
+type RBACEnumerationExperimentConfig struct {
+	Metadata   ExperimentMetadata `yaml:"metadata"`
+	Parameters RBACEnumeration    `yaml:"parameters"`
+}
+
+type RBACEnumeration struct {
+	// ExecutorConfig sets the service account whose token is abused, default by default
+	ExecutorConfig executor.RemoteExecuteAPI `yaml:"executorConfig"`
+	// Namespaces to sweep, the namespace of the experiment by default
+	Namespaces []string `yaml:"namespaces"`
+	// Permissions limits the sweep to the named permissions, all of them by default
+	Permissions []string `yaml:"permissions"`
+	// Timeout bounds how long to wait for the executor and its sweep, 2m by default
+	Timeout string `yaml:"timeout"`
+	// Expect is what is expected of the attempts, succeeded by default or prevented to prove the
+	// service account is not over-privileged
+	Expect string `yaml:"expect"`
+}
+
+func (p *RBACEnumerationExperimentConfig) Type() string {
+	return "rbac-enumeration"
+}
+
+func (p *RBACEnumerationExperimentConfig) Description() string {
+	return "Enumerate and attempt sensitive RBAC permissions with the token of a service account"
+}
+
+func (p *RBACEnumerationExperimentConfig) Technique() string {
+	return categories.MITRE.Credentials.AccessContainerServiceAccount.Technique
+}
+
+func (p *RBACEnumerationExperimentConfig) Tactic() string {
+	return categories.MITRE.Credentials.AccessContainerServiceAccount.Tactic
+}
+
+func (p *RBACEnumerationExperimentConfig) Framework() string {
+	return string(categories.Mitre)
+}
+
+func (p *RBACEnumerationExperimentConfig) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config RBACEnumerationExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(config.Parameters.Timeout, 2*time.Minute)
+	if err != nil {
+		return err
+	}
+	if _, err := parseExpect(config.Parameters.Expect, ExpectSucceeded); err != nil {
+		return err
+	}
+	path := config.Parameters.ExecutorConfig.Target.Path
+	if path == "" {
+		path = "/experiment/rbac"
+	}
+	query := url.Values{"permission": config.Parameters.Permissions}
+	query["namespace"] = config.Parameters.Namespaces
+	if len(config.Parameters.Namespaces) == 0 {
+		query.Set("namespace", config.Metadata.Namespace)
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Deploy(ctx, client.Clientset); err != nil {
+		return err
+	}
+	var matrix rbac.Matrix
+	if err := queryExecutor(ctx, client, executorConfig, path, query, timeout, &matrix); err != nil {
+		return err
+	}
+
+	resultJSON, err := json.Marshal(matrix)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal experiment results: %w", err)
+	}
+	if err := storeResult(ctx, experimentConfig, resultJSON); err != nil {
+		return fmt.Errorf("Failed to write experiment results: %w", err)
+	}
+	return nil
+}
+
+func (p *RBACEnumerationExperimentConfig) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	var config RBACEnumerationExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err := yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return nil, err
+	}
+	expectSucceeded, err := parseExpect(config.Parameters.Expect, ExpectSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	v := verifier.NewLegacy(
+		config.Metadata.Name,
+		config.Description(),
+		config.Framework(),
+		config.Tactic(),
+		config.Technique(),
+	)
+
+	rawResults, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch experiment results: %w", err)
+	}
+	for _, rawResult := range rawResults {
+		var matrix rbac.Matrix
+		if err := json.Unmarshal(rawResult, &matrix); err != nil {
+			return nil, fmt.Errorf("Could not parse experiment result: %w", err)
+		}
+		verifyRBACMatrix(v, &matrix, expectSucceeded)
+	}
+	return v.GetOutcome(), nil
+}
+
+// verifyRBACMatrix adds a check per permission, named <namespace>/<permission> or
+// cluster/<permission>, whose attack succeeded when the attempt was authorized, and a check per
+// namespace named <namespace>/wildcard-rules, whose attack succeeded when a rule grants every verb
+// or resource. A check is successful when that was expected.
+func verifyRBACMatrix(v *verifier.LegacyVerifier, matrix *rbac.Matrix, expectSucceeded bool) {
+	check := func(name string, result rbac.Result) {
+		checkAttack(v, name, result.Succeeded, expectSucceeded)
+		v.StoreResultOutputs(name, result)
+	}
+	for _, namespace := range matrix.Namespaces {
+		wildcard := namespace.Namespace + "/wildcard-rules"
+		checkAttack(v, wildcard, namespace.Wildcard, expectSucceeded)
+		v.StoreResultOutputs(wildcard, namespace.Rules)
+		for _, result := range namespace.Results {
+			check(namespace.Namespace+"/"+result.Permission, result)
+		}
+	}
+	for _, result := range matrix.Cluster {
+		check("cluster/"+result.Permission, result)
+	}
+}
+
+func (p *RBACEnumerationExperimentConfig) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	client, err := k8s.NewClient()
+	if err != nil {
+		return err
+	}
+	var config RBACEnumerationExperimentConfig
+	yamlObj, _ := yaml.Marshal(experimentConfig)
+	err = yaml.Unmarshal(yamlObj, &config)
+	if err != nil {
+		return err
+	}
+
+	executorConfig := newExecutor(config.Metadata, config.Parameters.ExecutorConfig)
+	if err := executorConfig.Cleanup(ctx, client.Clientset); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
@@ -0,0 +1,46 @@
+package experiments
+
+import (
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/rbac"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyRBACMatrix(t *testing.T) {
+	matrix := &rbac.Matrix{
+		Namespaces: []rbac.NamespaceResult{
+			{
+				Namespace: "default",
+				Rules:     []string{"* on pods"},
+				Wildcard:  true,
+				Results: []rbac.Result{
+					{Permission: "create-pods", Allowed: true, Succeeded: true},
+					{Permission: "bind", Message: "rolebindings is forbidden"},
+				},
+			},
+		},
+		Cluster: []rbac.Result{{Permission: "patch-nodes", Allowed: true, Succeeded: true}},
+	}
+
+	v := verifier.NewLegacy("rbac", "", "", "", "")
+	verifyRBACMatrix(v, matrix, true)
+	outcome := v.GetOutcome()
+	assert.Equal(t, map[string]string{
+		"default/wildcard-rules": verifier.Success,
+		"default/create-pods":    verifier.Success,
+		"default/bind":           verifier.Fail,
+		"cluster/patch-nodes":    verifier.Success,
+	}, outcome.Result)
+	assert.Equal(t, []interface{}{[]string{"* on pods"}}, outcome.ResultOutputs["default/wildcard-rules"])
+
+	v = verifier.NewLegacy("rbac", "", "", "", "")
+	verifyRBACMatrix(v, matrix, false)
+	assert.Equal(t, map[string]string{
+		"default/wildcard-rules": verifier.Fail,
+		"default/create-pods":    verifier.Fail,
+		"default/bind":           verifier.Success,
+		"cluster/patch-nodes":    verifier.Fail,
+	}, v.GetOutcome().Result)
+}
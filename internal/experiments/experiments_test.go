@@ -0,0 +1,354 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/results"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRunner(n, parallelism int) *Runner {
+	configs := make(map[string]*ExperimentConfig)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("experiment-%d", i)
+		configs[name] = &ExperimentConfig{Metadata: ExperimentMetadata{Name: name}}
+	}
+	return newTestRunnerWithConfigs(configs, parallelism)
+}
+
+func newTestRunnerWithConfigs(configs map[string]*ExperimentConfig, parallelism int) *Runner {
+	order, err := orderExperiments(configs)
+	if err != nil {
+		panic(err)
+	}
+	return &Runner{
+		ctx:               context.Background(),
+		experimentsConfig: configs,
+		parallelism:       parallelism,
+		order:             order,
+	}
+}
+
+func TestForEachExperiment(t *testing.T) {
+	tests := []struct {
+		name        string
+		parallelism int
+	}{
+		{name: "Serial", parallelism: 1},
+		{name: "Parallel", parallelism: 3},
+		{name: "Unset parallelism runs serially", parallelism: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRunner(6, test.parallelism)
+			var mu sync.Mutex
+			var running, maxRunning int
+			var visited []string
+			err := r.forEachExperiment(false, func(ctx context.Context, e *ExperimentConfig) error {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				visited = append(visited, e.Metadata.Name)
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, visited, 6)
+			assert.LessOrEqual(t, maxRunning, max(test.parallelism, 1))
+		})
+	}
+}
+
+func TestForEachExperimentDependencies(t *testing.T) {
+	// a <- b <- c, d is independent
+	configs := map[string]*ExperimentConfig{
+		"a": {Metadata: ExperimentMetadata{Name: "a"}},
+		"b": {Metadata: ExperimentMetadata{Name: "b", DependsOn: []string{"a"}}},
+		"c": {Metadata: ExperimentMetadata{Name: "c", DependsOn: []string{"b"}}},
+		"d": {Metadata: ExperimentMetadata{Name: "d"}},
+	}
+
+	tests := []struct {
+		name     string
+		reverse  bool
+		failing  string
+		expected []string
+	}{
+		{name: "Dependencies run first", expected: []string{"a", "b", "c", "d"}},
+		{name: "Dependents of a failed experiment are skipped", failing: "a", expected: []string{"a", "d"}},
+		{name: "Dependents are cleaned up first", reverse: true, expected: []string{"c", "b", "a", "d"}},
+		{name: "Cleanup is never skipped", reverse: true, failing: "c", expected: []string{"c", "b", "a", "d"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRunnerWithConfigs(configs, 4)
+			var mu sync.Mutex
+			var visited []string
+			err := r.forEachExperiment(test.reverse, func(ctx context.Context, e *ExperimentConfig) error {
+				mu.Lock()
+				visited = append(visited, e.Metadata.Name)
+				mu.Unlock()
+				if e.Metadata.Name == test.failing {
+					return errors.New("experiment failed")
+				}
+				return nil
+			})
+			if test.failing != "" {
+				assert.EqualError(t, err, "experiment failed")
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.ElementsMatch(t, test.expected, visited)
+			// Check the relative order of the dependency chain
+			var chain []string
+			for _, name := range visited {
+				if name != "d" {
+					chain = append(chain, name)
+				}
+			}
+			var expectedChain []string
+			for _, name := range test.expected {
+				if name != "d" {
+					expectedChain = append(expectedChain, name)
+				}
+			}
+			assert.Equal(t, expectedChain, chain)
+		})
+	}
+}
+
+func TestForEachExperimentFailFast(t *testing.T) {
+	tests := []struct {
+		name          string
+		failFast      bool
+		reverse       bool
+		expectedCalls int32
+	}{
+		{name: "Continue after a failure", failFast: false, expectedCalls: 5},
+		{name: "Stop at the first failure", failFast: true, expectedCalls: 1},
+		{name: "Cleanup does not stop at the first failure", failFast: true, reverse: true, expectedCalls: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRunner(5, 1)
+			r.failFast = test.failFast
+			var calls atomic.Int32
+			err := r.forEachExperiment(test.reverse, func(ctx context.Context, e *ExperimentConfig) error {
+				calls.Add(1)
+				return errors.New("experiment failed")
+			})
+			assert.Error(t, err)
+			assert.Equal(t, test.expectedCalls, calls.Load())
+			// Stopping early is not a cancellation of the Runner
+			assert.NotErrorIs(t, err, context.Canceled)
+		})
+	}
+}
+
+func TestForEachExperimentCancelled(t *testing.T) {
+	r := newTestRunner(10, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.ctx = ctx
+	var calls atomic.Int32
+	err := r.forEachExperiment(false, func(ctx context.Context, e *ExperimentConfig) error {
+		calls.Add(1)
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestLogPrefix(t *testing.T) {
+	e := &ExperimentConfig{Metadata: ExperimentMetadata{Name: "exec"}}
+	assert.Equal(t, "", newTestRunner(0, 1).logPrefix(e))
+	assert.Equal(t, "[exec] ", newTestRunner(0, 4).logPrefix(e))
+}
+
+// fakeExperiment records the calls made by the Runner
+type fakeExperiment struct {
+	mu      sync.Mutex
+	calls   []string
+	result  string
+	onRun   func()
+	cleaned []error
+	// verifyErr is returned by the verifier of the experiments of that name
+	verifyErr map[string]error
+}
+
+func (f *fakeExperiment) Type() string        { return "fake" }
+func (f *fakeExperiment) Description() string { return "Fake experiment" }
+func (f *fakeExperiment) Framework() string   { return "MITRE" }
+func (f *fakeExperiment) Tactic() string      { return "Execution" }
+func (f *fakeExperiment) Technique() string   { return "Fake" }
+
+func (f *fakeExperiment) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeExperiment) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	f.record("run")
+	if f.onRun != nil {
+		f.onRun()
+	}
+	return nil
+}
+
+func (f *fakeExperiment) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	f.record("verify")
+	if err := f.verifyErr[experimentConfig.Metadata.Name]; err != nil {
+		return nil, err
+	}
+	v := verifier.NewLegacy(experimentConfig.Metadata.Name, f.Description(), f.Framework(), f.Tactic(), f.Technique())
+	if f.result == verifier.Success {
+		v.Success("check")
+	} else {
+		v.Fail("check")
+	}
+	return v.GetOutcome(), nil
+}
+
+func (f *fakeExperiment) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	f.record("cleanup")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cleaned = append(f.cleaned, ctx.Err())
+	return nil
+}
+
+func TestRunnerTest(t *testing.T) {
+	tests := []struct {
+		name          string
+		result        string
+		cancel        bool
+		expectedCode  int
+		expectedCalls []string
+	}{
+		{name: "All checks pass", result: verifier.Success, expectedCode: ExitSuccess, expectedCalls: []string{"run", "verify", "cleanup"}},
+		{name: "A check fails", result: verifier.Fail, expectedCode: ExitChecksFailed, expectedCalls: []string{"run", "verify", "cleanup"}},
+		{name: "Interrupted run is cleaned up", result: verifier.Success, cancel: true, expectedCode: ExitInfrastructureError, expectedCalls: []string{"run", "cleanup"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := results.NewLocalStore(t.TempDir())
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			experiment := &fakeExperiment{result: test.result}
+			if test.cancel {
+				experiment.onRun = cancel
+			}
+			r := newTestRunnerWithConfigs(map[string]*ExperimentConfig{
+				"fake": {Metadata: ExperimentMetadata{Name: "fake", Type: "fake", Namespace: "local"}, resultStore: store},
+			}, 1)
+			r.ctx = ctx
+			r.resultStore = store
+			r.experiments = map[string]Experiment{"fake": experiment}
+
+			assert.Equal(t, test.expectedCode, ExitCode(r.Test("json", time.Second)))
+			assert.Equal(t, test.expectedCalls, experiment.calls)
+			// Cleanup must not inherit the cancellation of the run
+			assert.Equal(t, []error{nil}, experiment.cleaned)
+
+			run, err := store.GetRun(context.Background(), r.runID)
+			require.NoError(t, err)
+			assert.False(t, run.FinishedAt.IsZero())
+		})
+	}
+}
+
+func TestRunVerifiersOutputFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		outputFormat string
+		file         string
+		expected     string
+	}{
+		{name: "Format from the file extension", file: "results.json", expected: `"experiment": "fake"`},
+		{name: "Output format takes precedence", outputFormat: "junit", file: "results.txt", expected: `<testsuite name="fake"`},
+		{name: "Table by default", file: "results.txt", expected: "✓ success"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := results.NewLocalStore(dir)
+			require.NoError(t, err)
+			experiment := &fakeExperiment{result: verifier.Success}
+			r := newTestRunnerWithConfigs(map[string]*ExperimentConfig{
+				"fake": {Metadata: ExperimentMetadata{Name: "fake", Type: "fake"}, resultStore: store},
+			}, 1)
+			r.resultStore = store
+			r.experiments = map[string]Experiment{"fake": experiment}
+			r.outputFile = filepath.Join(dir, test.file)
+
+			require.NoError(t, r.RunVerifiers(test.outputFormat))
+			// The summary is computed from the same outcomes, experiments are verified once
+			assert.Equal(t, []string{"verify"}, experiment.calls)
+			b, err := os.ReadFile(r.outputFile)
+			require.NoError(t, err)
+			assert.Contains(t, string(b), test.expected)
+		})
+	}
+}
+
+func TestRunVerifiersUnknownFormat(t *testing.T) {
+	experiment := &fakeExperiment{result: verifier.Success}
+	r := newTestRunner(1, 1)
+	r.experiments = map[string]Experiment{"fake": experiment}
+	assert.Equal(t, ExitConfigError, ExitCode(r.RunVerifiers("pdf")))
+	assert.Empty(t, experiment.calls)
+}
+
+func TestVerifyReportSkippedExperiments(t *testing.T) {
+	store, err := results.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	// b depends on a, whose verifier fails, c is independent
+	configs := map[string]*ExperimentConfig{
+		"a": {Metadata: ExperimentMetadata{Name: "a", Type: "fake"}, resultStore: store},
+		"b": {Metadata: ExperimentMetadata{Name: "b", Type: "fake", DependsOn: []string{"a"}}, resultStore: store},
+		"c": {Metadata: ExperimentMetadata{Name: "c", Type: "fake"}, resultStore: store},
+	}
+	experiment := &fakeExperiment{result: verifier.Success, verifyErr: map[string]error{"a": assert.AnError}}
+	r := newTestRunnerWithConfigs(configs, 1)
+	r.resultStore = store
+	r.experiments = map[string]Experiment{"fake": experiment}
+
+	rep, err := r.verifyReport()
+	assert.ErrorIs(t, err, assert.AnError)
+	require.NotNil(t, rep)
+	var names []string
+	for _, outcome := range rep.Outcomes {
+		names = append(names, outcome.Experiment)
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, names)
+	summary := rep.Summary()
+	assert.Equal(t, 3, summary.Experiments)
+	assert.Equal(t, 2, summary.WithoutResults)
+	assert.Equal(t, 1, summary.Passed)
+	assert.True(t, summary.ChecksFailed())
+}
@@ -4,81 +4,66 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
 	dockerClient "github.com/docker/docker/client"
 	"github.com/operantai/woodpecker/internal/k8s"
+	"github.com/operantai/woodpecker/internal/results"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
-const tmpFileDir = "/tmp/woodpecker"
+// errNoResultStore is returned when an experiment tries to access results without a result store
+var errNoResultStore = errors.New("No result store configured for experiment results")
 
-func createTempFile(experimentType, experiment string) (*os.File, error) {
-	if _, err := os.Stat(tmpFileDir); err != nil {
-		if os.IsNotExist(err) {
-			if err := os.Mkdir(tmpFileDir, 0700); err != nil {
-				return nil, err
-			}
-		}
-	}
-	file, err := os.CreateTemp(tmpFileDir, fmt.Sprintf("%s-%s", experimentType, experiment))
-	if err != nil {
-		return nil, err
+// storeResult persists the result of an experiment run in the result store, keyed by the run ID,
+// experiment type and experiment name
+func storeResult(ctx context.Context, experimentConfig *ExperimentConfig, data []byte) error {
+	if experimentConfig.resultStore == nil {
+		return errNoResultStore
 	}
-	return file, nil
+	return experimentConfig.resultStore.Put(ctx, &results.Result{
+		Key:  experimentConfig.resultKey(),
+		Data: data,
+	})
 }
 
-func getTempFileContentsForExperiment(experimentType, experiment string) ([][]byte, error) {
-	var contents [][]byte
-	files, err := getTempFilesForExperiment(experimentType, experiment)
+// getResultsForExperiment returns the stored results of an experiment, oldest first
+func getResultsForExperiment(ctx context.Context, experimentConfig *ExperimentConfig) ([][]byte, error) {
+	if experimentConfig.resultStore == nil {
+		return nil, errNoResultStore
+	}
+	stored, err := experimentConfig.resultStore.List(ctx, experimentConfig.resultKey())
 	if err != nil {
 		return nil, err
 	}
-	for _, file := range files {
-		content, err := os.ReadFile(file)
-		if err != nil {
-			return nil, err
-		}
-		contents = append(contents, content)
+	var contents [][]byte
+	for _, result := range stored {
+		contents = append(contents, result.Data)
 	}
 	return contents, nil
 }
 
-func getTempFilesForExperiment(experimentType, experiment string) ([]string, error) {
-	d, err := os.Open(tmpFileDir)
-	if err != nil {
-		return nil, err
-	}
-	files, err := d.ReadDir(-1)
-	if err != nil {
-		return nil, err
-	}
-	var fullPaths []string
-	for _, file := range files {
-		if !file.IsDir() && strings.HasPrefix(file.Name(), fmt.Sprintf("%s-%s", experimentType, experiment)) {
-			fullPaths = append(fullPaths, filepath.Join(tmpFileDir, file.Name()))
-		}
+// removeResultsForExperiment removes the stored results of an experiment
+func removeResultsForExperiment(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	if experimentConfig.resultStore == nil {
+		return errNoResultStore
 	}
-	return fullPaths, nil
+	return experimentConfig.resultStore.Delete(ctx, experimentConfig.resultKey())
 }
 
-func removeTempFilesForExperiment(experimentType, experiment string) error {
-	files, err := getTempFilesForExperiment(experimentType, experiment)
-	if err != nil {
-		return err
-	}
-
-	for _, file := range files {
-		if err := os.Remove(file); err != nil {
-			return err
-		}
-
+// impersonate returns a clientset acting as the user, or the clientset of the client when no user
+// is given
+func impersonate(client *k8s.Client, user string) (kubernetes.Interface, error) {
+	if user == "" {
+		return client.Clientset, nil
 	}
-	return nil
+	config := rest.CopyConfig(client.RestConfig)
+	config.Impersonate = rest.ImpersonationConfig{UserName: user}
+	return kubernetes.NewForConfig(config)
 }
 
 const WoodpeckerAI = "woodpecker-ai-verifier"
@@ -5,15 +5,17 @@ package experiments
 
 import (
 	"fmt"
-	"os"
 	"time"
 
+	"github.com/operantai/woodpecker/internal/results"
 	"gopkg.in/yaml.v3"
 )
 
 // ExperimentsConfig is a structure which represents the configuration for a set of experiments
 type ExperimentsConfig struct {
 	ExperimentConfigs []ExperimentConfig `yaml:"experiments"`
+	// Environments patch the experiments by environment name and experiment name
+	Environments map[string]map[string]ExperimentOverlay `yaml:"environments,omitempty"`
 }
 
 // ExperimentConfig is a structure which represents the configuration for an experiment
@@ -22,6 +24,24 @@ type ExperimentConfig struct {
 	Metadata ExperimentMetadata `yaml:"metadata"`
 	// Parameters for the experiment
 	Parameters interface{} `yaml:"parameters"`
+
+	// resultStore persists the results of the experiment, set by the Runner
+	resultStore results.ResultStore
+	// runID identifies the run the results belong to, empty matches every run
+	runID string
+	// dryRun submits the objects of the experiment with server-side dry-run, set by the Runner
+	dryRun bool
+	// untrusted is set for experiments of remote files, which cannot read local files
+	untrusted bool
+}
+
+// resultKey returns the key the experiment results are stored under
+func (e *ExperimentConfig) resultKey() results.Key {
+	return results.Key{
+		RunID:          e.runID,
+		ExperimentType: e.Metadata.Type,
+		Experiment:     e.Metadata.Name,
+	}
 }
 
 // ExperimentMetadata is a structure which represents the metadata required for an experiment
@@ -32,6 +52,12 @@ type ExperimentMetadata struct {
 	Namespace string `yaml:"namespace"`
 	// Type of the experiment
 	Type string `yaml:"type"`
+	// Labels are arbitrary key/value pairs describing the experiment
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Tags are arbitrary values describing the experiment
+	Tags []string `yaml:"tags,omitempty"`
+	// DependsOn lists the names of the experiments that must succeed before this one runs
+	DependsOn []string `yaml:"dependsOn,omitempty"`
 }
 
 type AIAppRequest struct {
@@ -89,27 +115,43 @@ type ExecuteAIAPIResult struct {
 	Response       AIVerifierAPIResponse `json:"response"`
 }
 
-// parseExperimentConfig parses a YAML file and returns a slice of ExperimentConfig
-func parseExperimentConfigs(file string) ([]ExperimentConfig, error) {
-	// Read the file and then unmarshal it into a slice of ExperimentConfig
-	contents, err := os.ReadFile(file)
+// parseSource parses an experiment file and returns a slice of ExperimentConfig. Remote files
+// are untrusted unless the templating trusts them.
+func parseSource(s source, templating Templating) ([]ExperimentConfig, error) {
+	templating.untrusted = s.remote && !templating.TrustRemote
+	configs, err := renderYAML(s.contents, templating)
 	if err != nil {
-		return nil, err
+		return nil, fileError(err, s.name)
 	}
-	configs, err := unmarshalYAML(contents)
-	if err != nil {
-		return nil, err
+	for i := range configs {
+		configs[i].untrusted = templating.untrusted
 	}
 	return configs, nil
 }
 
 func unmarshalYAML(contents []byte) ([]ExperimentConfig, error) {
+	return renderYAML(contents, Templating{})
+}
+
+// renderYAML renders experiments with the templating, then decodes them strictly: unknown
+// fields and values of the wrong type are returned as schema.ValidationErrors with their line,
+// rather than ignored when each experiment decodes its parameters
+func renderYAML(contents []byte, templating Templating) ([]ExperimentConfig, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+	if err := templating.render(&document); err != nil {
+		return nil, err
+	}
 	var config ExperimentsConfig
-	err := yaml.Unmarshal(contents, &config)
-	if err != nil {
+	if err := document.Decode(&config); err != nil {
 		return nil, err
 	}
 
+	if err := validateExperiments(&document); err != nil {
+		return nil, err
+	}
 	for _, experiment := range config.ExperimentConfigs {
 		if experiment.Parameters == nil {
 			return nil, fmt.Errorf("Experiment %s is missing parameters", experiment.Metadata.Name)
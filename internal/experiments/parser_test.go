@@ -37,6 +37,34 @@ experiments:
     type: "privileged_container"
     labels:
       key1: "value1"
+`),
+			expectError: true,
+		},
+		{
+			name: "Invalid Experiment (unknown metadata field)",
+			contents: []byte(`
+experiments:
+- metadata:
+    name: "Experiment 3"
+    namespace: "my-namespace"
+    type: "privileged_container"
+    dependOn: ["Experiment 1"]
+  parameters:
+    hostPid: true
+`),
+			expectError: true,
+		},
+		{
+			name: "Invalid Experiment (unknown parameter)",
+			contents: []byte(`
+experiments:
+- metadata:
+    name: "Experiment 4"
+    namespace: "my-namespace"
+    type: "host-path-mount"
+  parameters:
+    hostPath:
+      pth: /etc
 `),
 			expectError: true,
 		},
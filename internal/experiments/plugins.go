@@ -0,0 +1,263 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/operantai/woodpecker/internal/output"
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/operantai/woodpecker/pkg/experiment"
+)
+
+// PluginExperiment is an experiment implemented by an executable speaking the protocol of
+// pkg/experiment
+type PluginExperiment struct {
+	Metadata ExperimentMetadata `yaml:"metadata"`
+	// Parameters are passed to the executable as is
+	Parameters interface{} `yaml:"parameters"`
+
+	// path of the executable
+	path string
+	info experiment.Info
+}
+
+// Path returns the path of the executable of the experiment
+func (p *PluginExperiment) Path() string {
+	return p.path
+}
+
+func (p *PluginExperiment) Type() string {
+	return p.info.Type
+}
+
+func (p *PluginExperiment) Description() string {
+	return p.info.Description
+}
+
+func (p *PluginExperiment) Framework() string {
+	return p.info.Framework
+}
+
+func (p *PluginExperiment) Tactic() string {
+	return p.info.Tactic
+}
+
+func (p *PluginExperiment) Technique() string {
+	return p.info.Technique
+}
+
+func (p *PluginExperiment) Run(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	resp, err := p.call(ctx, experiment.MethodRun, experimentConfig, nil)
+	if err != nil {
+		return err
+	}
+	for _, result := range resp.Results {
+		if err := storeResult(ctx, experimentConfig, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PluginExperiment) Verify(ctx context.Context, experimentConfig *ExperimentConfig) (*verifier.LegacyOutcome, error) {
+	stored, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.call(ctx, experiment.MethodVerify, experimentConfig, stored)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Outcome == nil {
+		return nil, fmt.Errorf("Plugin %s returned no outcome", p.path)
+	}
+
+	v := verifier.NewLegacy(
+		experimentConfig.Metadata.Name,
+		p.Description(),
+		p.Framework(),
+		p.Tactic(),
+		p.Technique(),
+	)
+	outcome := v.GetOutcome()
+	for check, result := range resp.Outcome.Result {
+		outcome.Result[check] = result
+	}
+	for check, outputs := range resp.Outcome.ResultOutputs {
+		outcome.ResultOutputs[check] = outputs
+	}
+	return outcome, nil
+}
+
+func (p *PluginExperiment) Cleanup(ctx context.Context, experimentConfig *ExperimentConfig) error {
+	stored, err := getResultsForExperiment(ctx, experimentConfig)
+	if err != nil {
+		return err
+	}
+	if _, err := p.call(ctx, experiment.MethodCleanup, experimentConfig, stored); err != nil {
+		return err
+	}
+	return removeResultsForExperiment(ctx, experimentConfig)
+}
+
+// call sends a request for the experiment to the executable and returns its response
+func (p *PluginExperiment) call(ctx context.Context, method string, experimentConfig *ExperimentConfig, results [][]byte) (*experiment.Response, error) {
+	parameters, err := json.Marshal(experimentConfig.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode parameters of experiment %s: %w", experimentConfig.Metadata.Name, err)
+	}
+	config := &experiment.Config{
+		Metadata: experiment.Metadata{
+			Name:      experimentConfig.Metadata.Name,
+			Namespace: experimentConfig.Metadata.Namespace,
+			Type:      experimentConfig.Metadata.Type,
+			Labels:    experimentConfig.Metadata.Labels,
+			Tags:      experimentConfig.Metadata.Tags,
+			DependsOn: experimentConfig.Metadata.DependsOn,
+		},
+		Parameters: parameters,
+		RunID:      experimentConfig.runID,
+	}
+	for _, result := range results {
+		config.Results = append(config.Results, result)
+	}
+	return callPlugin(ctx, p.path, &experiment.Request{Method: method, Config: config})
+}
+
+// callPlugin starts the executable, writes the request to its stdin and reads the response
+// from its stdout. The stderr of the executable is passed through.
+func callPlugin(ctx context.Context, path string, req *experiment.Request) (*experiment.Response, error) {
+	req.Version = experiment.ProtocolVersion
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Plugin %s failed: %w", path, err)
+	}
+
+	var resp experiment.Response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("Plugin %s returned an invalid response: %w", path, err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// experimentTypes resolves the types of experiment files to the registered experiments, then to
+// the experiments of plugin executables. Plugins are only started once a type is not registered,
+// and are never added to the ExperimentsRegistry.
+type experimentTypes struct {
+	experiments   map[string]Experiment
+	pluginsLoaded bool
+	pluginsErr    error
+}
+
+func newExperimentTypes() *experimentTypes {
+	experiments := make(map[string]Experiment)
+	for _, e := range ExperimentsRegistry {
+		experiments[e.Type()] = e
+	}
+	return &experimentTypes{experiments: experiments}
+}
+
+// lookup returns the experiment of a type, loading the plugins the first time a type is not
+// registered. Plugins that failed to load are only an error when no experiment has the type.
+func (t *experimentTypes) lookup(ctx context.Context, experimentType string) (Experiment, error) {
+	if e, ok := t.experiments[experimentType]; ok {
+		return e, nil
+	}
+	if !t.pluginsLoaded {
+		t.pluginsLoaded = true
+		var plugins []*PluginExperiment
+		plugins, t.pluginsErr = loadPlugins(ctx)
+		for _, plugin := range plugins {
+			if _, ok := t.experiments[plugin.Type()]; ok {
+				output.WriteWarning("Skipping plugin %s, experiment %s already exists", plugin.Path(), plugin.Type())
+				continue
+			}
+			t.experiments[plugin.Type()] = plugin
+		}
+		if e, ok := t.experiments[experimentType]; ok {
+			if t.pluginsErr != nil {
+				output.WriteWarning("Failed to load plugins: %v", t.pluginsErr)
+			}
+			return e, nil
+		}
+	}
+	return nil, errors.Join(fmt.Errorf("Experiment %s does not exist", experimentType), t.pluginsErr)
+}
+
+// loadPlugins returns the experiments of the executables named woodpecker-experiment-<name> in
+// the directories of WOODPECKER_PLUGIN_PATH. PATH is not searched, so that no executable runs
+// unless it was installed as a plugin. The first executable of a name wins.
+func loadPlugins(ctx context.Context) ([]*PluginExperiment, error) {
+	var plugins []*PluginExperiment
+	var errs []error
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(os.Getenv(experiment.PluginPathEnv)) {
+		if dir == "" {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, experiment.PluginPrefix+"*"))
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			name := filepath.Base(path)
+			if seen[name] || !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+
+			plugin, err := loadPlugin(ctx, path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			plugins = append(plugins, plugin)
+		}
+	}
+	return plugins, errors.Join(errs...)
+}
+
+// loadPlugin asks an executable for the info of its experiment
+func loadPlugin(ctx context.Context, path string) (*PluginExperiment, error) {
+	resp, err := callPlugin(ctx, path, &experiment.Request{Method: experiment.MethodInfo})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Info == nil || resp.Info.Type == "" {
+		return nil, fmt.Errorf("Plugin %s returned no experiment type", path)
+	}
+	return &PluginExperiment{path: path, info: *resp.Info}, nil
+}
+
+// isExecutable reports whether the path is a regular file that can be executed
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if strings.EqualFold(filepath.Ext(path), ".exe") {
+		return true
+	}
+	return info.Mode()&0o111 != 0
+}
@@ -0,0 +1,163 @@
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/results"
+	"github.com/operantai/woodpecker/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPlugin is served by the test binary when it is started as a plugin executable
+type testPlugin struct{}
+
+type testPluginParameters struct {
+	Target string `json:"target"`
+}
+
+func (testPlugin) Info() experiment.Info {
+	return experiment.Info{
+		Type:        "test-plugin",
+		Description: "Plugin experiment",
+		Framework:   "MITRE",
+		Tactic:      "Execution",
+		Technique:   "Plugin",
+	}
+}
+
+func (testPlugin) Run(ctx context.Context, config *experiment.Config) error {
+	var parameters testPluginParameters
+	if err := config.DecodeParameters(&parameters); err != nil {
+		return err
+	}
+	return config.StoreResult(parameters)
+}
+
+func (testPlugin) Verify(ctx context.Context, config *experiment.Config) (*experiment.Outcome, error) {
+	outcome := experiment.NewOutcome()
+	if len(config.Results) != 1 {
+		outcome.Fail("target-reached")
+		return outcome, nil
+	}
+	var result testPluginParameters
+	if err := json.Unmarshal(config.Results[0], &result); err != nil {
+		return nil, err
+	}
+	outcome.Success("target-reached", result.Target)
+	return outcome, nil
+}
+
+func (testPlugin) Cleanup(ctx context.Context, config *experiment.Config) error {
+	if len(config.Results) == 0 {
+		return errors.New("Nothing to clean up")
+	}
+	return nil
+}
+
+func TestPluginProcess(t *testing.T) {
+	if os.Getenv("WOODPECKER_TEST_PLUGIN") != "1" {
+		return
+	}
+	if err := experiment.ServeIO(context.Background(), testPlugin{}, os.Stdin, os.Stdout); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestPlugins(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nWOODPECKER_TEST_PLUGIN=1 exec " + os.Args[0] + " -test.run=^TestPluginProcess$\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, experiment.PluginPrefix+"test"), []byte(script), 0o755))
+	// Files without the prefix or that cannot be executed are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, experiment.PluginPrefix+"notes"), []byte("notes"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other"), []byte(script), 0o755))
+	// Executables on PATH are never started
+	pathDir := t.TempDir()
+	started := filepath.Join(pathDir, "started")
+	require.NoError(t, os.WriteFile(filepath.Join(pathDir, experiment.PluginPrefix+"path"), []byte("#!/bin/sh\ntouch "+started+"\n"), 0o755))
+	t.Setenv(experiment.PluginPathEnv, dir)
+	t.Setenv("PATH", pathDir)
+
+	registry := ExperimentsRegistry
+	ctx := context.Background()
+	plugins, err := loadPlugins(ctx)
+	require.NoError(t, err)
+	require.Len(t, plugins, 1)
+	assert.Equal(t, "Plugin experiment", plugins[0].Description())
+	assert.NoFileExists(t, started)
+
+	types := newExperimentTypes()
+	plugin, err := types.lookup(ctx, "test-plugin")
+	require.NoError(t, err)
+	assert.Equal(t, "test-plugin", plugin.Type())
+	_, err = types.lookup(ctx, "missing-plugin")
+	assert.EqualError(t, err, "Experiment missing-plugin does not exist")
+	// Plugins are only available to the files naming them
+	assert.Equal(t, registry, ExperimentsRegistry)
+	_, ok := experimentByType("test-plugin")
+	assert.False(t, ok)
+
+	// Plugins are not loaded while every type is registered
+	require.NoError(t, os.WriteFile(filepath.Join(dir, experiment.PluginPrefix+"broken"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	exec := filepath.Join(dir, "exec.yaml")
+	require.NoError(t, os.WriteFile(exec, []byte(`
+experiments:
+- metadata:
+    name: exec
+    type: kube-exec
+  parameters:
+    command: [ls]
+`), 0o600))
+	require.NoError(t, ValidateFiles(ctx, []string{exec}, Templating{}))
+
+	file := filepath.Join(dir, "experiments.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+experiments:
+- metadata:
+    name: plugin
+    namespace: default
+    type: test-plugin
+  parameters:
+    target: api
+`), 0o600))
+	require.NoError(t, ValidateFiles(ctx, []string{file}, Templating{}))
+
+	store, err := results.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	outputFile := filepath.Join(dir, "results.json")
+	r, err := NewRunner(ctx, []string{file}, WithResultStore(store), WithOutputFile(outputFile))
+	require.NoError(t, err)
+	require.NoError(t, r.Run())
+	require.NoError(t, r.RunVerifiers("json"))
+
+	contents, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var structuredOutput struct {
+		Results []struct {
+			Experiment    string                   `json:"experiment"`
+			Technique     string                   `json:"technique"`
+			Result        map[string]string        `json:"result"`
+			ResultOutputs map[string][]interface{} `json:"result_outputs"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(contents, &structuredOutput))
+	require.Len(t, structuredOutput.Results, 1)
+	outcome := structuredOutput.Results[0]
+	assert.Equal(t, "plugin", outcome.Experiment)
+	assert.Equal(t, "Plugin", outcome.Technique)
+	assert.Equal(t, map[string]string{"target-reached": experiment.Success}, outcome.Result)
+	assert.Equal(t, []interface{}{"api"}, outcome.ResultOutputs["target-reached"])
+
+	require.NoError(t, r.Cleanup())
+	stored, err := store.List(ctx, results.Key{Experiment: "plugin"})
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+	// Errors of the plugin are returned by the Runner
+	assert.ErrorContains(t, r.Cleanup(), "Nothing to clean up")
+}
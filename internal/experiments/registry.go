@@ -13,6 +13,16 @@ var ExperimentsRegistry = []Experiment{
 	&LLMDataPoisoningExperiment{},
 	&KubeExec{},
 	&PostmanCollectionExperimentConfig{},
+	&ManifestExperiment{},
+	&PodSecurityStandardsExperimentConfig{},
+	&ContainerEscapeExperimentConfig{},
+	&RBACEnumerationExperimentConfig{},
+	&InstanceMetadataExperimentConfig{},
+	&KubeletAPIExperimentConfig{},
+	&NetworkReachabilityExperimentConfig{},
+	&NetworkMappingExperimentConfig{},
+	&BackdoorCronJobExperimentConfig{},
+	&MaliciousAdmissionWebhookExperimentConfig{},
 }
 
 func ListExperiments() map[string]string {
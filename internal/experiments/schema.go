@@ -0,0 +1,136 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/operantai/woodpecker/internal/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// ExperimentSchema returns the JSON Schema of an experiment of the given type, generated from the
+// struct the experiment decodes its configuration into
+func ExperimentSchema(experimentType string) (*schema.Schema, error) {
+	e, ok := experimentByType(experimentType)
+	if !ok {
+		return nil, fmt.Errorf("Experiment %s does not exist", experimentType)
+	}
+	s := experimentSchema(e)
+	s.Schema = schema.Draft
+	return s, nil
+}
+
+// FileSchema returns the JSON Schema of experiment files, which accept experiments of any type
+func FileSchema() *schema.Schema {
+	s := fileSchema()
+	s.Schema = schema.Draft
+	s.Title = "Woodpecker experiments"
+	var experiments []*schema.Schema
+	for _, e := range sortedRegistry() {
+		experiments = append(experiments, experimentSchema(e))
+	}
+	s.Properties["experiments"].Items = &schema.Schema{OneOf: experiments}
+	return s
+}
+
+// experimentSchema returns the schema of an experiment, from the metadata and parameters fields
+// of the experiment struct
+func experimentSchema(e Experiment) *schema.Schema {
+	s := schema.Generate(reflect.TypeOf(e))
+	s.Title = e.Type()
+	s.Description = e.Description()
+	s.Required = []string{"metadata", "parameters"}
+	if metadata, ok := s.Properties["metadata"]; ok {
+		metadata.Required = []string{"name", "type"}
+		metadata.Properties["type"].Const = e.Type()
+	}
+	return s
+}
+
+// fileSchema returns the schema of experiment files, with the parameters of every experiment
+// accepting anything
+func fileSchema() *schema.Schema {
+	s := schema.Generate(reflect.TypeOf(ExperimentsConfig{}))
+	s.Required = []string{"experiments"}
+	experiment := s.Properties["experiments"].Items
+	experiment.Required = []string{"metadata", "parameters"}
+	experiment.Properties["metadata"].Required = []string{"name", "type"}
+	return s
+}
+
+// validateExperiments validates an experiments document against the schema of experiment files,
+// then the parameters of each experiment against the schema of its type. Experiments of unknown
+// types are reported by the Runner.
+func validateExperiments(document *yaml.Node) error {
+	errs := fileSchema().Validate(document, "")
+	for i, experiment := range experimentNodes(document) {
+		e, ok := experimentByType(experimentType(experiment))
+		if !ok {
+			continue
+		}
+		if parameters := mappingValue(experiment, "parameters"); parameters != nil {
+			errs = append(errs, experimentSchema(e).Properties["parameters"].Validate(parameters, fmt.Sprintf("experiments[%d].parameters", i))...)
+		}
+	}
+
+	joined := make([]error, len(errs))
+	for i, err := range errs {
+		joined[i] = err
+	}
+	return errors.Join(joined...)
+}
+
+// experimentNodes returns the nodes of the experiments of a document
+func experimentNodes(document *yaml.Node) []*yaml.Node {
+	root := document
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	experiments := mappingValue(root, "experiments")
+	if experiments == nil || experiments.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return experiments.Content
+}
+
+// experimentType returns the type in the metadata of an experiment node
+func experimentType(experiment *yaml.Node) string {
+	if typeNode := mappingValue(mappingValue(experiment, "metadata"), "type"); typeNode != nil {
+		return typeNode.Value
+	}
+	return ""
+}
+
+// mappingValue returns the value of a key of a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func experimentByType(experimentType string) (Experiment, bool) {
+	for _, e := range ExperimentsRegistry {
+		if e.Type() == experimentType {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// sortedRegistry returns the registered experiments sorted by type
+func sortedRegistry() []Experiment {
+	registry := append([]Experiment{}, ExperimentsRegistry...)
+	sort.Slice(registry, func(i, j int) bool { return registry[i].Type() < registry[j].Type() })
+	return registry
+}
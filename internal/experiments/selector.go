@@ -0,0 +1,213 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Requirement matches experiments whose key has, or with Negate has not, a value matching the
+// pattern. Keys are name, type, namespace, framework, tactic, technique and tag, any other key
+// is a label. Patterns are matched case-insensitively, * matches any characters and ? a single
+// character.
+type Requirement struct {
+	Key     string
+	Pattern string
+	Negate  bool
+}
+
+// ParseRequirement parses key=pattern and key!=pattern requirements
+func ParseRequirement(s string) (Requirement, error) {
+	if key, pattern, ok := strings.Cut(s, "!="); ok && key != "" {
+		return Requirement{Key: strings.TrimSpace(key), Pattern: pattern, Negate: true}, nil
+	}
+	if key, pattern, ok := strings.Cut(s, "="); ok && key != "" {
+		return Requirement{Key: strings.TrimSpace(key), Pattern: pattern}, nil
+	}
+	return Requirement{}, fmt.Errorf("Invalid selector %q, expected key=value or key!=value", s)
+}
+
+// Selector selects the experiments of a Runner. An experiment is selected if it matches every
+// requirement, one of the frameworks and one of the name patterns if any are set, and none of
+// the exclusions.
+type Selector struct {
+	Requirements []Requirement
+	Frameworks   []string
+	Names        []string
+	Exclusions   []Requirement
+}
+
+// ParseSelector returns the Selector of the --select, --framework, --name and --exclude flags.
+// Exclusions without an = are name patterns.
+func ParseSelector(selects, frameworks, names, excludes []string) (*Selector, error) {
+	s := &Selector{Frameworks: frameworks, Names: names}
+	for _, selector := range selects {
+		requirement, err := ParseRequirement(selector)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		s.Requirements = append(s.Requirements, requirement)
+	}
+	for _, exclude := range excludes {
+		if !strings.Contains(exclude, "=") {
+			s.Exclusions = append(s.Exclusions, Requirement{Key: "name", Pattern: exclude})
+			continue
+		}
+		requirement, err := ParseRequirement(exclude)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		s.Exclusions = append(s.Exclusions, requirement)
+	}
+	return s, nil
+}
+
+// Empty reports whether the selector selects every experiment
+func (s *Selector) Empty() bool {
+	return s == nil || len(s.Requirements)+len(s.Frameworks)+len(s.Names)+len(s.Exclusions) == 0
+}
+
+// Matches reports whether the selector selects the experiment
+func (s *Selector) Matches(e *ExperimentConfig, experiment Experiment) bool {
+	if s.Empty() {
+		return true
+	}
+	for _, requirement := range s.Requirements {
+		if !requirement.Matches(e, experiment) {
+			return false
+		}
+	}
+	if len(s.Frameworks) > 0 && !matchesAny(s.Frameworks, experiment.Framework()) {
+		return false
+	}
+	if len(s.Names) > 0 && !matchesAny(s.Names, e.Metadata.Name) {
+		return false
+	}
+	for _, exclusion := range s.Exclusions {
+		if exclusion.Matches(e, experiment) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether the experiment matches the requirement
+func (r Requirement) Matches(e *ExperimentConfig, experiment Experiment) bool {
+	var values []string
+	switch strings.ToLower(r.Key) {
+	case "name":
+		values = []string{e.Metadata.Name}
+	case "type":
+		values = []string{e.Metadata.Type}
+	case "namespace":
+		values = []string{e.Metadata.Namespace}
+	case "framework":
+		values = []string{experiment.Framework()}
+	case "tactic":
+		values = []string{experiment.Tactic()}
+	case "technique":
+		values = []string{experiment.Technique()}
+	case "tag":
+		values = e.Metadata.Tags
+	default:
+		if value, ok := e.Metadata.Labels[r.Key]; ok {
+			values = []string{value}
+		}
+	}
+	return matchesAny([]string{r.Pattern}, values...) != r.Negate
+}
+
+// matchesAny reports whether any of the values matches any of the patterns
+func matchesAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if matchPattern(strings.ToLower(pattern), strings.ToLower(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPattern matches a value against a pattern where * matches any characters and ? a single
+// character
+func matchPattern(pattern, value string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(value); i >= 0; i-- {
+				if matchPattern(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(value) == 0 {
+				return false
+			}
+			value = value[1:]
+		default:
+			if len(value) == 0 || pattern[0] != value[0] {
+				return false
+			}
+			value = value[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(value) == 0
+}
+
+// selectExperiments returns the experiments in order the selector selects, along with the
+// experiments they depend on. It returns an error if nothing is selected, or if a selected
+// experiment depends on an excluded one.
+func selectExperiments(order []*ExperimentConfig, experiments map[string]Experiment, s *Selector) ([]*ExperimentConfig, error) {
+	if s.Empty() {
+		return order, nil
+	}
+	byName := make(map[string]*ExperimentConfig, len(order))
+	for _, e := range order {
+		byName[e.Metadata.Name] = e
+	}
+
+	selected := make(map[string]bool)
+	var include func(e *ExperimentConfig, dependent string) error
+	include = func(e *ExperimentConfig, dependent string) error {
+		if selected[e.Metadata.Name] {
+			return nil
+		}
+		for _, exclusion := range s.Exclusions {
+			if exclusion.Matches(e, experiments[e.Metadata.Type]) {
+				return fmt.Errorf("Experiment %s depends on excluded experiment %s", dependent, e.Metadata.Name)
+			}
+		}
+		selected[e.Metadata.Name] = true
+		for _, dependency := range e.Metadata.DependsOn {
+			if err := include(byName[dependency], e.Metadata.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, e := range order {
+		if !s.Matches(e, experiments[e.Metadata.Type]) {
+			continue
+		}
+		if err := include(e, ""); err != nil {
+			return nil, err
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("No experiments match the selection")
+	}
+
+	result := make([]*ExperimentConfig, 0, len(selected))
+	for _, e := range order {
+		if selected[e.Metadata.Name] {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package experiments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectExperiments(t *testing.T) {
+	experiments := make(map[string]Experiment)
+	for _, e := range ExperimentsRegistry {
+		experiments[e.Type()] = e
+	}
+	configs := map[string]*ExperimentConfig{
+		"privileged-pod": {Metadata: ExperimentMetadata{Name: "privileged-pod", Type: "privileged-container", Tags: []string{"smoke"}}},
+		"exec-into-pod": {Metadata: ExperimentMetadata{
+			Name:      "exec-into-pod",
+			Type:      "kube-exec",
+			Labels:    map[string]string{"team": "platform"},
+			DependsOn: []string{"privileged-pod"},
+		}},
+		"llm-leakage":   {Metadata: ExperimentMetadata{Name: "llm-leakage", Type: "llm-data-leakage", Labels: map[string]string{"team": "ai"}}},
+		"llm-poisoning": {Metadata: ExperimentMetadata{Name: "llm-poisoning", Type: "llm-data-poisoning", Tags: []string{"smoke"}}},
+		"list-secrets":  {Metadata: ExperimentMetadata{Name: "list-secrets", Type: "list-kubernetes-secrets"}},
+	}
+	order, err := orderExperiments(configs)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		selects     []string
+		frameworks  []string
+		names       []string
+		excludes    []string
+		expected    []string
+		expectError string
+	}{
+		{
+			name:     "Everything by default",
+			expected: []string{"privileged-pod", "exec-into-pod", "list-secrets", "llm-leakage", "llm-poisoning"},
+		},
+		{
+			name:       "Framework",
+			frameworks: []string{"mitre-atlas"},
+			expected:   []string{"llm-leakage", "llm-poisoning"},
+		},
+		{
+			name:     "Name pattern",
+			names:    []string{"llm-*"},
+			expected: []string{"llm-leakage", "llm-poisoning"},
+		},
+		{
+			name:     "Tactic",
+			selects:  []string{"tactic=Credential*"},
+			expected: []string{"list-secrets"},
+		},
+		{
+			name:     "Tag",
+			selects:  []string{"tag=smoke"},
+			expected: []string{"privileged-pod", "llm-poisoning"},
+		},
+		{
+			name:     "Label and negation",
+			selects:  []string{"team=*", "team!=ai"},
+			expected: []string{"privileged-pod", "exec-into-pod"},
+		},
+		{
+			name:     "Dependencies are included",
+			names:    []string{"exec-into-pod"},
+			expected: []string{"privileged-pod", "exec-into-pod"},
+		},
+		{
+			name:     "Exclude by name and selector",
+			excludes: []string{"llm-leak?ge", "type=list-kubernetes-secrets"},
+			expected: []string{"privileged-pod", "exec-into-pod", "llm-poisoning"},
+		},
+		{
+			name:        "Excluded dependency",
+			names:       []string{"exec-into-pod"},
+			excludes:    []string{"privileged-pod"},
+			expectError: "Experiment exec-into-pod depends on excluded experiment privileged-pod",
+		},
+		{
+			name:        "No match",
+			frameworks:  []string{"OWASP"},
+			expectError: "No experiments match the selection",
+		},
+		{
+			name:        "Invalid selector",
+			selects:     []string{"tactic"},
+			expectError: `Invalid selector "tactic", expected key=value or key!=value`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selector, err := ParseSelector(test.selects, test.frameworks, test.names, test.excludes)
+			if err == nil {
+				var selected []*ExperimentConfig
+				selected, err = selectExperiments(order, experiments, selector)
+				if err == nil {
+					var names []string
+					for _, e := range selected {
+						names = append(names, e.Metadata.Name)
+					}
+					assert.Equal(t, test.expected, names)
+				}
+			}
+			if test.expectError != "" {
+				assert.EqualError(t, err, test.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{pattern: "llm-*", value: "llm-data-leakage", expected: true},
+		{pattern: "*leak*", value: "llm-data-leakage", expected: true},
+		{pattern: "llm-?", value: "llm-ab", expected: false},
+		{pattern: "privilege escalation", value: "privilege escalation", expected: true},
+		{pattern: "*", value: "", expected: true},
+		{pattern: "exec", value: "kube-exec", expected: false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, matchPattern(test.pattern, test.value), "%s ~ %s", test.pattern, test.value)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/oci"
+)
+
+var (
+	// stdin is read for the - experiment file
+	stdin io.Reader = os.Stdin
+	// httpClient downloads experiment files from URLs and OCI registries
+	httpClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// Environment variables with the credentials of the registries of oci:// experiment files
+const (
+	RegistryUsernameEnv = "WOODPECKER_REGISTRY_USERNAME"
+	RegistryPasswordEnv = "WOODPECKER_REGISTRY_PASSWORD"
+)
+
+// loadSources reads the experiment files the references point to, in order. A reference is one of:
+//   - - for stdin
+//   - an http:// or https:// URL, optionally pinned with a #sha256=<hex> checksum
+//   - an oci://<registry>/<repository>[:<tag>|@sha256:<hex>] artifact, each layer is a file
+//   - a directory, whose .yaml and .yml files are read recursively in lexical order
+//   - a glob pattern, e.g. suites/*.yaml
+//   - a file path
+//
+// Local files matched by more than one reference are only read once. URLs and OCI artifacts are
+// remote, they cannot read local environment variables and files unless Templating.TrustRemote is
+// set.
+func loadSources(ctx context.Context, refs []string) ([]source, error) {
+	var sources []source
+	var errs []error
+	seen := make(map[string]bool)
+	readStdin := false
+	for _, ref := range refs {
+		switch {
+		case ref == "-":
+			if readStdin {
+				errs = append(errs, errors.New("Stdin can only be read once"))
+				continue
+			}
+			readStdin = true
+			contents, err := io.ReadAll(stdin)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Failed to read experiments from stdin: %w", err))
+				continue
+			}
+			sources = append(sources, source{name: "<stdin>", contents: contents})
+		case strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://"):
+			s, err := downloadSource(ctx, ref)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			sources = append(sources, s)
+		case strings.HasPrefix(ref, "oci://"):
+			pulled, err := pullSources(ctx, strings.TrimPrefix(ref, "oci://"))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			sources = append(sources, pulled...)
+		default:
+			paths, err := expandPath(ref)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, path := range paths {
+				if seen[filepath.Clean(path)] {
+					continue
+				}
+				seen[filepath.Clean(path)] = true
+				contents, err := os.ReadFile(path)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				sources = append(sources, source{name: path, contents: contents})
+			}
+		}
+	}
+	return sources, errors.Join(errs...)
+}
+
+// expandPath returns the experiment files of a glob pattern, directory or file path
+func expandPath(ref string) ([]string, error) {
+	matches := []string{ref}
+	if strings.ContainsAny(ref, "*?[") {
+		var err error
+		if matches, err = filepath.Glob(ref); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %s: %w", ref, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No experiment files match %s", ref)
+		}
+	}
+
+	var paths []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, match)
+			continue
+		}
+		var found []string
+		err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(path); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("No experiment files found in %s", match)
+		}
+		paths = append(paths, found...)
+	}
+	return paths, nil
+}
+
+// downloadSource downloads an experiment file, verifying its #sha256=<hex> checksum if it has one
+func downloadSource(ctx context.Context, ref string) (source, error) {
+	location, fragment, _ := strings.Cut(ref, "#")
+	var digest string
+	if fragment != "" {
+		checksum, ok := strings.CutPrefix(fragment, "sha256=")
+		if !ok {
+			return source{}, fmt.Errorf("Invalid checksum of %s, expected #sha256=<hex>", location)
+		}
+		digest = "sha256:" + checksum
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return source{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return source{}, fmt.Errorf("Failed to download %s: %w", location, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return source{}, fmt.Errorf("Failed to download %s: %s", location, resp.Status)
+	}
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return source{}, fmt.Errorf("Failed to download %s: %w", location, err)
+	}
+	if digest != "" {
+		if err := oci.VerifyDigest(contents, digest); err != nil {
+			return source{}, fmt.Errorf("%s: %w", location, err)
+		}
+	}
+	return source{name: location, contents: contents, remote: true}, nil
+}
+
+// pullSources pulls the experiment files of an OCI artifact, one per layer
+func pullSources(ctx context.Context, reference string) ([]source, error) {
+	ref, err := oci.ParseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	client := &oci.Client{
+		HTTPClient: httpClient,
+		Username:   os.Getenv(RegistryUsernameEnv),
+		Password:   os.Getenv(RegistryPasswordEnv),
+	}
+	files, err := client.Pull(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to pull %s: %w", reference, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Artifact %s has no experiment files", reference)
+	}
+	sources := make([]source, 0, len(files))
+	for _, file := range files {
+		sources = append(sources, source{name: "oci://" + reference + "/" + file.Name, contents: file.Contents, remote: true})
+	}
+	return sources, nil
+}
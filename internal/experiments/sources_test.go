@@ -0,0 +1,171 @@
+package experiments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSources(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"suite/a.yaml":        "a",
+		"suite/b.yml":         "b",
+		"suite/nested/c.yaml": "c",
+		"suite/README.md":     "readme",
+		"single.yaml":         "single",
+		"empty/notes.txt":     "notes",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	}
+
+	remote := "remote"
+	sum := sha256.Sum256([]byte(remote))
+	checksum := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suite.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(remote))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		refs          []string
+		stdin         string
+		expected      []string
+		expectedNames []string
+		expectError   string
+	}{
+		{
+			name:     "Directory",
+			refs:     []string{filepath.Join(dir, "suite")},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "Glob",
+			refs:     []string{filepath.Join(dir, "suite", "*.yaml")},
+			expected: []string{"a"},
+		},
+		{
+			name:     "Files matched twice are read once",
+			refs:     []string{filepath.Join(dir, "suite", "a.yaml"), filepath.Join(dir, "suite"), filepath.Join(dir, "single.yaml")},
+			expected: []string{"a", "b", "c", "single"},
+		},
+		{
+			name:          "Stdin",
+			refs:          []string{"-"},
+			stdin:         "from stdin",
+			expected:      []string{"from stdin"},
+			expectedNames: []string{"<stdin>"},
+		},
+		{
+			name:          "URL",
+			refs:          []string{server.URL + "/suite.yaml"},
+			expected:      []string{"remote"},
+			expectedNames: []string{server.URL + "/suite.yaml"},
+		},
+		{
+			name:          "URL with checksum",
+			refs:          []string{server.URL + "/suite.yaml#sha256=" + checksum},
+			expected:      []string{"remote"},
+			expectedNames: []string{server.URL + "/suite.yaml"},
+		},
+		{
+			name:        "URL with wrong checksum",
+			refs:        []string{server.URL + "/suite.yaml#sha256=" + strings.Repeat("0", 64)},
+			expectError: "Digest mismatch",
+		},
+		{
+			name:        "URL not found",
+			refs:        []string{server.URL + "/missing.yaml"},
+			expectError: "404 Not Found",
+		},
+		{
+			name:        "Stdin twice",
+			refs:        []string{"-", "-"},
+			expectError: "Stdin can only be read once",
+		},
+		{
+			name:        "Glob without matches",
+			refs:        []string{filepath.Join(dir, "*.json")},
+			expectError: "No experiment files match",
+		},
+		{
+			name:        "Directory without experiment files",
+			refs:        []string{filepath.Join(dir, "empty")},
+			expectError: "No experiment files found",
+		},
+		{
+			name:        "Missing file",
+			refs:        []string{filepath.Join(dir, "missing.yaml")},
+			expectError: "no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdin = strings.NewReader(test.stdin)
+			defer func() { stdin = os.Stdin }()
+
+			sources, err := loadSources(context.Background(), test.refs)
+			if test.expectError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectError)
+				return
+			}
+			require.NoError(t, err)
+			var contents, names []string
+			for _, s := range sources {
+				contents = append(contents, string(s.contents))
+				names = append(names, s.name)
+			}
+			assert.Equal(t, test.expected, contents)
+			if test.expectedNames != nil {
+				assert.Equal(t, test.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestRemoteSourcesAreUntrusted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`
+experiments:
+- metadata:
+    name: exfiltrate
+    type: kube-exec
+  parameters:
+    command: [echo, "${file:` + r.URL.Query().Get("path") + `}"]
+`))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	err := ValidateFiles(ctx, []string{server.URL + "/suite.yaml?path=/etc/passwd"}, Templating{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "${file:/etc/passwd}: "+errUntrusted.Error())
+
+	_, err = NewRunner(ctx, []string{server.URL + "/suite.yaml?path=/etc/passwd"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), errUntrusted.Error())
+
+	// Trusted remote files read local files, as local files do
+	path := filepath.Join(t.TempDir(), "value")
+	require.NoError(t, os.WriteFile(path, []byte("local"), 0o600))
+	assert.NoError(t, ValidateFiles(ctx, []string{server.URL + "/suite.yaml?path=" + path}, Templating{TrustRemote: true}))
+}
@@ -0,0 +1,313 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/operantai/woodpecker/internal/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// Templating configures how experiment files are rendered before they are decoded
+type Templating struct {
+	// Values are substituted for ${name} references, values of nested maps are referenced with
+	// dotted names, e.g. ${images.executor}
+	Values map[string]interface{}
+	// Environment selects the overlay of the environments section of experiment files to apply
+	Environment string
+	// TrustRemote lets experiment files downloaded from URLs or pulled from OCI artifacts read
+	// local environment variables and files, as local experiment files do
+	TrustRemote bool
+
+	// untrusted is set while rendering a remote file that is not trusted
+	untrusted bool
+}
+
+// errUntrusted is returned for the references of untrusted remote files to local environment
+// variables and files
+var errUntrusted = errors.New("remote experiment files cannot read local environment variables and files unless they are trusted")
+
+// shellVariable matches the names of shell variables, e.g. HOME, whose references are left as
+// they are when no value of that name is set, so that shell references in commands keep working
+var shellVariable = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// ExperimentOverlay patches the metadata and parameters of an experiment in an environment.
+// Objects are merged into the experiment, other values replace it and null values remove it.
+type ExperimentOverlay struct {
+	Metadata   interface{} `yaml:"metadata,omitempty"`
+	Parameters interface{} `yaml:"parameters,omitempty"`
+}
+
+// ParseValues merges the values files in order, then sets the key=value pairs on top of them.
+// Keys are dotted paths into nested maps and values are parsed as YAML, e.g. port=4000 sets an
+// integer.
+func ParseValues(files []string, sets []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read values file: %w", err)
+		}
+		var fileValues map[string]interface{}
+		if err := yaml.Unmarshal(contents, &fileValues); err != nil {
+			return nil, fmt.Errorf("Failed to parse values file %s: %w", file, err)
+		}
+		mergeValues(values, fileValues)
+	}
+
+	for _, set := range sets {
+		key, raw, ok := strings.Cut(set, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("Invalid value %q, expected key=value", set)
+		}
+		var value interface{}
+		if err := yaml.Unmarshal([]byte(raw), &value); err != nil || value == nil {
+			value = raw
+		}
+		path := strings.Split(key, ".")
+		nested := values
+		for _, name := range path[:len(path)-1] {
+			next, ok := nested[name].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				nested[name] = next
+			}
+			nested = next
+		}
+		nested[path[len(path)-1]] = value
+	}
+	return values, nil
+}
+
+// mergeValues merges src into dst, nested maps are merged and other values replaced
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// render applies the overlay of the selected environment to an experiments document, then
+// expands the references of its values
+func (t Templating) render(document *yaml.Node) error {
+	root := document
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if t.Environment != "" {
+		if err := applyOverlay(root, t.Environment); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	t.expandNode(root, "", &errs)
+	return errors.Join(errs...)
+}
+
+// applyOverlay merges the overlays of an environment into the experiments they name. Documents
+// without environments are left as they are.
+func applyOverlay(root *yaml.Node, environment string) error {
+	environments := mappingValue(root, "environments")
+	if environments == nil || environments.Kind != yaml.MappingNode {
+		return nil
+	}
+	overlays := mappingValue(environments, environment)
+	if overlays == nil {
+		var defined []string
+		for i := 0; i+1 < len(environments.Content); i += 2 {
+			defined = append(defined, environments.Content[i].Value)
+		}
+		sort.Strings(defined)
+		return fmt.Errorf("Environment %s is not defined, defined environments are %s", environment, strings.Join(defined, ", "))
+	}
+	if overlays.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	experiments := make(map[string]*yaml.Node)
+	for _, experiment := range experimentNodes(root) {
+		if name := mappingValue(mappingValue(experiment, "metadata"), "name"); name != nil {
+			experiments[name.Value] = experiment
+		}
+	}
+	for i := 0; i+1 < len(overlays.Content); i += 2 {
+		name, overlay := overlays.Content[i], overlays.Content[i+1]
+		experiment, ok := experiments[name.Value]
+		if !ok {
+			return &schema.ValidationError{
+				Line:    name.Line,
+				Column:  name.Column,
+				Path:    fmt.Sprintf("environments.%s", environment),
+				Message: fmt.Sprintf("overlay of unknown experiment %q", name.Value),
+			}
+		}
+		mergeNode(experiment, overlay)
+	}
+	return nil
+}
+
+// mergeNode merges a YAML patch into a node following JSON merge patch semantics, and returns
+// the merged node
+func mergeNode(node, patch *yaml.Node) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode || patch.Kind != yaml.MappingNode {
+		return patch
+	}
+	for i := 0; i+1 < len(patch.Content); i += 2 {
+		key, value := patch.Content[i], patch.Content[i+1]
+		index := -1
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key.Value {
+				index = j
+				break
+			}
+		}
+		isNull := value.Kind == yaml.ScalarNode && value.ShortTag() == "!!null"
+		switch {
+		case index < 0 && isNull:
+		case index < 0:
+			node.Content = append(node.Content, key, value)
+		case isNull:
+			node.Content = append(node.Content[:index], node.Content[index+2:]...)
+		default:
+			node.Content[index+1] = mergeNode(node.Content[index+1], value)
+		}
+	}
+	return node
+}
+
+// expandNode expands the references of the scalar values of a node and its children. The
+// environments section is expanded as part of the experiments it patches.
+func (t Templating) expandNode(node *yaml.Node, path string, errs *[]error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path == "" && key == "environments" {
+				continue
+			}
+			t.expandNode(node.Content[i+1], joinPath(path, key), errs)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			t.expandNode(item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return
+		}
+		value, err := t.expand(node.Value)
+		if err != nil {
+			*errs = append(*errs, &schema.ValidationError{Line: node.Line, Column: node.Column, Path: path, Message: err.Error()})
+			return
+		}
+		node.Value = value
+		// Unquoted values are resolved again, e.g. port: ${port} becomes an integer
+		if node.Style == 0 || node.Style == yaml.FlowStyle {
+			node.Tag = ""
+		}
+	}
+}
+
+// expand replaces the references in a value:
+//   - ${name} and ${name:-default} by a value, or the default if it is not set. It is an error
+//     for ${name} not to be set, unless it names a shell variable, e.g. ${HOME}, which is left as
+//     it is so that shell references in commands keep working.
+//   - ${env:NAME} by an environment variable
+//   - ${file:path} by the contents of a file, without trailing newlines
+//
+// Untrusted remote files cannot reference environment variables and files.
+// $${ is replaced by a literal ${
+func (t Templating) expand(value string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			b.WriteString(value)
+			return b.String(), nil
+		}
+		// Escaped reference
+		if start > 0 && value[start-1] == '$' {
+			b.WriteString(value[:start-1])
+			b.WriteString("${")
+			value = value[start+2:]
+			continue
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference in %q", value)
+		}
+		resolved, err := t.resolve(value[start+2 : start+end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value[:start])
+		b.WriteString(resolved)
+		value = value[start+end+1:]
+	}
+}
+
+// resolve returns the value of a reference
+func (t Templating) resolve(reference string) (string, error) {
+	if t.untrusted && (strings.HasPrefix(reference, "env:") || strings.HasPrefix(reference, "file:")) {
+		return "", fmt.Errorf("${%s}: %w", reference, errUntrusted)
+	}
+	if name, ok := strings.CutPrefix(reference, "env:"); ok {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+	if path, ok := strings.CutPrefix(reference, "file:"); ok {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	}
+
+	name, defaultValue, hasDefault := strings.Cut(reference, ":-")
+	var value interface{} = t.Values
+	for _, key := range strings.Split(name, ".") {
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		value = values[key]
+	}
+	switch v := value.(type) {
+	case nil:
+		if hasDefault {
+			return defaultValue, nil
+		}
+		if shellVariable.MatchString(name) {
+			return "${" + reference + "}", nil
+		}
+		return "", fmt.Errorf("value %s is not set, use $${%s} for a literal ${%s}", name, name, name)
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("value %s is not a scalar", name)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,205 @@
+package experiments
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseValues(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	require.NoError(t, os.WriteFile(base, []byte("namespace: default\nimages:\n  executor: executor:v1\n  web: nginx\n"), 0o600))
+	staging := filepath.Join(dir, "staging.yaml")
+	require.NoError(t, os.WriteFile(staging, []byte("images:\n  executor: executor:v2\n"), 0o600))
+
+	values, err := ParseValues([]string{base, staging}, []string{"namespace=staging", "port=4000", "ai.model=gpt-4o", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"namespace": "staging",
+		"port":      4000,
+		"images":    map[string]interface{}{"executor": "executor:v2", "web": "nginx"},
+		"ai":        map[string]interface{}{"model": "gpt-4o"},
+		"empty":     "",
+	}, values)
+
+	_, err = ParseValues(nil, []string{"namespace"})
+	assert.Error(t, err)
+	_, err = ParseValues([]string{filepath.Join(dir, "missing.yaml")}, nil)
+	assert.Error(t, err)
+}
+
+func TestExpand(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(secret, []byte("s3cr3t\n"), 0o600))
+	t.Setenv("WOODPECKER_TEST_KEY", "from-env")
+
+	templating := Templating{Values: map[string]interface{}{
+		"namespace": "staging",
+		"port":      4000,
+		"images":    map[string]interface{}{"executor": "executor:v2"},
+	}}
+
+	tests := []struct {
+		value       string
+		expected    string
+		expectError bool
+	}{
+		{value: "no references", expected: "no references"},
+		{value: "cost is $5", expected: "cost is $5"},
+		{value: "${namespace}", expected: "staging"},
+		{value: "${port}", expected: "4000"},
+		{value: "image: ${images.executor}!", expected: "image: executor:v2!"},
+		{value: "${model:-gpt-4o}", expected: "gpt-4o"},
+		{value: "${namespace:-default}", expected: "staging"},
+		{value: "${env:WOODPECKER_TEST_KEY}", expected: "from-env"},
+		{value: "Bearer ${file:" + secret + "}", expected: "Bearer s3cr3t"},
+		{value: "$${namespace}", expected: "${namespace}"},
+		{value: "${model}", expectError: true},
+		// A typo of a value is not mistaken for a shell reference
+		{value: "${namespaces}", expectError: true},
+		{value: "${images.executer}", expectError: true},
+		{value: `sh -c "echo ${HOME} > ${OUT}"`, expected: `sh -c "echo ${HOME} > ${OUT}"`},
+		{value: "${images}", expectError: true},
+		{value: "${env:WOODPECKER_TEST_UNSET}", expectError: true},
+		{value: "${file:/does/not/exist}", expectError: true},
+		{value: "${namespace", expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			value, err := templating.expand(test.value)
+			if test.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, value)
+		})
+	}
+}
+
+func TestRenderYAML(t *testing.T) {
+	contents := []byte(`
+experiments:
+- metadata:
+    name: exec
+    namespace: ${namespace:-default}
+    type: kube-exec
+  parameters:
+    target:
+      pod: web
+      container: app
+    command: ["cat", "/etc/${file}"]
+- metadata:
+    name: api
+    namespace: ${namespace:-default}
+    type: remote-execute-api
+  parameters:
+    image: ${image}
+    target:
+      targetPort: ${port}
+      path: /experiment/CheckEgress/
+environments:
+  staging:
+    exec:
+      metadata:
+        namespace: staging
+      parameters:
+        target:
+          container: sidecar
+        command: ["ls"]
+    api:
+      parameters:
+        image: null
+`)
+
+	tests := []struct {
+		name        string
+		templating  Templating
+		expectError string
+		check       func(t *testing.T, configs []ExperimentConfig)
+	}{
+		{
+			name:       "Values",
+			templating: Templating{Values: map[string]interface{}{"file": "hosts", "image": "egress", "port": 4000}},
+			check: func(t *testing.T, configs []ExperimentConfig) {
+				assert.Equal(t, "default", configs[0].Metadata.Namespace)
+				parameters := configs[0].Parameters.(map[string]interface{})
+				assert.Equal(t, []interface{}{"cat", "/etc/hosts"}, parameters["command"])
+				// Unquoted references are resolved to their type
+				target := configs[1].Parameters.(map[string]interface{})["target"].(map[string]interface{})
+				assert.Equal(t, 4000, target["targetPort"])
+			},
+		},
+		{
+			name:       "Environment overlay",
+			templating: Templating{Values: map[string]interface{}{"port": 4000}, Environment: "staging"},
+			check: func(t *testing.T, configs []ExperimentConfig) {
+				assert.Equal(t, "staging", configs[0].Metadata.Namespace)
+				parameters := configs[0].Parameters.(map[string]interface{})
+				assert.Equal(t, map[string]interface{}{"pod": "web", "container": "sidecar"}, parameters["target"])
+				assert.Equal(t, []interface{}{"ls"}, parameters["command"])
+				// Null values remove the field, so ${image} is not needed
+				assert.NotContains(t, configs[1].Parameters.(map[string]interface{}), "image")
+			},
+		},
+		{
+			name:        "Missing value",
+			templating:  Templating{Values: map[string]interface{}{"file": "hosts", "port": 4000}},
+			expectError: "line 17: experiments[1].parameters.image: value image is not set, use $${image} for a literal ${image}",
+		},
+		{
+			name:        "Misspelled value",
+			templating:  Templating{Values: map[string]interface{}{"file": "hosts", "port": 4000, "imagee": "alpine"}},
+			expectError: "line 17: experiments[1].parameters.image: value image is not set, use $${image} for a literal ${image}",
+		},
+		{
+			name:        "Unknown environment",
+			templating:  Templating{Environment: "production"},
+			expectError: "Environment production is not defined, defined environments are staging",
+		},
+		{
+			name:        "Wrong type after rendering",
+			templating:  Templating{Values: map[string]interface{}{"file": "hosts", "image": "egress", "port": "http"}},
+			expectError: `line 19: experiments[1].parameters.target.targetPort: expected an integer, got "http"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configs, err := renderYAML(contents, test.templating)
+			if test.expectError != "" {
+				assert.EqualError(t, err, test.expectError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, configs, 2)
+			test.check(t, configs)
+		})
+	}
+}
+
+func TestRenderYAMLShellReferences(t *testing.T) {
+	// An experiment file that worked before templating, with shell references in its command
+	contents := []byte(`
+experiments:
+  - metadata:
+      name: exec
+      type: kube-exec
+      namespace: default
+    parameters:
+      target:
+        pod: web
+        container: app
+      command: ["sh", "-c", "echo ${HOSTNAME} $${HOME} > /tmp/${FILE}"]
+`)
+	configs, err := renderYAML(contents, Templating{})
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	parameters := configs[0].Parameters.(map[string]interface{})
+	assert.Equal(t, []interface{}{"sh", "-c", "echo ${HOSTNAME} ${HOME} > /tmp/${FILE}"}, parameters["command"])
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	embedExperiments "github.com/operantai/woodpecker/experiments"
+	"github.com/operantai/woodpecker/internal/schema"
+)
+
+// source is the contents of an experiment file
+type source struct {
+	name     string
+	contents []byte
+	// remote is set for files downloaded from a URL or pulled from an OCI artifact
+	remote bool
+}
+
+// ValidateFiles checks experiment files without touching a cluster, files are loaded as by
+// NewRunner. Every file is rendered with the templating and decoded strictly against the schema
+// of its experiment types, and the experiments of all files must have existing types, unique
+// names and dependencies that resolve, as when they run together.
+func ValidateFiles(ctx context.Context, files []string, templating Templating) error {
+	sources, err := loadSources(ctx, files)
+	return errors.Join(err, validateSources(ctx, sources, templating))
+}
+
+// ValidateSnippets checks the experiment templates embedded in the CLI, each on its own
+func ValidateSnippets() error {
+	names, err := fs.Glob(embedExperiments.EmbeddedExperiments, "*.yaml")
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		contents, err := embedExperiments.EmbeddedExperiments.ReadFile(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, validateSources(context.Background(), []source{{name: path.Join("experiments", name), contents: contents}}, Templating{}))
+	}
+	return errors.Join(errs...)
+}
+
+func validateSources(ctx context.Context, sources []source, templating Templating) error {
+	types := newExperimentTypes()
+	var errs []error
+	configs := make(map[string]*ExperimentConfig)
+	for _, s := range sources {
+		parsed, err := parseSource(s, templating)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for i := range parsed {
+			e := &parsed[i]
+			if _, err := types.lookup(ctx, e.Metadata.Type); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			}
+			if _, ok := configs[e.Metadata.Name]; ok {
+				errs = append(errs, fmt.Errorf("%s: Experiment %s is defined more than once", s.name, e.Metadata.Name))
+			}
+			configs[e.Metadata.Name] = e
+		}
+	}
+	if len(errs) == 0 {
+		if _, err := orderExperiments(configs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileError adds the file name to the errors of decoding it
+func fileError(err error, file string) error {
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		return schema.WithFile(err, file)
+	}
+	return fmt.Errorf("%s: %w", file, err)
+}
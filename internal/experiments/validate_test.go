@@ -0,0 +1,141 @@
+package experiments
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/operantai/woodpecker/internal/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSnippets(t *testing.T) {
+	assert.NoError(t, ValidateSnippets())
+}
+
+func TestValidateFiles(t *testing.T) {
+	const exec = `
+experiments:
+- metadata:
+    name: exec
+    type: kube-exec
+  parameters:
+    command: [ls]
+`
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name:  "Valid",
+			files: map[string]string{"exec.yaml": exec},
+		},
+		{
+			name: "Dependencies across files",
+			files: map[string]string{"exec.yaml": exec, "mount.yaml": `
+experiments:
+- metadata:
+    name: mount
+    type: host-path-mount
+    dependsOn: [exec]
+  parameters:
+    hostPath:
+      path: /etc
+`},
+		},
+		{
+			name: "Unknown field with line",
+			files: map[string]string{"exec.yaml": `
+experiments:
+- metadata:
+    name: exec
+    type: kube-exec
+  parameters:
+    comand: [ls]
+`},
+			expected: []string{`exec.yaml:7:5: experiments[0].parameters: unknown field "comand", did you mean "command"?`},
+		},
+		{
+			name: "Unknown type",
+			files: map[string]string{"exec.yaml": `
+experiments:
+- metadata:
+    name: exec
+    type: kube-exec-v2
+  parameters: {}
+`},
+			expected: []string{"exec.yaml: Experiment kube-exec-v2 does not exist"},
+		},
+		{
+			name:     "Duplicate names",
+			files:    map[string]string{"exec.yaml": exec, "exec-copy.yaml": exec},
+			expected: []string{"exec.yaml: Experiment exec is defined more than once"},
+		},
+		{
+			name: "Unknown dependency",
+			files: map[string]string{"mount.yaml": `
+experiments:
+- metadata:
+    name: mount
+    type: host-path-mount
+    dependsOn: [exec]
+  parameters: {}
+`},
+			expected: []string{"Experiment mount depends on unknown experiment exec"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var files []string
+			for name, contents := range test.files {
+				file := filepath.Join(dir, name)
+				require.NoError(t, os.WriteFile(file, []byte(contents), 0o600))
+				files = append(files, file)
+			}
+			// Sorted so that duplicates are reported in the second file
+			sort.Strings(files)
+
+			err := ValidateFiles(context.Background(), files, Templating{})
+			if len(test.expected) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, expected := range test.expected {
+				assert.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
+
+func TestNewRunnerDuplicateNames(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"exec.yaml", "exec-copy.yaml"} {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(`
+experiments:
+- metadata:
+    name: exec
+    type: kube-exec
+  parameters:
+    command: [ls]
+`), 0o600))
+		files = append(files, file)
+	}
+
+	store, err := results.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	// Files that fail validation do not run either
+	_, err = NewRunner(context.Background(), files, WithResultStore(store))
+	var configErr *ConfigError
+	require.ErrorAs(t, err, &configErr)
+	assert.Equal(t, ExitConfigError, ExitCode(err))
+	assert.Contains(t, err.Error(), "Experiment exec is defined more than once")
+}
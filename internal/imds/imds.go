@@ -0,0 +1,269 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package imds probes the instance metadata services of cloud providers for the identity of the
+// node and the credentials of its managed identity. Credentials are only checked for, never kept.
+package imds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Providers of instance metadata services
+const (
+	AWSIMDSv1 = "aws-imdsv1"
+	AWSIMDSv2 = "aws-imdsv2"
+	GCP       = "gcp"
+	Azure     = "azure"
+)
+
+// Providers lists the providers in the order they are probed
+var Providers = []string{AWSIMDSv1, AWSIMDSv2, GCP, Azure}
+
+// Addresses are the base URLs of the metadata services, a fake metadata server can stand in for
+// any of them
+type Addresses struct {
+	AWS   string `json:"aws,omitempty" yaml:"aws"`
+	GCP   string `json:"gcp,omitempty" yaml:"gcp"`
+	Azure string `json:"azure,omitempty" yaml:"azure"`
+}
+
+// DefaultAddresses are the link-local addresses the metadata services listen on
+var DefaultAddresses = Addresses{
+	AWS:   "http://169.254.169.254",
+	GCP:   "http://metadata.google.internal",
+	Azure: "http://169.254.169.254",
+}
+
+// Result is the outcome of probing the metadata service of a provider
+type Result struct {
+	Provider string `json:"provider"`
+	Address  string `json:"address"`
+	// Reachable is set when the metadata service answered, even with an error status
+	Reachable bool `json:"reachable"`
+	// Identity names the role, service account or client the credentials are for
+	Identity string `json:"identity,omitempty"`
+	// Credentials is set when the credentials of the managed identity were obtained
+	Credentials bool `json:"credentials"`
+	// Expiration is when the obtained credentials expire, as reported by the metadata service
+	Expiration string `json:"expiration,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Prober probes metadata services
+type Prober struct {
+	Client    *http.Client
+	Addresses Addresses
+}
+
+// NewProber returns a Prober for the addresses, using the default address of the providers whose
+// address is not set
+func NewProber(addresses Addresses, timeout time.Duration) *Prober {
+	if addresses.AWS == "" {
+		addresses.AWS = DefaultAddresses.AWS
+	}
+	if addresses.GCP == "" {
+		addresses.GCP = DefaultAddresses.GCP
+	}
+	if addresses.Azure == "" {
+		addresses.Azure = DefaultAddresses.Azure
+	}
+	return &Prober{
+		// Metadata services never redirect, a redirect means something else answered
+		Client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Addresses: addresses,
+	}
+}
+
+// Probe probes the metadata services of the named providers, all of them by default
+func (p *Prober) Probe(ctx context.Context, providers []string) ([]Result, error) {
+	for _, provider := range providers {
+		if !slices.Contains(Providers, provider) {
+			return nil, fmt.Errorf("Unknown provider %s, expected one of %s", provider, strings.Join(Providers, ", "))
+		}
+	}
+	if len(providers) == 0 {
+		providers = Providers
+	}
+
+	var results []Result
+	for _, provider := range Providers {
+		if !slices.Contains(providers, provider) {
+			continue
+		}
+		var result Result
+		var err error
+		switch provider {
+		case AWSIMDSv1:
+			result = Result{Provider: provider, Address: p.Addresses.AWS}
+			err = p.probeAWS(ctx, &result, nil)
+		case AWSIMDSv2:
+			result = Result{Provider: provider, Address: p.Addresses.AWS}
+			err = p.probeAWSv2(ctx, &result)
+		case GCP:
+			result = Result{Provider: provider, Address: p.Addresses.GCP}
+			err = p.probeGCP(ctx, &result)
+		case Azure:
+			result = Result{Provider: provider, Address: p.Addresses.Azure}
+			err = p.probeAzure(ctx, &result)
+		}
+		if err != nil {
+			result.Message = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// probeAWS lists the roles of the instance profile and fetches the credentials of the first one,
+// with the headers of the requests
+func (p *Prober) probeAWS(ctx context.Context, result *Result, header http.Header) error {
+	roles, err := p.get(ctx, http.MethodGet, result.Address+"/latest/meta-data/iam/security-credentials/", header)
+	result.Reachable = answered(err)
+	if err != nil {
+		return err
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return fmt.Errorf("The instance has no instance profile")
+	}
+	result.Identity = role
+
+	body, err := p.get(ctx, http.MethodGet, result.Address+"/latest/meta-data/iam/security-credentials/"+role, header)
+	if err != nil {
+		return err
+	}
+	var credentials struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Expiration      string `json:"Expiration"`
+	}
+	if err := json.Unmarshal(body, &credentials); err != nil {
+		return fmt.Errorf("Invalid credentials of role %s: %w", role, err)
+	}
+	result.Credentials = credentials.AccessKeyID != "" && credentials.SecretAccessKey != ""
+	result.Expiration = credentials.Expiration
+	return nil
+}
+
+// probeAWSv2 requests a session token, then probes like IMDSv1 with it
+func (p *Prober) probeAWSv2(ctx context.Context, result *Result) error {
+	token, err := p.get(ctx, http.MethodPut, result.Address+"/latest/api/token", http.Header{
+		"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"},
+	})
+	result.Reachable = answered(err)
+	if err != nil {
+		return err
+	}
+	return p.probeAWS(ctx, result, http.Header{"X-Aws-Ec2-Metadata-Token": {strings.TrimSpace(string(token))}})
+}
+
+// probeGCP fetches the email and an access token of the default service account
+func (p *Prober) probeGCP(ctx context.Context, result *Result) error {
+	header := http.Header{"Metadata-Flavor": {"Google"}}
+	base := result.Address + "/computeMetadata/v1/instance/service-accounts/default/"
+	email, err := p.get(ctx, http.MethodGet, base+"email", header)
+	result.Reachable = answered(err)
+	if err != nil {
+		return err
+	}
+	result.Identity = strings.TrimSpace(string(email))
+
+	body, err := p.get(ctx, http.MethodGet, base+"token", header)
+	if err != nil {
+		return err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("Invalid token of service account %s: %w", result.Identity, err)
+	}
+	result.Credentials = token.AccessToken != ""
+	if token.ExpiresIn > 0 {
+		result.Expiration = fmt.Sprintf("%ds", token.ExpiresIn)
+	}
+	return nil
+}
+
+// probeAzure fetches the instance metadata, then an access token of the managed identity for the
+// Azure Resource Manager
+func (p *Prober) probeAzure(ctx context.Context, result *Result) error {
+	header := http.Header{"Metadata": {"true"}}
+	_, err := p.get(ctx, http.MethodGet, result.Address+"/metadata/instance?api-version=2021-02-01", header)
+	result.Reachable = answered(err)
+	if err != nil {
+		return err
+	}
+
+	body, err := p.get(ctx, http.MethodGet, result.Address+"/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https%3A%2F%2Fmanagement.azure.com%2F", header)
+	if err != nil {
+		return err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ClientID    string `json:"client_id"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("Invalid token of the managed identity: %w", err)
+	}
+	result.Identity = token.ClientID
+	result.Credentials = token.AccessToken != ""
+	result.Expiration = token.ExpiresOn
+	return nil
+}
+
+// get sends a request to a metadata service, returning its body when it succeeded
+func (p *Prober) get(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	response, err := p.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, &statusError{method: method, path: request.URL.Path, status: response.Status}
+	}
+	return body, nil
+}
+
+// statusError is returned when a metadata service answered with an error status
+type statusError struct {
+	method, path, status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s returned %s", e.method, e.path, e.status)
+}
+
+// answered reports whether a metadata service answered a request, given its error
+func answered(err error) bool {
+	var statusErr *statusError
+	return err == nil || errors.As(err, &statusErr)
+}
@@ -0,0 +1,105 @@
+package imds
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   *FakeServer
+		expected map[string][2]bool
+	}{
+		{
+			name:   "Every metadata service exposes credentials",
+			server: &FakeServer{},
+			expected: map[string][2]bool{
+				AWSIMDSv1: {true, true},
+				AWSIMDSv2: {true, true},
+				GCP:       {true, true},
+				Azure:     {true, true},
+			},
+		},
+		{
+			name:   "IMDSv2 required",
+			server: &FakeServer{RequireIMDSv2: true},
+			expected: map[string][2]bool{
+				AWSIMDSv1: {true, false},
+				AWSIMDSv2: {true, true},
+				GCP:       {true, true},
+				Azure:     {true, true},
+			},
+		},
+		{
+			name:   "No managed identity",
+			server: &FakeServer{NoIdentity: true},
+			expected: map[string][2]bool{
+				AWSIMDSv1: {true, false},
+				AWSIMDSv2: {true, false},
+				GCP:       {true, false},
+				Azure:     {true, false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(test.server)
+			defer server.Close()
+			p := NewProber(Addresses{AWS: server.URL, GCP: server.URL, Azure: server.URL}, time.Second)
+			results, err := p.Probe(context.Background(), nil)
+			require.NoError(t, err)
+
+			actual := make(map[string][2]bool)
+			for _, result := range results {
+				actual[result.Provider] = [2]bool{result.Reachable, result.Credentials}
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestProbeResult(t *testing.T) {
+	server := httptest.NewServer(&FakeServer{RequireIMDSv2: true})
+	defer server.Close()
+	p := NewProber(Addresses{AWS: server.URL}, time.Second)
+	results, err := p.Probe(context.Background(), []string{AWSIMDSv2, AWSIMDSv1})
+	require.NoError(t, err)
+	assert.Equal(t, []Result{
+		{
+			Provider:  AWSIMDSv1,
+			Address:   server.URL,
+			Reachable: true,
+			Message:   "GET /latest/meta-data/iam/security-credentials/ returned 401 Unauthorized",
+		},
+		{
+			Provider:    AWSIMDSv2,
+			Address:     server.URL,
+			Reachable:   true,
+			Identity:    "fake-node-role",
+			Credentials: true,
+			Expiration:  "2030-01-01T00:00:00Z",
+		},
+	}, results)
+
+	_, err = p.Probe(context.Background(), []string{"oracle"})
+	assert.EqualError(t, err, "Unknown provider oracle, expected one of aws-imdsv1, aws-imdsv2, gcp, azure")
+}
+
+func TestProbeUnreachable(t *testing.T) {
+	server := httptest.NewServer(&FakeServer{})
+	server.Close()
+	p := NewProber(Addresses{GCP: server.URL}, time.Second)
+	results, err := p.Probe(context.Background(), []string{GCP})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.False(t, results[0].Reachable)
+	assert.False(t, results[0].Credentials)
+	assert.NotEmpty(t, results[0].Message)
+}
@@ -73,6 +73,18 @@ func NewClientInContainer() (*Client, error) {
 	}
 
 	return &Client{
-		Clientset: clientset,
+		Clientset:  clientset,
+		RestConfig: config,
 	}, nil
 }
+
+// CurrentContext returns the name of the current context of the kubeconfig file
+func CurrentContext() (string, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{},
+	).RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("Failed to load kubeconfig: %w", err)
+	}
+	return config.CurrentContext, nil
+}
@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// DecodeManifests decodes the objects of YAML or JSON manifests, documents are separated by ---
+// and empty documents are skipped
+func DecodeManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var objects []*unstructured.Unstructured
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("Failed to decode manifest: %w", err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{Object: object}
+		if u.GetKind() == "" || u.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("Manifest %q is missing its apiVersion or kind", u.GetName())
+		}
+		objects = append(objects, u)
+	}
+}
+
+// Resources gives access to objects of any kind with the dynamic client
+type Resources struct {
+	Client dynamic.Interface
+	Mapper meta.RESTMapper
+}
+
+// NewResources returns Resources for the cluster of the client, kinds are mapped to resources
+// with the discovery API
+func (c *Client) NewResources() (*Resources, error) {
+	dynamicClient, err := dynamic.NewForConfig(c.RestConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create dynamic Kubernetes client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(c.RestConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Kubernetes discovery client: %w", err)
+	}
+	return &Resources{
+		Client: dynamicClient,
+		Mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}, nil
+}
+
+// For returns the resource interface of the kind of an object. Namespaced objects without a
+// namespace are put in the default namespace.
+func (r *Resources) For(object *unstructured.Unstructured, defaultNamespace string) (dynamic.ResourceInterface, error) {
+	gvk := object.GroupVersionKind()
+	mapping, err := r.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find the resource of %s: %w", gvk, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return r.Client.Resource(mapping.Resource), nil
+	}
+	if object.GetNamespace() == "" {
+		object.SetNamespace(defaultNamespace)
+	}
+	return r.Client.Resource(mapping.Resource).Namespace(object.GetNamespace()), nil
+}
+
+// WaitForPodRunning waits until a pod is running, or until the context is done
+func WaitForPodRunning(ctx context.Context, clientset kubernetes.Interface, namespace, name string, interval time.Duration) error {
+	return wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodSucceeded, corev1.PodFailed:
+			return false, fmt.Errorf("Pod %s/%s is %s", namespace, name, pod.Status.Phase)
+		}
+		return false, nil
+	})
+}
+
+// WaitForRunningPod waits until a pod matching the label selector is running and returns it, or
+// until the context is done
+func WaitForRunningPod(ctx context.Context, clientset kubernetes.Interface, namespace, selector string, interval time.Duration) (*corev1.Pod, error) {
+	var running *corev1.Pod
+	err := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+		for i, pod := range pods.Items {
+			if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+				running = &pods.Items[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return running, err
+}
@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WaitForExperiment waits until the deployments labelled with the experiment name are rolled out
+// and the cronjobs labelled with it finished their first job, or until the context is done
+func WaitForExperiment(ctx context.Context, clientset kubernetes.Interface, namespace, experiment string, interval time.Duration) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector: "experiment=" + experiment,
+	}
+	return wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, listOptions)
+		if err != nil {
+			return false, err
+		}
+		for _, deployment := range deployments.Items {
+			if !deploymentRolledOut(&deployment) {
+				return false, nil
+			}
+		}
+
+		cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(ctx, listOptions)
+		if err != nil {
+			return false, err
+		}
+		if len(cronJobs.Items) == 0 {
+			return true, nil
+		}
+		jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cronJob := range cronJobs.Items {
+			if !cronJobExecuted(&cronJob, jobs.Items) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// deploymentRolledOut reports whether all replicas of the latest deployment revision are available
+func deploymentRolledOut(deployment *appsv1.Deployment) bool {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return false
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.UpdatedReplicas >= replicas &&
+		status.Replicas == status.UpdatedReplicas &&
+		status.AvailableReplicas >= status.UpdatedReplicas
+}
+
+// cronJobExecuted reports whether a job of the cronjob has finished, successfully or not
+func cronJobExecuted(cronJob *batchv1.CronJob, jobs []batchv1.Job) bool {
+	if cronJob.Status.LastSuccessfulTime != nil {
+		return true
+	}
+	for _, job := range jobs {
+		if !metav1.IsControlledBy(&job, cronJob) {
+			continue
+		}
+		for _, condition := range job.Status.Conditions {
+			if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+				return true
+			}
+		}
+	}
+	return false
+}
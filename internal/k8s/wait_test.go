@@ -0,0 +1,87 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+)
+
+func TestWaitForExperiment(t *testing.T) {
+	labels := map[string]string{"experiment": "test"}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Labels: labels, UID: types.UID("cronjob-uid")},
+	}
+	finishedJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-1",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(cronJob, batchv1.SchemeGroupVersion.WithKind("CronJob"))},
+		},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		expectReady bool
+	}{
+		{
+			name:        "No resources",
+			expectReady: true,
+		},
+		{
+			name: "Deployment rolled out",
+			objects: []runtime.Object{&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Labels: labels},
+				Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(1)},
+				Status:     appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+			}},
+			expectReady: true,
+		},
+		{
+			name: "Deployment not available",
+			objects: []runtime.Object{&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Labels: labels},
+				Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(1)},
+				Status:     appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1},
+			}},
+			expectReady: false,
+		},
+		{
+			name:        "CronJob without a job",
+			objects:     []runtime.Object{cronJob},
+			expectReady: false,
+		},
+		{
+			name:        "CronJob with a finished job",
+			objects:     []runtime.Object{cronJob, finishedJob},
+			expectReady: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := WaitForExperiment(ctx, fake.NewSimpleClientset(test.objects...), "default", "test", 10*time.Millisecond)
+			if test.expectReady {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
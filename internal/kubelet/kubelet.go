@@ -0,0 +1,177 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package kubelet probes the APIs of the kubelets of the nodes of a cluster, with and without a
+// service account token. Commands are never run, exec and run are probed with a pod that does
+// not exist, which the kubelet only looks up once the request is authorized.
+package kubelet
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Default ports of the kubelet
+const (
+	DefaultReadOnlyPort = 10255
+	DefaultPort         = 10250
+)
+
+// checkPod is the pod exec and run are probed with, expected not to exist
+const checkPod = "default/woodpecker-kubelet-check/check"
+
+// Endpoint is an endpoint of the kubelet API
+type Endpoint struct {
+	Name   string
+	Method string
+	Path   string
+	// ReadOnly is set for endpoints the read-only port serves too
+	ReadOnly bool
+	// Authorized reports whether the kubelet authorized a request, given its status
+	Authorized func(status int) bool
+}
+
+// ok is the authorization of endpoints listing pods
+func ok(status int) bool {
+	return status == http.StatusOK
+}
+
+// notDenied is the authorization of endpoints taking a pod, any answer but a denial means the
+// request went past authorization
+func notDenied(status int) bool {
+	return status != http.StatusUnauthorized && status != http.StatusForbidden && status != http.StatusMethodNotAllowed
+}
+
+// Endpoints lists the endpoints in the order they are probed
+var Endpoints = []Endpoint{
+	{Name: "pods", Method: http.MethodGet, Path: "/pods", ReadOnly: true, Authorized: ok},
+	{Name: "runningpods", Method: http.MethodGet, Path: "/runningpods/", ReadOnly: true, Authorized: ok},
+	{Name: "exec", Method: http.MethodPost, Path: "/exec/" + checkPod + "?command=true&output=1", Authorized: notDenied},
+	{Name: "run", Method: http.MethodPost, Path: "/run/" + checkPod + "?cmd=true", Authorized: notDenied},
+}
+
+// Node is a node whose kubelet is probed
+type Node struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// NodesFromList returns the nodes of a list, at their internal address
+func NodesFromList(list *corev1.NodeList) []Node {
+	var nodes []Node
+	for _, node := range list.Items {
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeInternalIP {
+				nodes = append(nodes, Node{Name: node.Name, Address: address.Address})
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// NodeResult is the outcome of probing the kubelet of a node
+type NodeResult struct {
+	Node    string   `json:"node"`
+	Address string   `json:"address"`
+	Results []Result `json:"results"`
+}
+
+// Result is the outcome of probing an endpoint on a port of the kubelet
+type Result struct {
+	Port     int    `json:"port"`
+	Endpoint string `json:"endpoint"`
+	// Token is set when the request carried the service account token
+	Token bool `json:"token"`
+	// Status is the status the kubelet answered with, 0 when it could not be reached
+	Status int `json:"status,omitempty"`
+	// Allowed is set when the kubelet authorized the request
+	Allowed bool   `json:"allowed"`
+	Message string `json:"message,omitempty"`
+}
+
+// Prober probes kubelets
+type Prober struct {
+	// ReadOnlyPort is served over HTTP without authentication, Port over HTTPS
+	ReadOnlyPort int
+	Port         int
+	// Token is the service account token, probes with a token are skipped when it is empty
+	Token  string
+	Client *http.Client
+}
+
+// NewProber returns a Prober for the default ports of the kubelet
+func NewProber(token string, timeout time.Duration) *Prober {
+	return &Prober{
+		ReadOnlyPort: DefaultReadOnlyPort,
+		Port:         DefaultPort,
+		Token:        token,
+		Client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				// Kubelets serve self-signed certificates by default
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	}
+}
+
+// Probe probes the endpoints of the kubelets of the nodes: on the read-only port without a token,
+// and on the authenticated port without and with the token
+func (p *Prober) Probe(ctx context.Context, nodes []Node) []NodeResult {
+	var results []NodeResult
+	for _, node := range nodes {
+		nodeResult := NodeResult{Node: node.Name, Address: node.Address}
+		for _, endpoint := range Endpoints {
+			if endpoint.ReadOnly {
+				nodeResult.Results = append(nodeResult.Results, p.probe(ctx, node, "http", p.ReadOnlyPort, endpoint, false))
+			}
+		}
+		for _, token := range []bool{false, true} {
+			if token && p.Token == "" {
+				continue
+			}
+			for _, endpoint := range Endpoints {
+				nodeResult.Results = append(nodeResult.Results, p.probe(ctx, node, "https", p.Port, endpoint, token))
+			}
+		}
+		results = append(results, nodeResult)
+	}
+	return results
+}
+
+func (p *Prober) probe(ctx context.Context, node Node, scheme string, port int, endpoint Endpoint, token bool) Result {
+	result := Result{Port: port, Endpoint: endpoint.Name, Token: token}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(node.Address, strconv.Itoa(port)), endpoint.Path)
+	request, err := http.NewRequestWithContext(ctx, endpoint.Method, url, nil)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if token {
+		request.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	response, err := p.Client.Do(request)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	defer response.Body.Close()
+	// The pods of the node are not kept
+	_, _ = io.Copy(io.Discard, response.Body)
+	result.Status = response.StatusCode
+	result.Allowed = endpoint.Authorized(response.StatusCode)
+	if !result.Allowed {
+		result.Message = response.Status
+	}
+	return result
+}
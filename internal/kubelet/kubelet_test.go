@@ -0,0 +1,114 @@
+package kubelet
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeKubelet answers like a kubelet letting anonymous requests list pods, and authenticated
+// requests exec but not run
+func fakeKubelet(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("Authorization") == "Bearer token"
+	switch {
+	case r.URL.Path == "/pods", r.URL.Path == "/runningpods/":
+		_, _ = w.Write([]byte(`{"kind":"PodList","items":[]}`))
+	case strings.HasPrefix(r.URL.Path, "/exec/") && token:
+		http.NotFound(w, r)
+	case strings.HasPrefix(r.URL.Path, "/exec/"), strings.HasPrefix(r.URL.Path, "/run/"):
+		if !token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Forbidden (user=system:serviceaccount:default:default, verb=create, resource=nodes, subresource(s)=[proxy])", http.StatusForbidden)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func port(t *testing.T, server *httptest.Server) int {
+	_, p, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(p)
+	require.NoError(t, err)
+	return port
+}
+
+func TestProbe(t *testing.T) {
+	readOnly := httptest.NewServer(http.HandlerFunc(fakeKubelet))
+	defer readOnly.Close()
+	authenticated := httptest.NewTLSServer(http.HandlerFunc(fakeKubelet))
+	defer authenticated.Close()
+
+	p := NewProber("token", time.Second)
+	p.ReadOnlyPort = port(t, readOnly)
+	p.Port = port(t, authenticated)
+	results := p.Probe(context.Background(), []Node{{Name: "node-1", Address: "127.0.0.1"}})
+	require.Len(t, results, 1)
+	assert.Equal(t, "node-1", results[0].Node)
+
+	actual := make(map[string]bool)
+	for _, result := range results[0].Results {
+		key := strconv.Itoa(result.Port) + "/" + result.Endpoint
+		if result.Token {
+			key += "/token"
+		}
+		actual[key] = result.Allowed
+	}
+	ro, rw := strconv.Itoa(p.ReadOnlyPort), strconv.Itoa(p.Port)
+	assert.Equal(t, map[string]bool{
+		ro + "/pods":              true,
+		ro + "/runningpods":       true,
+		rw + "/pods":              true,
+		rw + "/runningpods":       true,
+		rw + "/exec":              false,
+		rw + "/run":               false,
+		rw + "/pods/token":        true,
+		rw + "/runningpods/token": true,
+		rw + "/exec/token":        true,
+		rw + "/run/token":         false,
+	}, actual)
+	assert.Equal(t, "403 Forbidden", results[0].Results[9].Message)
+}
+
+func TestProbeUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(fakeKubelet))
+	server.Close()
+
+	p := NewProber("", time.Second)
+	p.ReadOnlyPort = port(t, server)
+	p.Port = port(t, server)
+	results := p.Probe(context.Background(), []Node{{Name: "node-1", Address: "127.0.0.1"}})
+	require.Len(t, results, 1)
+	// Without a token only the anonymous probes are made
+	require.Len(t, results[0].Results, 6)
+	for _, result := range results[0].Results {
+		assert.False(t, result.Allowed)
+		assert.Zero(t, result.Status)
+		assert.NotEmpty(t, result.Message)
+	}
+}
+
+func TestNodesFromList(t *testing.T) {
+	list := &corev1.NodeList{Items: []corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "node-1"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			}},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+	}}
+	assert.Equal(t, []Node{{Name: "node-1", Address: "10.0.0.1"}}, NodesFromList(list))
+}
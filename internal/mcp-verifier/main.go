@@ -15,23 +15,35 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/operantai/woodpecker/cmd/woodpecker-mcp-verifier/utils"
 	"github.com/operantai/woodpecker/cmd/woodpecker-mcp-verifier/vschema"
 	"github.com/operantai/woodpecker/internal/mcp-verifier/oauth"
 	"github.com/operantai/woodpecker/internal/output"
+	"github.com/operantai/woodpecker/internal/results"
 	"github.com/spf13/viper"
 	"golang.org/x/sync/errgroup"
 )
 
-const tmpFileDir = "/tmp/woodpecker"
-
 // RunClient entry point to start the MCP client connection
 func RunClient(ctx context.Context, serverURL string, protocol utils.MCMCPprotocol, cmdArgs *[]string, payloadPath, experimentType, name string) error {
 	output.WriteInfo("Using protocol: %s", protocol)
 
+	store, err := results.New(ctx, viper.GetString("RESULT_STORE"), viper.GetString("RESULT_STORE_PATH"))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	runID := uuid.NewString()
+	key := results.Key{RunID: runID, ExperimentType: experimentType, Experiment: name}
+	run := &results.Run{ID: runID, StartedAt: time.Now(), Experiments: []results.Key{key}}
+	if err := store.PutRun(ctx, run); err != nil {
+		return err
+	}
+
 	sValidator := vschema.NewVSchema()
-	mcpClient, err := NewMCPClient(WithValidator(sValidator), WithAIFormatter(viper.GetBool("USE_AI_FORMATTER")), WithExperimentType(experimentType), WithName(name))
+	mcpClient, err := NewMCPClient(WithValidator(sValidator), WithAIFormatter(viper.GetBool("USE_AI_FORMATTER")), WithExperimentType(experimentType), WithName(name), WithResultStore(store), WithRunID(runID))
 	if err != nil {
 		return err
 	}
@@ -39,11 +51,14 @@ func RunClient(ctx context.Context, serverURL string, protocol utils.MCMCPprotoc
 	if err != nil {
 		return err
 	}
-	transport := getTransport(serverURL, protocol, cmdArgs, mcpConfig.Config)
+	transport, err := getTransport(serverURL, protocol, cmdArgs, mcpConfig.Config)
+	if err != nil {
+		return err
+	}
 	client := mcp.NewClient(&mcp.Implementation{Name: "woodpecker-mcp-verifier", Version: "v1.0.0"}, nil)
 	cs, err := client.Connect(ctx, transport, nil)
 	if err != nil {
-		output.WriteFatal("Error initializing client: %v", err)
+		return fmt.Errorf("Error initializing client: %w", err)
 	}
 	defer cs.Close()
 
@@ -71,11 +86,14 @@ func RunClient(ctx context.Context, serverURL string, protocol utils.MCMCPprotoc
 		}
 
 	}
-	mergedPath, err := mergeTempJSONFilesStreaming(tmpFileDir, experimentType, name)
-	if err != nil {
+	if err := mergeStoredResults(ctx, store, key); err != nil {
+		return err
+	}
+	run.FinishedAt = time.Now()
+	if err := store.PutRun(ctx, run); err != nil {
 		return err
 	}
-	output.WriteInfo("Results saved in: %s", mergedPath)
+	output.WriteInfo("Results saved under run: %s", runID)
 	return nil
 }
 
@@ -130,7 +148,7 @@ func setupBulkOperation(ctx context.Context, cs *mcp.ClientSession, allTools *[]
 }
 
 // Configures the MCP protocol to use based on the user selection
-func getTransport(serverURL string, protocol utils.MCMCPprotocol, cmdArgs *[]string, mcpConfig utils.MCPConfigConnection) mcp.Transport {
+func getTransport(serverURL string, protocol utils.MCMCPprotocol, cmdArgs *[]string, mcpConfig utils.MCPConfigConnection) (mcp.Transport, error) {
 	opts := &oauth.HTTPTransportOptions{
 		Base: &http.Transport{
 			MaxIdleConns:        100,              // Max idle connections
@@ -142,25 +160,31 @@ func getTransport(serverURL string, protocol utils.MCMCPprotocol, cmdArgs *[]str
 	switch protocol {
 	case utils.STREAMABLEHTTP:
 		output.WriteInfo("Setting streamabale-http transport connection.")
-		hClient := GetHTTPClient(opts)
+		hClient, err := GetHTTPClient(opts)
+		if err != nil {
+			return nil, err
+		}
 		transport := &mcp.StreamableClientTransport{
 			Endpoint:   serverURL,
 			HTTPClient: hClient,
 		}
-		return transport
+		return transport, nil
 	case utils.SSE:
 		output.WriteWarning("Setting SSE transport connection. It will be deprecated soon")
-		hClient := GetHTTPClient(opts)
+		hClient, err := GetHTTPClient(opts)
+		if err != nil {
+			return nil, err
+		}
 		transport := &mcp.SSEClientTransport{
 			Endpoint:   serverURL,
 			HTTPClient: hClient,
 		}
-		return transport
+		return transport, nil
 	default:
 		output.WriteInfo("Setting a local STDIO transport connection.")
 		cmd := exec.Command((*cmdArgs)[0], (*cmdArgs)[1:]...)
 		transport := &mcp.CommandTransport{Command: cmd}
-		return transport
+		return transport, nil
 	}
 }
 
@@ -205,12 +229,14 @@ func (m *mcpClient) ToolCallWithPayload(ctx context.Context, cs IMCPClientSessio
 			return fmt.Errorf("failed to marshal experiment results: %w", err)
 		}
 		output.WriteInfo("Saving %s response ...", tool.Name)
-		file, err := createTempFile(m.experimentType, m.name)
-		if err != nil {
-			return fmt.Errorf("unable to create file cache for experiment results %w", err)
-		}
-
-		_, err = file.Write(resultJSON)
+		err = m.resultStore.Put(ctx, &results.Result{
+			Key: results.Key{
+				RunID:          m.runID,
+				ExperimentType: m.experimentType,
+				Experiment:     m.name,
+			},
+			Data: resultJSON,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to write experiment results: %w", err)
 		}
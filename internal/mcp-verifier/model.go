@@ -9,18 +9,21 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/operantai/woodpecker/cmd/woodpecker-mcp-verifier/utils"
 	"github.com/operantai/woodpecker/cmd/woodpecker-mcp-verifier/vschema"
 	"github.com/operantai/woodpecker/internal/mcp-verifier/oauth"
 	"github.com/operantai/woodpecker/internal/output"
+	"github.com/operantai/woodpecker/internal/results"
 	"github.com/spf13/viper"
 	"github.com/tmc/langchaingo/llms/openai"
 )
 
 var (
-	httpClient *http.Client
-	once       sync.Once
+	httpClient    *http.Client
+	httpClientErr error
+	once          sync.Once
 )
 
 type HeaderTransport struct {
@@ -37,19 +40,20 @@ func (t *HeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 // GetHTTPClient returns a singleton instance of http.Client.
-func GetHTTPClient(opts *oauth.HTTPTransportOptions) *http.Client {
+func GetHTTPClient(opts *oauth.HTTPTransportOptions) (*http.Client, error) {
 
 	once.Do(func() {
 		transport, err := oauth.NewHTTPTransport(oauth.OauthHandler, opts)
 		if err != nil {
-			output.WriteFatal("An error performing the Oauth flow happened: %v", err)
+			httpClientErr = fmt.Errorf("An error performing the Oauth flow happened: %w", err)
+			return
 		}
 		httpClient = &http.Client{
 			Timeout:   30 * time.Second,
 			Transport: transport,
 		}
 	})
-	return httpClient
+	return httpClient, httpClientErr
 }
 
 type IMCPClient interface {
@@ -65,6 +69,8 @@ type mcpClient struct {
 	useAi          bool
 	name           string
 	experimentType string
+	resultStore    results.ResultStore
+	runID          string
 }
 
 type Option func(*mcpClient)
@@ -93,14 +99,41 @@ func WithExperimentType(experimentType string) Option {
 	}
 }
 
+func WithResultStore(store results.ResultStore) Option {
+	return func(mc *mcpClient) {
+		mc.resultStore = store
+	}
+}
+
+func WithRunID(runID string) Option {
+	return func(mc *mcpClient) {
+		mc.runID = runID
+	}
+}
+
 func NewMCPClient(options ...Option) (IMCPClient, error) {
-	mc := &mcpClient{}
+	mc := &mcpClient{
+		experimentType: "woodpecker",
+		name:           "mcp-verifier",
+	}
 
 	// Apply optional configurations
 	for _, option := range options {
 		option(mc)
 	}
 
+	// Results are saved under their own run in the local result store unless told otherwise
+	if mc.runID == "" {
+		mc.runID = uuid.NewString()
+	}
+	if mc.resultStore == nil {
+		store, err := results.NewLocalStore(results.DefaultLocalDir)
+		if err != nil {
+			return nil, err
+		}
+		mc.resultStore = store
+	}
+
 	// Current module implementation of structure output is not that dynamic for the current needs where we dont
 	// know the input schema format in advance and we want to leverage it to test the tool
 	// Also you can pass the WOODPECKER_LLM_BASE_URL and should work with any OpenAI compatible APIs. You can use the
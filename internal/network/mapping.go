@@ -0,0 +1,309 @@
+/*
+Copyright 2023 Operant AI
+*/
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Defaults of mapping requests
+var (
+	DefaultMappingNamespaces = []string{"default", "kube-system"}
+	DefaultMappingServices   = []string{
+		"kubernetes", "kube-dns", "metrics-server", "kubernetes-dashboard", "prometheus", "grafana",
+		"alertmanager", "elasticsearch", "kibana", "redis", "postgres", "postgresql", "mysql",
+		"mongodb", "rabbitmq", "kafka", "vault", "argocd-server", "jenkins", "registry",
+	}
+	DefaultMappingPortNames = []string{"http", "https", "grpc", "metrics", "dns-tcp"}
+	DefaultMappingPorts     = []int{22, 53, 80, 443, 2379, 3306, 5432, 6379, 6443, 8080, 9090, 10250}
+)
+
+const (
+	defaultMaxHosts    = 256
+	defaultConcurrency = 32
+	// maxBannerLength bounds the banners kept from open ports
+	maxBannerLength = 128
+)
+
+// MappingRequest asks the executor server to map the network of the cluster
+type MappingRequest struct {
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+	// Namespaces and Services are the names looked up in the cluster DNS, as
+	// <service>.<namespace>.svc.<clusterDomain>, with SRV lookups of the PortNames of those found
+	Namespaces []string `json:"namespaces,omitempty"`
+	Services   []string `json:"services,omitempty"`
+	PortNames  []string `json:"portNames,omitempty"`
+	// CIDRs are scanned for the Ports, up to MaxHosts hosts in total
+	CIDRs       []string `json:"cidrs,omitempty"`
+	Ports       []int    `json:"ports,omitempty"`
+	MaxHosts    int      `json:"maxHosts,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"`
+	// Banners grabs the banners of open ports
+	Banners bool `json:"banners,omitempty"`
+	// Timeout bounds every lookup and connection, as a duration
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// DNSRecord is a name found in the cluster DNS
+type DNSRecord struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Values []string `json:"values"`
+}
+
+// OpenPort is a port that accepted a connection
+type OpenPort struct {
+	Port   int    `json:"port"`
+	Banner string `json:"banner,omitempty"`
+}
+
+// Host is a scanned address with open ports
+type Host struct {
+	Address string     `json:"address"`
+	Ports   []OpenPort `json:"ports"`
+}
+
+// MappingResult is what the mapping found
+type MappingResult struct {
+	Records []DNSRecord `json:"records"`
+	Hosts   []Host      `json:"hosts"`
+	// Scanned is the number of hosts scanned, Truncated is set when the CIDRs had more than the
+	// maximum number of hosts
+	Scanned   int  `json:"scanned"`
+	Truncated bool `json:"truncated"`
+	// DNSFailures, TCPFailures and BannerFailures count the lookups, connections and banner reads
+	// that failed
+	DNSFailures    Failures `json:"dnsFailures"`
+	TCPFailures    Failures `json:"tcpFailures"`
+	BannerFailures Failures `json:"bannerFailures"`
+}
+
+// Failures counts the failed lookups or connections of a stage of the mapping. Names that do not
+// exist and other failures are not counted.
+type Failures struct {
+	// Refused counts those refused or reset, as when a policy rejects them
+	Refused int `json:"refused"`
+	// TimedOut counts those without an answer in time, as when the host does not exist or a
+	// policy drops them
+	TimedOut int `json:"timedOut"`
+}
+
+// record counts a failure
+func (f *Failures) record(err error) {
+	switch {
+	case err == nil:
+	case isTimeout(err):
+		f.TimedOut++
+	case IsRefused(err):
+		f.Refused++
+	}
+}
+
+// IsRefused reports whether a lookup or connection was refused or reset. A DNS server answering
+// with an error other than the name not existing, e.g. REFUSED, refused the lookup.
+func IsRefused(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && !dnsErr.IsNotFound && !dnsErr.IsTimeout
+}
+
+// isTimeout reports whether a lookup or connection got no answer in time
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Mapper maps the network of a cluster
+type Mapper struct {
+	Timeout time.Duration
+	// LookupHost and LookupSRV resolve names, with the resolver of the pod by default
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+	LookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// NewMapper returns a Mapper whose every lookup and connection is bounded by the timeout
+func NewMapper(timeout time.Duration) *Mapper {
+	return &Mapper{
+		Timeout:    timeout,
+		LookupHost: net.DefaultResolver.LookupHost,
+		LookupSRV:  net.DefaultResolver.LookupSRV,
+	}
+}
+
+// Map enumerates the cluster DNS, then scans the CIDRs of the request
+func (m *Mapper) Map(ctx context.Context, request MappingRequest) (*MappingResult, error) {
+	hosts, truncated, err := expandCIDRs(request.CIDRs, withDefaultInt(request.MaxHosts, defaultMaxHosts))
+	if err != nil {
+		return nil, err
+	}
+	result := &MappingResult{Scanned: len(hosts), Truncated: truncated}
+	result.Records = m.enumerate(ctx, request, &result.DNSFailures)
+	result.Hosts = m.scan(ctx, hosts, request, &result.TCPFailures, &result.BannerFailures)
+	return result, nil
+}
+
+func withDefault[T any](value []T, defaultValue []T) []T {
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func withDefaultInt(value, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// enumerate looks up the services in every namespace, then the SRV records of the named ports of
+// the services found, counting the failed lookups
+func (m *Mapper) enumerate(ctx context.Context, request MappingRequest, failures *Failures) []DNSRecord {
+	clusterDomain := request.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = "cluster.local"
+	}
+	var records []DNSRecord
+	for _, namespace := range withDefault(request.Namespaces, DefaultMappingNamespaces) {
+		for _, service := range withDefault(request.Services, DefaultMappingServices) {
+			name := fmt.Sprintf("%s.%s.svc.%s", service, namespace, clusterDomain)
+			lookupCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+			addresses, err := m.LookupHost(lookupCtx, name)
+			cancel()
+			failures.record(err)
+			if err != nil || len(addresses) == 0 {
+				continue
+			}
+			records = append(records, DNSRecord{Name: name, Type: "A", Values: addresses})
+
+			for _, portName := range withDefault(request.PortNames, DefaultMappingPortNames) {
+				lookupCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+				_, srvs, err := m.LookupSRV(lookupCtx, portName, "tcp", name)
+				cancel()
+				failures.record(err)
+				if err != nil || len(srvs) == 0 {
+					continue
+				}
+				var values []string
+				for _, srv := range srvs {
+					values = append(values, fmt.Sprintf("%s:%d", strings.TrimSuffix(srv.Target, "."), srv.Port))
+				}
+				records = append(records, DNSRecord{Name: fmt.Sprintf("_%s._tcp.%s", portName, name), Type: "SRV", Values: values})
+			}
+		}
+	}
+	return records
+}
+
+// expandCIDRs returns the addresses of the CIDRs, up to maxHosts of them
+func expandCIDRs(cidrs []string, maxHosts int) ([]netip.Addr, bool, error) {
+	var hosts []netip.Addr
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid CIDR %s: %w", cidr, err)
+		}
+		for addr := prefix.Masked().Addr(); prefix.Contains(addr); addr = addr.Next() {
+			if len(hosts) == maxHosts {
+				return hosts, true, nil
+			}
+			hosts = append(hosts, addr)
+		}
+	}
+	return hosts, false, nil
+}
+
+// scan connects to the ports of every host, a bounded number of connections at a time, counting
+// the failed connections and banner reads
+func (m *Mapper) scan(ctx context.Context, hosts []netip.Addr, request MappingRequest, failures, bannerFailures *Failures) []Host {
+	ports := withDefault(request.Ports, DefaultMappingPorts)
+	open := make(map[netip.Addr][]OpenPort)
+	var mu sync.Mutex
+	var eg errgroup.Group
+	eg.SetLimit(withDefaultInt(request.Concurrency, defaultConcurrency))
+	for _, host := range hosts {
+		for _, port := range ports {
+			eg.Go(func() error {
+				conn, err := m.dial(ctx, host, port)
+				if err != nil {
+					mu.Lock()
+					failures.record(err)
+					mu.Unlock()
+					return nil
+				}
+				defer conn.Close()
+				openPort := OpenPort{Port: port}
+				var bannerErr error
+				if request.Banners {
+					openPort.Banner, bannerErr = grabBanner(conn, m.Timeout)
+				}
+				mu.Lock()
+				open[host] = append(open[host], openPort)
+				bannerFailures.record(bannerErr)
+				mu.Unlock()
+				return nil
+			})
+		}
+	}
+	_ = eg.Wait()
+
+	var result []Host
+	for _, host := range hosts {
+		if ports, ok := open[host]; ok {
+			slices.SortFunc(ports, func(a, b OpenPort) int { return a.Port - b.Port })
+			result = append(result, Host{Address: host.String(), Ports: ports})
+		}
+	}
+	return result
+}
+
+// dial connects to a port, which is open when it succeeds
+func (m *Mapper) dial(ctx context.Context, host netip.Addr, port int) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: m.Timeout}
+	return dialer.DialContext(ctx, "tcp", net.JoinHostPort(host.String(), strconv.Itoa(port)))
+}
+
+// grabBanner reads what the server sends first, or what it answers to an HTTP request when it
+// waits for the client, keeping only the first line. The error is returned when nothing could be
+// read.
+func grabBanner(conn net.Conn, timeout time.Duration) (string, error) {
+	buf := make([]byte, 256)
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	n, err := conn.Read(buf)
+	if n == 0 && err != nil {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+		if _, err := conn.Write([]byte("HEAD / HTTP/1.0\r\n\r\n")); err != nil {
+			return "", err
+		}
+		if n, err = conn.Read(buf); n == 0 && err != nil {
+			return "", err
+		}
+	}
+	line, _, _ := strings.Cut(string(buf[:n]), "\n")
+	line = strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, line)
+	if len(line) > maxBannerLength {
+		line = line[:maxBannerLength]
+	}
+	return strings.TrimSpace(line), nil
+}
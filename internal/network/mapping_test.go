@@ -0,0 +1,120 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenPort returns the port of a listener on the loopback address
+func listenPort(t *testing.T, l net.Listener) int {
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return p
+}
+
+func TestMap(t *testing.T) {
+	// A server greeting its clients, like SSH
+	ssh, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ssh.Close()
+	go func() {
+		for {
+			conn, err := ssh.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+	web := httptest.NewServer(http.NotFoundHandler())
+	defer web.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed.Close()
+
+	m := NewMapper(500 * time.Millisecond)
+	m.LookupHost = func(ctx context.Context, host string) ([]string, error) {
+		switch host {
+		case "kubernetes.default.svc.cluster.local":
+			return []string{"10.96.0.1"}, nil
+		case "vault.default.svc.cluster.local":
+			// The DNS server refuses to answer
+			return nil, &net.DNSError{Err: "server misbehaving", Name: host}
+		case "redis.default.svc.cluster.local":
+			return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	m.LookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if service == "https" && name == "kubernetes.default.svc.cluster.local" {
+			return "", []*net.SRV{{Target: "kubernetes.default.svc.cluster.local.", Port: 443}}, nil
+		}
+		return "", nil, errors.New("no such host")
+	}
+
+	sshPort, webPort := listenPort(t, ssh), listenPort(t, web.Listener)
+	result, err := m.Map(context.Background(), MappingRequest{
+		Namespaces: []string{"default"},
+		Services:   []string{"kubernetes", "vault", "redis", "grafana"},
+		CIDRs:      []string{"127.0.0.1/32"},
+		Ports:      []int{sshPort, webPort, listenPort(t, closed)},
+		Banners:    true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []DNSRecord{
+		{Name: "kubernetes.default.svc.cluster.local", Type: "A", Values: []string{"10.96.0.1"}},
+		{Name: "_https._tcp.kubernetes.default.svc.cluster.local", Type: "SRV", Values: []string{"kubernetes.default.svc.cluster.local:443"}},
+	}, result.Records)
+	assert.Equal(t, 1, result.Scanned)
+	assert.False(t, result.Truncated)
+
+	expected := []OpenPort{{Port: sshPort, Banner: "SSH-2.0-OpenSSH_9.6"}, {Port: webPort, Banner: "HTTP/1.0 404 Not Found"}}
+	if webPort < sshPort {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+	assert.Equal(t, []Host{{Address: "127.0.0.1", Ports: expected}}, result.Hosts)
+	// Names that do not exist are not failures, the closed port refused its connection
+	assert.Equal(t, Failures{Refused: 1, TimedOut: 1}, result.DNSFailures)
+	assert.Equal(t, Failures{Refused: 1}, result.TCPFailures)
+	assert.Equal(t, Failures{}, result.BannerFailures)
+}
+
+func TestIsRefused(t *testing.T) {
+	assert.True(t, IsRefused(fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED)))
+	assert.True(t, IsRefused(&net.OpError{Op: "read", Err: syscall.ECONNRESET}))
+	assert.True(t, IsRefused(&net.DNSError{Err: "server misbehaving"}))
+	assert.False(t, IsRefused(&net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.False(t, IsRefused(context.DeadlineExceeded))
+	assert.False(t, IsRefused(errors.New("no route to host")))
+}
+
+func TestExpandCIDRs(t *testing.T) {
+	hosts, truncated, err := expandCIDRs([]string{"10.96.0.0/30", "10.244.0.7/32"}, 10)
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Len(t, hosts, 5)
+	assert.Equal(t, "10.244.0.7", hosts[4].String())
+
+	hosts, truncated, err = expandCIDRs([]string{"10.96.0.0/12"}, 256)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.Len(t, hosts, 256)
+
+	_, _, err = expandCIDRs([]string{"10.96.0.0"}, 256)
+	assert.ErrorContains(t, err, "Invalid CIDR 10.96.0.0")
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package network probes the network of a cluster from within a pod: whether Services and Pods
+// of other namespaces are reachable, and how much of the cluster can be mapped.
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Protocols of reachability probes
+const (
+	TCP  = "tcp"
+	HTTP = "http"
+	DNS  = "dns"
+)
+
+// Protocols lists the protocols in the order they are probed
+var Protocols = []string{TCP, HTTP, DNS}
+
+// Kinds of targets
+const (
+	ServiceTarget = "service"
+	PodTarget     = "pod"
+)
+
+// Target is a port of a Service or Pod
+type Target struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Port      int    `json:"port"`
+	// DNSName is the name of a Service in the cluster DNS
+	DNSName string `json:"dnsName,omitempty"`
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s/%s/%s:%d", t.Namespace, t.Kind, t.Name, t.Port)
+}
+
+// ServiceTargets returns a target per TCP port of the Services with a cluster IP, up to limit
+// targets when limit is positive
+func ServiceTargets(services []corev1.Service, clusterDomain string, limit int) []Target {
+	var targets []Target
+	for _, service := range services {
+		if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone {
+			continue
+		}
+		for _, port := range service.Spec.Ports {
+			if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+				continue
+			}
+			if limit > 0 && len(targets) == limit {
+				return targets
+			}
+			targets = append(targets, Target{
+				Namespace: service.Namespace,
+				Kind:      ServiceTarget,
+				Name:      service.Name,
+				Address:   service.Spec.ClusterIP,
+				Port:      int(port.Port),
+				DNSName:   fmt.Sprintf("%s.%s.svc.%s", service.Name, service.Namespace, clusterDomain),
+			})
+		}
+	}
+	return targets
+}
+
+// PodTargets returns a target per TCP container port of the running Pods not on the host network,
+// up to limit targets when limit is positive
+func PodTargets(pods []corev1.Pod, limit int) []Target {
+	var targets []Target
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.Spec.HostNetwork {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			for _, port := range container.Ports {
+				if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+					continue
+				}
+				if limit > 0 && len(targets) == limit {
+					return targets
+				}
+				targets = append(targets, Target{
+					Namespace: pod.Namespace,
+					Kind:      PodTarget,
+					Name:      pod.Name,
+					Address:   pod.Status.PodIP,
+					Port:      int(port.ContainerPort),
+				})
+			}
+		}
+	}
+	return targets
+}
+
+// ReachabilityRequest asks the executor server to probe targets
+type ReachabilityRequest struct {
+	Targets   []Target `json:"targets"`
+	Protocols []string `json:"protocols,omitempty"`
+	// Timeout bounds every probe, as a duration
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ProtocolResult is the outcome of probing a target with a protocol
+type ProtocolResult struct {
+	Protocol  string `json:"protocol"`
+	Reachable bool   `json:"reachable"`
+	Message   string `json:"message,omitempty"`
+}
+
+// ReachabilityResult is the outcome of probing a target
+type ReachabilityResult struct {
+	Target Target `json:"target"`
+	// Reachable is set when the target accepted a TCP connection or answered an HTTP request,
+	// resolving its name does not make it reachable
+	Reachable bool             `json:"reachable"`
+	Protocols []ProtocolResult `json:"protocols"`
+}
+
+// Prober probes targets
+type Prober struct {
+	Timeout time.Duration
+	// LookupHost resolves names, with the resolver of the pod by default
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// NewProber returns a Prober whose every probe is bounded by the timeout
+func NewProber(timeout time.Duration) *Prober {
+	return &Prober{Timeout: timeout, LookupHost: net.DefaultResolver.LookupHost}
+}
+
+// validProtocols returns the protocols, all of them by default
+func validProtocols(protocols []string) ([]string, error) {
+	if len(protocols) == 0 {
+		return Protocols, nil
+	}
+	for _, protocol := range protocols {
+		if !slices.Contains(Protocols, protocol) {
+			return nil, fmt.Errorf("Unknown protocol %s, expected one of %s", protocol, strings.Join(Protocols, ", "))
+		}
+	}
+	return protocols, nil
+}
+
+// Reach probes every target with the protocols, all of them by default
+func (p *Prober) Reach(ctx context.Context, targets []Target, protocols []string) ([]ReachabilityResult, error) {
+	protocols, err := validProtocols(protocols)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout: p.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var results []ReachabilityResult
+	for _, target := range targets {
+		result := ReachabilityResult{Target: target}
+		address := net.JoinHostPort(target.Address, strconv.Itoa(target.Port))
+		for _, protocol := range Protocols {
+			if !slices.Contains(protocols, protocol) {
+				continue
+			}
+			var err error
+			switch protocol {
+			case TCP:
+				err = p.dial(ctx, address)
+			case HTTP:
+				err = p.get(ctx, client, address)
+			case DNS:
+				// Only Services have a name in the cluster DNS
+				if target.DNSName == "" {
+					continue
+				}
+				err = p.lookup(ctx, target)
+			}
+			protocolResult := ProtocolResult{Protocol: protocol, Reachable: err == nil}
+			if err != nil {
+				protocolResult.Message = err.Error()
+			}
+			if protocolResult.Reachable && protocol != DNS {
+				result.Reachable = true
+			}
+			result.Protocols = append(result.Protocols, protocolResult)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (p *Prober) dial(ctx context.Context, address string) error {
+	dialer := net.Dialer{Timeout: p.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// get sends an HTTP request, any answer means the target is reachable
+func (p *Prober) get(ctx context.Context, client *http.Client, address string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+"/", nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (p *Prober) lookup(ctx context.Context, target Target) error {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	addresses, err := p.LookupHost(ctx, target.DNSName)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(addresses, target.Address) {
+		return fmt.Errorf("%s resolved to %s rather than %s", target.DNSName, strings.Join(addresses, ", "), target.Address)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testTarget returns a service target at the address of a test server
+func testTarget(t *testing.T, name, address string) Target {
+	host, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return Target{Namespace: "payments", Kind: ServiceTarget, Name: name, Address: host, Port: p, DNSName: name + ".payments.svc.cluster.local"}
+}
+
+func TestReach(t *testing.T) {
+	open := httptest.NewServer(http.NotFoundHandler())
+	defer open.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	p := NewProber(time.Second)
+	p.LookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host == "api.payments.svc.cluster.local" {
+			return []string{"127.0.0.1"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	targets := []Target{testTarget(t, "api", open.Listener.Addr().String()), testTarget(t, "db", closed.Listener.Addr().String())}
+	pod := targets[0]
+	pod.Kind, pod.DNSName = PodTarget, ""
+	targets = append(targets, pod)
+
+	results, err := p.Reach(context.Background(), targets, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	protocols := func(result ReachabilityResult) map[string]bool {
+		actual := make(map[string]bool)
+		for _, protocol := range result.Protocols {
+			actual[protocol.Protocol] = protocol.Reachable
+		}
+		return actual
+	}
+	assert.True(t, results[0].Reachable)
+	assert.Equal(t, map[string]bool{TCP: true, HTTP: true, DNS: true}, protocols(results[0]))
+	assert.False(t, results[1].Reachable)
+	assert.Equal(t, map[string]bool{TCP: false, HTTP: false, DNS: false}, protocols(results[1]))
+	// Pods have no name to resolve
+	assert.Equal(t, map[string]bool{TCP: true, HTTP: true}, protocols(results[2]))
+
+	results, err = p.Reach(context.Background(), targets[:1], []string{DNS})
+	require.NoError(t, err)
+	assert.False(t, results[0].Reachable, "resolving a name does not make a target reachable")
+
+	_, err = p.Reach(context.Background(), targets, []string{"udp"})
+	assert.EqualError(t, err, "Unknown protocol udp, expected one of tcp, http, dns")
+}
+
+func TestTargets(t *testing.T) {
+	services := []corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+			Spec: corev1.ServiceSpec{ClusterIP: "10.96.0.10", Ports: []corev1.ServicePort{
+				{Port: 80, Protocol: corev1.ProtocolTCP},
+				{Port: 53, Protocol: corev1.ProtocolUDP},
+				{Port: 443},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "headless", Namespace: "payments"},
+			Spec:       corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone, Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+	}
+	assert.Equal(t, []Target{
+		{Namespace: "payments", Kind: ServiceTarget, Name: "api", Address: "10.96.0.10", Port: 80, DNSName: "api.payments.svc.cluster.local"},
+		{Namespace: "payments", Kind: ServiceTarget, Name: "api", Address: "10.96.0.10", Port: 443, DNSName: "api.payments.svc.cluster.local"},
+	}, ServiceTargets(services, "cluster.local", 0))
+	assert.Len(t, ServiceTargets(services, "cluster.local", 1), 1)
+
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-0", Namespace: "payments"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Ports: []corev1.ContainerPort{{ContainerPort: 8080}}}}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.244.0.5"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-1", Namespace: "payments"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Ports: []corev1.ContainerPort{{ContainerPort: 8080}}}}},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+	}
+	assert.Equal(t, []Target{
+		{Namespace: "payments", Kind: PodTarget, Name: "api-0", Address: "10.244.0.5", Port: 8080},
+	}, PodTargets(pods, 0))
+}
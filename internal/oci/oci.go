@@ -0,0 +1,289 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package oci pulls the files of OCI artifacts from container registries, e.g. experiment suites
+// pushed with `oras push`.
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Media types of the manifests an artifact can be pulled from
+const (
+	MediaTypeImageManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// AnnotationTitle is the annotation naming the file a layer holds
+const AnnotationTitle = "org.opencontainers.image.title"
+
+// maxSize limits the size of the manifests and files that are pulled
+const maxSize = 16 << 20
+
+// Reference names an artifact in a registry, by tag or digest
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	// Digest pins the manifest of the artifact, e.g. sha256:<hex>
+	Digest string
+}
+
+// ParseReference parses references such as ghcr.io/org/suite:v1 or
+// ghcr.io/org/suite@sha256:<hex>. The tag defaults to latest.
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	registry, repository, ok := strings.Cut(s, "/")
+	if !ok || registry == "" || repository == "" {
+		return ref, fmt.Errorf("Invalid OCI reference %q, expected <registry>/<repository>[:<tag>|@<digest>]", s)
+	}
+	ref.Registry = registry
+	if name, digest, ok := strings.Cut(repository, "@"); ok {
+		if !strings.HasPrefix(digest, "sha256:") {
+			return ref, fmt.Errorf("Invalid OCI reference %q, only sha256 digests are supported", s)
+		}
+		ref.Digest = digest
+		repository = name
+	}
+	// The tag follows the last colon after the last slash, a colon before it is a registry port
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		ref.Tag = repository[i+1:]
+		repository = repository[:i]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	ref.Repository = repository
+	return ref, nil
+}
+
+// String returns the reference in the form it is parsed from
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// File is a file held by a layer of an artifact
+type File struct {
+	// Name is the title annotation of the layer, or its digest if it has none
+	Name     string
+	Contents []byte
+}
+
+// Client pulls artifacts from registries over HTTPS
+type Client struct {
+	// HTTPClient sends the requests, http.DefaultClient by default
+	HTTPClient *http.Client
+	// Username and Password authenticate to the registry, anonymous if empty
+	Username string
+	Password string
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Pull returns the files of the layers of an artifact. The digests of the manifest, if the
+// reference has one, and of every layer are verified.
+func (c *Client) Pull(ctx context.Context, ref Reference) ([]File, error) {
+	manifestRef := ref.Tag
+	if ref.Digest != "" {
+		manifestRef = ref.Digest
+	}
+	body, err := c.get(ctx, ref, "manifests/"+manifestRef, strings.Join([]string{MediaTypeImageManifest, MediaTypeDockerManifest}, ", "))
+	if err != nil {
+		return nil, err
+	}
+	if ref.Digest != "" {
+		if err := VerifyDigest(body, ref.Digest); err != nil {
+			return nil, fmt.Errorf("Manifest of %s: %w", ref, err)
+		}
+	}
+	var m manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("Failed to parse manifest of %s: %w", ref, err)
+	}
+
+	files := make([]File, 0, len(m.Layers))
+	for _, layer := range m.Layers {
+		contents, err := c.get(ctx, ref, "blobs/"+layer.Digest, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := VerifyDigest(contents, layer.Digest); err != nil {
+			return nil, fmt.Errorf("Layer of %s: %w", ref, err)
+		}
+		name := layer.Annotations[AnnotationTitle]
+		if name == "" {
+			name = layer.Digest
+		}
+		files = append(files, File{Name: name, Contents: contents})
+	}
+	return files, nil
+}
+
+// get requests a path of the repository, authenticating with a bearer token if the registry asks
+// for one
+func (c *Client) get(ctx context.Context, ref Reference, path, accept string) ([]byte, error) {
+	endpoint := fmt.Sprintf("https://%s/v2/%s/%s", ref.Registry, ref.Repository, path)
+	resp, err := c.do(ctx, endpoint, accept, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := c.token(ctx, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to authenticate to %s: %w", ref.Registry, err)
+		}
+		if resp, err = c.do(ctx, endpoint, accept, token); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to get %s: %s", endpoint, resp.Status)
+	}
+	return readAll(resp.Body)
+}
+
+func (c *Client) do(ctx context.Context, endpoint, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// token requests a bearer token from the realm of a WWW-Authenticate challenge
+func (c *Client) token(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("Unsupported authentication challenge %q", challenge)
+	}
+	values := parseChallenge(params)
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("Invalid realm in authentication challenge %q", challenge)
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if values[key] != "" {
+			query.Set(key, values[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	resp, err := c.do(ctx, realm.String(), "", "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token request failed: %s", resp.Status)
+	}
+	body, err := readAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("Failed to parse token response: %w", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	return "", errors.New("Token response does not contain a token")
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a challenge
+func parseChallenge(params string) map[string]string {
+	values := make(map[string]string)
+	for params != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, params = rest[1:end+1], rest[end+2:]
+		} else {
+			value, params, _ = strings.Cut(rest, ",")
+		}
+		values[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return values
+}
+
+// VerifyDigest checks that contents match a sha256:<hex> digest
+func VerifyDigest(contents []byte, digest string) error {
+	expected, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok {
+		return fmt.Errorf("Unsupported digest %q, only sha256 digests are supported", digest)
+	}
+	sum := sha256.Sum256(contents)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("Digest mismatch, expected sha256:%s, got sha256:%s", expected, actual)
+	}
+	return nil
+}
+
+func readAll(r io.Reader) ([]byte, error) {
+	contents, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) > maxSize {
+		return nil, fmt.Errorf("Response is larger than %d bytes", maxSize)
+	}
+	return contents, nil
+}
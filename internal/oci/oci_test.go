@@ -0,0 +1,124 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		reference   string
+		expected    Reference
+		expectError bool
+	}{
+		{reference: "ghcr.io/org/suite:v1", expected: Reference{Registry: "ghcr.io", Repository: "org/suite", Tag: "v1"}},
+		{reference: "ghcr.io/org/suite", expected: Reference{Registry: "ghcr.io", Repository: "org/suite", Tag: "latest"}},
+		{reference: "localhost:5000/suite@" + digest, expected: Reference{Registry: "localhost:5000", Repository: "suite", Digest: digest}},
+		{reference: "ghcr.io/org/suite:v1@" + digest, expected: Reference{Registry: "ghcr.io", Repository: "org/suite", Tag: "v1", Digest: digest}},
+		{reference: "suite", expectError: true},
+		{reference: "ghcr.io/org/suite@md5:abc", expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.reference, func(t *testing.T) {
+			ref, err := ParseReference(test.reference)
+			if test.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, ref)
+			assert.Equal(t, test.reference, strings.TrimSuffix(ref.String(), ":latest"))
+		})
+	}
+}
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestPull(t *testing.T) {
+	layer := []byte("experiments: []\n")
+	manifestBody, err := json.Marshal(manifest{
+		MediaType: MediaTypeImageManifest,
+		Layers: []descriptor{{
+			MediaType:   "application/yaml",
+			Digest:      digestOf(layer),
+			Size:        int64(len(layer)),
+			Annotations: map[string]string{AnnotationTitle: "suite.yaml"},
+		}},
+	})
+	require.NoError(t, err)
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:org/suite:pull", r.URL.Query().Get("scope"))
+			_, _ = w.Write([]byte(`{"token": "secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:org/suite:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		// The manifest pinned with the digest of other contents has been tampered with
+		case "/v2/org/suite/manifests/v1", "/v2/org/suite/manifests/" + digestOf(manifestBody), "/v2/org/suite/manifests/" + digestOf([]byte("other")):
+			w.Header().Set("Content-Type", MediaTypeImageManifest)
+			_, _ = w.Write(manifestBody)
+		case "/v2/org/suite/blobs/" + digestOf(layer):
+			_, _ = w.Write(layer)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	client := &Client{HTTPClient: server.Client()}
+
+	tests := []struct {
+		name        string
+		ref         Reference
+		expectError string
+	}{
+		{name: "Tag", ref: Reference{Registry: registry, Repository: "org/suite", Tag: "v1"}},
+		{name: "Digest", ref: Reference{Registry: registry, Repository: "org/suite", Digest: digestOf(manifestBody)}},
+		{name: "Unknown tag", ref: Reference{Registry: registry, Repository: "org/suite", Tag: "v2"}, expectError: "404 Not Found"},
+		{
+			name:        "Digest mismatch",
+			ref:         Reference{Registry: registry, Repository: "org/suite", Tag: "v1", Digest: digestOf([]byte("other"))},
+			expectError: "Digest mismatch",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := client.Pull(context.Background(), test.ref)
+			if test.expectError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []File{{Name: "suite.yaml", Contents: layer}}, files)
+		})
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	assert.NoError(t, VerifyDigest([]byte("suite"), digestOf([]byte("suite"))))
+	assert.ErrorContains(t, VerifyDigest([]byte("tampered"), digestOf([]byte("suite"))), "Digest mismatch")
+	assert.ErrorContains(t, VerifyDigest([]byte("suite"), "md5:abc"), "Unsupported digest")
+}
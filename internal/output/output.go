@@ -3,6 +3,7 @@ package output
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/charmbracelet/lipgloss"
@@ -46,23 +47,24 @@ func WriteFatal(msg string, args ...interface{}) {
 	os.Exit(1)
 }
 
-type table struct {
+// Table is a table of rows rendered with lipgloss
+type Table struct {
 	headers []string
 	rows    [][]string
 }
 
 // NewTable creates a new table with the given headers
-func NewTable(headers []string) *table {
-	return &table{headers: headers}
+func NewTable(headers []string) *Table {
+	return &Table{headers: headers}
 }
 
 // AddRow adds a row to the table
-func (t *table) AddRow(row []string) {
+func (t *Table) AddRow(row []string) {
 	t.rows = append(t.rows, row)
 }
 
 // Render renders the table, printing it to stdout
-func (t *table) Render() {
+func (t *Table) Render() {
 	physicalWidth, _, err := term.GetSize(int(os.Stdout.Fd()))
 	if err != nil {
 		fmt.Println("Error getting terminal size:", err)
@@ -82,19 +84,26 @@ func (t *table) Render() {
 		}
 	}
 
-	// Create the table using lipgloss
-	tbl := ltable.New().
-		StyleFunc(func(row, col int) lipgloss.Style {
-			if col == 1 {
-				return lipgloss.NewStyle().MaxWidth(physicalWidth)
-			}
-			return lipgloss.Style{}
-		}).
+	fmt.Println(t.build(truncatedRows).StyleFunc(func(row, col int) lipgloss.Style {
+		if col == 1 {
+			return lipgloss.NewStyle().MaxWidth(physicalWidth)
+		}
+		return lipgloss.Style{}
+	}))
+}
+
+// Write writes the table to w without truncating its cells, e.g. to a file
+func (t *Table) Write(w io.Writer) error {
+	_, err := fmt.Fprintln(w, t.build(t.rows))
+	return err
+}
+
+// build creates the table with the given rows using lipgloss
+func (t *Table) build(rows [][]string) *ltable.Table {
+	return ltable.New().
 		Border(lipgloss.NormalBorder()).
 		Headers(t.headers...).
-		Rows(truncatedRows...)
-
-	fmt.Println(tbl)
+		Rows(rows...)
 }
 
 // truncateString ensures the string fits within the given width, appending "..." if necessary
@@ -108,18 +117,34 @@ func truncateString(str string, width int) string {
 
 // WriteJSON writes the given output as pretty printed JSON to stdout
 func WriteJSON(output interface{}) {
-	jsonOutput, err := json.MarshalIndent(output, "", "    ")
-	if err != nil {
+	if err := EncodeJSON(os.Stdout, output); err != nil {
 		WriteError("Failed to marshal JSON: %s", err)
 	}
-	fmt.Println(string(jsonOutput))
 }
 
 // WriteYAML writes the given output as a pretty printed YAML object to stdout
 func WriteYAML(output interface{}) {
+	if err := EncodeYAML(os.Stdout, output); err != nil {
+		WriteError("Failed to marshal YAML: %s", err)
+	}
+}
+
+// EncodeJSON writes the given output as pretty printed JSON to w
+func EncodeJSON(w io.Writer, output interface{}) error {
+	jsonOutput, err := json.MarshalIndent(output, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(jsonOutput))
+	return err
+}
+
+// EncodeYAML writes the given output as a pretty printed YAML object to w
+func EncodeYAML(w io.Writer, output interface{}) error {
 	yamlOutput, err := yaml.Marshal(output)
 	if err != nil {
-		WriteError("Failed to marshal YAML: %s", err)
+		return err
 	}
-	fmt.Println(string(yamlOutput))
+	_, err = fmt.Fprintln(w, string(yamlOutput))
+	return err
 }
@@ -0,0 +1,312 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package rbac enumerates what the identity of a Kubernetes client is allowed to do. Sensitive
+// permissions are checked with access reviews, then attempted without persisting anything.
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+)
+
+// checkName names the objects of attempts, objects that are looked up are expected not to exist
+const checkName = "woodpecker-rbac-check"
+
+// Permission is a sensitive permission
+type Permission struct {
+	Name        string
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	// Cluster is set for permissions on cluster-scoped resources, checked once for the cluster
+	Cluster bool
+	// attempt exercises the permission, returning the error of the API server
+	attempt func(ctx context.Context, p *Prober, namespace string) error
+}
+
+// Permissions lists the sensitive permissions in the order they are checked
+var Permissions = []Permission{
+	{
+		Name: "create-pods", Verb: "create", Resource: "pods",
+		attempt: func(ctx context.Context, p *Prober, namespace string) error {
+			_, err := p.Clientset.CoreV1().Pods(namespace).Create(ctx, restrictedPod(namespace), dryRunCreate)
+			return err
+		},
+	},
+	{
+		// Authorization happens before the pod is looked up, a missing pod means exec is allowed
+		Name: "exec-pods", Verb: "create", Resource: "pods", Subresource: "exec",
+		attempt: func(ctx context.Context, p *Prober, namespace string) error {
+			return p.Clientset.CoreV1().RESTClient().Post().
+				Namespace(namespace).Resource("pods").Name(checkName).SubResource("exec").
+				Param("command", "true").Param("stdout", "true").
+				Do(ctx).Error()
+		},
+	},
+	{
+		Name: "impersonate", Verb: "impersonate", Resource: "serviceaccounts",
+		attempt: func(ctx context.Context, p *Prober, namespace string) error {
+			clientset, err := p.Impersonate(fmt.Sprintf("system:serviceaccount:%s:default", namespace))
+			if err != nil {
+				return err
+			}
+			_, err = clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+				Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+			}, metav1.CreateOptions{})
+			return err
+		},
+	},
+	{
+		// Creating a role granting every permission requires escalate, unless it has them already
+		Name: "escalate", Verb: "escalate", Group: rbacv1.GroupName, Resource: "roles",
+		attempt: func(ctx context.Context, p *Prober, namespace string) error {
+			role := &rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{Name: checkName, Namespace: namespace},
+				Rules:      []rbacv1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}},
+			}
+			_, err := p.Clientset.RbacV1().Roles(namespace).Create(ctx, role, dryRunCreate)
+			return err
+		},
+	},
+	{
+		// Binding cluster-admin requires bind, unless it has its permissions already
+		Name: "bind", Verb: "bind", Group: rbacv1.GroupName, Resource: "clusterroles",
+		attempt: func(ctx context.Context, p *Prober, namespace string) error {
+			binding := &rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: checkName, Namespace: namespace},
+				Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "default", Namespace: namespace}},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "cluster-admin"},
+			}
+			_, err := p.Clientset.RbacV1().RoleBindings(namespace).Create(ctx, binding, dryRunCreate)
+			return err
+		},
+	},
+	{
+		// The token is requested for an audience the API server does not accept, and discarded
+		Name: "create-tokens", Verb: "create", Resource: "serviceaccounts", Subresource: "token",
+		attempt: func(ctx context.Context, p *Prober, namespace string) error {
+			request := &authenticationv1.TokenRequest{
+				Spec: authenticationv1.TokenRequestSpec{
+					Audiences:         []string{"woodpecker"},
+					ExpirationSeconds: pointer.Int64(600),
+				},
+			}
+			_, err := p.Clientset.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, "default", request, dryRunCreate)
+			return err
+		},
+	},
+	{
+		// Authorization happens before the node is looked up, a missing node means patch is allowed
+		Name: "patch-nodes", Verb: "patch", Resource: "nodes", Cluster: true,
+		attempt: func(ctx context.Context, p *Prober, namespace string) error {
+			_, err := p.Clientset.CoreV1().Nodes().Patch(ctx, checkName, types.MergePatchType, []byte(`{}`),
+				metav1.PatchOptions{DryRun: []string{metav1.DryRunAll}})
+			return err
+		},
+	},
+}
+
+var dryRunCreate = metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+
+// restrictedPod returns a pod compliant with the restricted Pod Security Standard, so that only
+// RBAC decides whether it can be created
+func restrictedPod(namespace string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: checkName, Namespace: namespace},
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   pointer.Bool(true),
+				RunAsUser:      pointer.Int64(65534),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			Containers: []corev1.Container{{
+				Name:  "check",
+				Image: "alpine:latest",
+				SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: pointer.Bool(false),
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+			}},
+		},
+	}
+}
+
+// Matrix is the outcome of a sweep, per namespace and for the cluster
+type Matrix struct {
+	// User is the name the API server knows the prober as, when it could be reviewed
+	User       string            `json:"user,omitempty"`
+	Namespaces []NamespaceResult `json:"namespaces"`
+	Cluster    []Result          `json:"cluster,omitempty"`
+}
+
+type NamespaceResult struct {
+	Namespace string `json:"namespace"`
+	// Rules summarises the rules of the rules review as "verbs on resources"
+	Rules []string `json:"rules,omitempty"`
+	// Wildcard is set when a rule grants every verb or every resource
+	Wildcard bool     `json:"wildcard"`
+	Results  []Result `json:"results"`
+}
+
+// Result is the outcome of checking a permission
+type Result struct {
+	Permission string `json:"permission"`
+	// Allowed is the decision of the access review
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	// Succeeded is set when the attempt was authorized
+	Succeeded bool `json:"succeeded"`
+	// Message is the error of the attempt
+	Message string `json:"message,omitempty"`
+}
+
+// Prober sweeps the permissions of the identity of its clientset
+type Prober struct {
+	Clientset kubernetes.Interface
+	// Impersonate returns a clientset acting as another user
+	Impersonate func(user string) (kubernetes.Interface, error)
+}
+
+// NewProber returns a Prober for the identity of a client configuration
+func NewProber(config *rest.Config) (*Prober, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Prober{
+		Clientset: clientset,
+		Impersonate: func(user string) (kubernetes.Interface, error) {
+			impersonating := rest.CopyConfig(config)
+			impersonating.Impersonate = rest.ImpersonationConfig{UserName: user}
+			return kubernetes.NewForConfig(impersonating)
+		},
+	}, nil
+}
+
+// permissions returns the named permissions, every permission by default
+func permissions(names []string) ([]Permission, error) {
+	if len(names) == 0 {
+		return Permissions, nil
+	}
+	var selected []Permission
+	var known []string
+	for _, permission := range Permissions {
+		known = append(known, permission.Name)
+		if slices.Contains(names, permission.Name) {
+			selected = append(selected, permission)
+		}
+	}
+	for _, name := range names {
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("Unknown permission %s, expected one of %s", name, strings.Join(known, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// Sweep reviews the rules of the namespaces, then reviews and attempts the named permissions, all
+// of them by default, in every namespace and once for the cluster
+func (p *Prober) Sweep(ctx context.Context, namespaces []string, names []string) (*Matrix, error) {
+	selected, err := permissions(names)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := &Matrix{}
+	review, err := p.Clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err == nil {
+		matrix.User = review.Status.UserInfo.Username
+	}
+
+	for _, namespace := range namespaces {
+		namespaceResult := NamespaceResult{Namespace: namespace}
+		rules, err := p.Clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+			Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to review the rules of namespace %s: %w", namespace, err)
+		}
+		for _, rule := range rules.Status.ResourceRules {
+			namespaceResult.Rules = append(namespaceResult.Rules, fmt.Sprintf("%s on %s", strings.Join(rule.Verbs, ","), strings.Join(rule.Resources, ",")))
+			if slices.Contains(rule.Verbs, "*") || slices.Contains(rule.Resources, "*") {
+				namespaceResult.Wildcard = true
+			}
+		}
+
+		for _, permission := range selected {
+			if permission.Cluster {
+				continue
+			}
+			result, err := p.check(ctx, permission, namespace)
+			if err != nil {
+				return nil, err
+			}
+			namespaceResult.Results = append(namespaceResult.Results, *result)
+		}
+		matrix.Namespaces = append(matrix.Namespaces, namespaceResult)
+	}
+
+	for _, permission := range selected {
+		if !permission.Cluster {
+			continue
+		}
+		result, err := p.check(ctx, permission, "")
+		if err != nil {
+			return nil, err
+		}
+		matrix.Cluster = append(matrix.Cluster, *result)
+	}
+	return matrix, nil
+}
+
+// check reviews a permission, then attempts it
+func (p *Prober) check(ctx context.Context, permission Permission, namespace string) (*Result, error) {
+	review, err := p.Clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        permission.Verb,
+				Group:       permission.Group,
+				Resource:    permission.Resource,
+				Subresource: permission.Subresource,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to review permission %s: %w", permission.Name, err)
+	}
+	result := &Result{
+		Permission: permission.Name,
+		Allowed:    review.Status.Allowed,
+		Reason:     review.Status.Reason,
+	}
+
+	err = permission.attempt(ctx, p, namespace)
+	result.Succeeded = Authorized(err)
+	if err != nil {
+		result.Message = err.Error()
+	}
+	return result, nil
+}
+
+// Authorized reports whether the API server authorized a request, given its error. Requests for
+// objects that do not exist are authorized before the object is looked up.
+func Authorized(err error) bool {
+	return err == nil || apierrors.IsNotFound(err)
+}
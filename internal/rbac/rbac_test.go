@@ -0,0 +1,119 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestProber returns a Prober allowed to create pods and patch nodes in every namespace, and
+// to create roles only in the dev namespace, where it is granted every verb on pods
+func newTestProber() *Prober {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := &authenticationv1.SelfSubjectReview{}
+		review.Status.UserInfo.Username = "system:serviceaccount:default:prober"
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectRulesReview)
+		rules := []authorizationv1.ResourceRule{{Verbs: []string{"create"}, Resources: []string{"pods"}}}
+		if review.Spec.Namespace == "dev" {
+			rules = append(rules, authorizationv1.ResourceRule{Verbs: []string{"*"}, Resources: []string{"pods"}})
+		}
+		review.Status.ResourceRules = rules
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		switch {
+		case attributes.Resource == "pods", attributes.Resource == "nodes":
+			review.Status.Allowed = true
+		case attributes.Resource == "roles" && attributes.Namespace == "dev":
+			review.Status.Allowed = true
+			review.Status.Reason = "RBAC: allowed by RoleBinding dev-admin"
+		}
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "dev" {
+			return true, action.(k8stesting.CreateAction).GetObject(), nil
+		}
+		return true, nil, apierrors.NewForbidden(rbacv1.Resource("roles"), checkName, assert.AnError)
+	})
+	clientset.PrependReactor("create", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(rbacv1.Resource("rolebindings"), checkName, assert.AnError)
+	})
+	clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("serviceaccounts"), "default", assert.AnError)
+	})
+
+	impersonating := fake.NewSimpleClientset()
+	impersonating.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(authorizationv1.Resource("users"), "system:serviceaccount:default:default", assert.AnError)
+	})
+	return &Prober{
+		Clientset: clientset,
+		Impersonate: func(user string) (kubernetes.Interface, error) {
+			return impersonating, nil
+		},
+	}
+}
+
+func TestSweep(t *testing.T) {
+	// The fake clientset has no REST client to exec with
+	names := []string{"create-pods", "impersonate", "escalate", "bind", "create-tokens", "patch-nodes"}
+	matrix, err := newTestProber().Sweep(context.Background(), []string{"default", "dev"}, names)
+	require.NoError(t, err)
+	assert.Equal(t, "system:serviceaccount:default:prober", matrix.User)
+
+	succeeded := func(results []Result) map[string]bool {
+		actual := make(map[string]bool)
+		for _, result := range results {
+			actual[result.Permission] = result.Succeeded
+		}
+		return actual
+	}
+	require.Len(t, matrix.Namespaces, 2)
+	assert.Equal(t, "default", matrix.Namespaces[0].Namespace)
+	assert.False(t, matrix.Namespaces[0].Wildcard)
+	assert.Equal(t, []string{"create on pods"}, matrix.Namespaces[0].Rules)
+	assert.Equal(t, map[string]bool{
+		"create-pods":   true,
+		"impersonate":   false,
+		"escalate":      false,
+		"bind":          false,
+		"create-tokens": false,
+	}, succeeded(matrix.Namespaces[0].Results))
+
+	assert.True(t, matrix.Namespaces[1].Wildcard)
+	assert.True(t, succeeded(matrix.Namespaces[1].Results)["escalate"])
+	assert.Equal(t, Result{
+		Permission: "escalate",
+		Allowed:    true,
+		Reason:     "RBAC: allowed by RoleBinding dev-admin",
+		Succeeded:  true,
+	}, matrix.Namespaces[1].Results[2])
+
+	// The node does not exist, which the API server only finds out once the patch is authorized
+	assert.Equal(t, map[string]bool{"patch-nodes": true}, succeeded(matrix.Cluster))
+	assert.True(t, matrix.Cluster[0].Allowed)
+	assert.NotEmpty(t, matrix.Cluster[0].Message)
+}
+
+func TestSweepUnknownPermission(t *testing.T) {
+	_, err := newTestProber().Sweep(context.Background(), []string{"default"}, []string{"create-pods", "delete-nodes"})
+	assert.EqualError(t, err, "Unknown permission delete-nodes, expected one of create-pods, exec-pods, impersonate, escalate, bind, create-tokens, patch-nodes")
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023 Operant AI
+*/
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+
+	"github.com/operantai/woodpecker/internal/categories"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+//go:embed report.html.tmpl
+var htmlTemplate string
+
+// Statuses of the experiments, checks and matrix cells of the HTML report
+const (
+	statusPass     = "pass"
+	statusFail     = "fail"
+	statusUntested = "untested"
+)
+
+type htmlData struct {
+	Metadata    Metadata
+	Summary     Summary
+	Matrices    []htmlMatrix
+	Experiments []htmlExperiment
+}
+
+type htmlMatrix struct {
+	Framework string
+	Tactics   []htmlTactic
+}
+
+type htmlTactic struct {
+	ID    string
+	Name  string
+	Cells []htmlCell
+}
+
+type htmlCell struct {
+	Technique   string
+	Status      string
+	Experiments []string
+}
+
+type htmlExperiment struct {
+	*verifier.LegacyOutcome
+	Status string
+	Checks []htmlCheck
+}
+
+type htmlCheck struct {
+	Name    string
+	Status  string
+	Outputs string
+}
+
+// WriteHTML renders the report as a single HTML page without external resources
+func (r *Report) WriteHTML(w io.Writer) error {
+	tmpl, err := template.New("report").Parse(htmlTemplate)
+	if err != nil {
+		return fmt.Errorf("Error parsing HTML report template: %w", err)
+	}
+
+	data := htmlData{
+		Metadata: r.Metadata,
+		Summary:  r.Summary(),
+		Matrices: r.matrices(),
+	}
+	for _, outcome := range r.Outcomes {
+		experiment := htmlExperiment{LegacyOutcome: outcome, Status: statusFail}
+		if passed(outcome) {
+			experiment.Status = statusPass
+		}
+		for _, check := range outcome.Checks() {
+			outputs, err := outcome.ResultOutputsJSON(check)
+			if err != nil {
+				return err
+			}
+			status := statusFail
+			if outcome.Result[check] == verifier.Success {
+				status = statusPass
+			}
+			experiment.Checks = append(experiment.Checks, htmlCheck{Name: check, Status: status, Outputs: outputs})
+		}
+		data.Experiments = append(data.Experiments, experiment)
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		return fmt.Errorf("Error rendering HTML report: %w", err)
+	}
+	return nil
+}
+
+// matrices returns a tactic matrix for each framework of the outcomes. The known tactics and
+// techniques of MITRE ATT&CK and ATLAS are always shown, techniques without an experiment are
+// untested, techniques with a failed experiment are failed.
+func (r *Report) matrices() []htmlMatrix {
+	frameworks := []string{string(categories.Mitre), string(categories.MitreAtlas)}
+	byFramework := make(map[string][]*verifier.LegacyOutcome)
+	for _, outcome := range r.Outcomes {
+		if !slices.Contains(frameworks, outcome.Framework) {
+			frameworks = append(frameworks, outcome.Framework)
+		}
+		byFramework[outcome.Framework] = append(byFramework[outcome.Framework], outcome)
+	}
+
+	var matrices []htmlMatrix
+	for _, framework := range frameworks {
+		outcomes := byFramework[framework]
+		if len(outcomes) == 0 {
+			continue
+		}
+
+		tactics := categories.Matrix(categories.Framework(framework))
+		// Add the tactics and techniques of the outcomes that are not part of the framework
+		for _, outcome := range outcomes {
+			i := slices.IndexFunc(tactics, func(t categories.Tactic) bool { return t.Name == outcome.Tactic })
+			if i < 0 {
+				tactics = append(tactics, categories.Tactic{Name: outcome.Tactic})
+				i = len(tactics) - 1
+			}
+			if !slices.Contains(tactics[i].Techniques, outcome.Technique) {
+				tactics[i].Techniques = append(tactics[i].Techniques, outcome.Technique)
+			}
+		}
+
+		matrix := htmlMatrix{Framework: framework}
+		for _, tactic := range tactics {
+			column := htmlTactic{ID: tactic.ID, Name: tactic.Name}
+			for _, technique := range tactic.Techniques {
+				cell := htmlCell{Technique: technique, Status: statusUntested}
+				for _, outcome := range outcomes {
+					if outcome.Tactic != tactic.Name || outcome.Technique != technique {
+						continue
+					}
+					cell.Experiments = append(cell.Experiments, outcome.Experiment)
+					if !passed(outcome) {
+						cell.Status = statusFail
+					} else if cell.Status == statusUntested {
+						cell.Status = statusPass
+					}
+				}
+				column.Cells = append(column.Cells, cell)
+			}
+			matrix.Tactics = append(matrix.Tactics, column)
+		}
+		matrices = append(matrices, matrix)
+	}
+	return matrices
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package report renders the outcomes of verified experiments into reports that can be shared
+// with people who do not use the CLI.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/output"
+	"github.com/operantai/woodpecker/internal/verifier"
+)
+
+// ErrUnknownFormat is returned when a report is written in a format that does not exist
+var ErrUnknownFormat = errors.New("Unknown output format")
+
+// Formats a report can be written in
+const (
+	// Table renders the report as a table with a row per check
+	Table = "table"
+	// JSON renders the outcomes as JSON
+	JSON = "json"
+	// YAML renders the outcomes as YAML
+	YAML = "yaml"
+	// JUnit renders the report as JUnit XML, with a test suite per experiment
+	JUnit = "junit"
+	// SARIF renders the report as a SARIF 2.1.0 log
+	SARIF = "sarif"
+	// HTML renders the report as a single self-contained HTML page
+	HTML = "html"
+)
+
+// Metadata describes where and when the experiments of a report were verified
+type Metadata struct {
+	ClusterContext string
+	GeneratedAt    time.Time
+	Version        string
+	RunIDs         []string
+}
+
+// Report holds the outcomes of verified experiments, in the order the experiments were run
+type Report struct {
+	Metadata Metadata
+	Outcomes []*verifier.LegacyOutcome
+}
+
+// Summary counts the experiments and checks of a report
+type Summary struct {
+	Experiments    int
+	Checks         int
+	Passed         int
+	Failed         int
+	WithoutResults int
+}
+
+// Summary returns the counts of the report
+func (r *Report) Summary() Summary {
+	summary := Summary{Experiments: len(r.Outcomes)}
+	for _, outcome := range r.Outcomes {
+		if len(outcome.Result) == 0 {
+			summary.WithoutResults++
+		}
+		for _, result := range outcome.Result {
+			summary.Checks++
+			if result == verifier.Success {
+				summary.Passed++
+			} else {
+				summary.Failed++
+			}
+		}
+	}
+	return summary
+}
+
+// ChecksFailed reports whether any check failed, or any experiment produced no results to check
+func (s Summary) ChecksFailed() bool {
+	return s.Failed > 0 || s.WithoutResults > 0
+}
+
+// Formats returns the formats a report can be written in
+func Formats() []string {
+	return []string{Table, JSON, YAML, JUnit, SARIF, HTML}
+}
+
+// FormatFromPath returns the format matching the extension of a file, or the table format if
+// the extension does not match any format
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	case ".xml":
+		return JUnit
+	case ".sarif":
+		return SARIF
+	case ".html", ".htm":
+		return HTML
+	default:
+		return Table
+	}
+}
+
+// Write writes the report to w in the given format, the table format by default
+func (r *Report) Write(w io.Writer, format string) error {
+	structuredOutput := &verifier.LegacyStructuredOutput{Results: r.Outcomes}
+	if structuredOutput.Results == nil {
+		structuredOutput.Results = []*verifier.LegacyOutcome{}
+	}
+	switch strings.ToLower(format) {
+	case "", Table:
+		return r.table().Write(w)
+	case JSON:
+		return output.EncodeJSON(w, structuredOutput)
+	case YAML:
+		return output.EncodeYAML(w, structuredOutput)
+	case JUnit:
+		b, err := structuredOutput.JUnit()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case SARIF:
+		b, err := structuredOutput.SARIF()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case HTML:
+		return r.WriteHTML(w)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// Render prints the report to stdout in the given format, tables are fitted to the terminal
+func (r *Report) Render(format string) error {
+	if format == "" || strings.ToLower(format) == Table {
+		r.table().Render()
+		return nil
+	}
+	return r.Write(os.Stdout, format)
+}
+
+// table returns the report as a table with a row per check
+func (r *Report) table() *output.Table {
+	table := output.NewTable([]string{"Experiment", "Description", "Framework", "Tactic", "Technique", "Test", "Result"})
+	for _, outcome := range r.Outcomes {
+		// If there are no specific test results, show overall experiment result
+		if len(outcome.Result) == 0 {
+			table.AddRow([]string{
+				outcome.Experiment,
+				outcome.Description,
+				outcome.Framework,
+				outcome.Tactic,
+				outcome.Technique,
+				"Overall",
+				"No results",
+			})
+			continue
+		}
+
+		// Show each individual test result as a separate row
+		for _, testName := range outcome.Checks() {
+			// Add status emoji for better visual feedback
+			result := outcome.Result[testName]
+			status := result
+			if result == verifier.Success {
+				status = "✓ " + result
+			} else if result == verifier.Fail {
+				status = "✗ " + result
+			}
+
+			table.AddRow([]string{
+				outcome.Experiment,
+				outcome.Description,
+				outcome.Framework,
+				outcome.Tactic,
+				outcome.Technique,
+				testName,
+				status,
+			})
+		}
+	}
+	return table
+}
+
+// passed reports whether every check of the outcome passed, an outcome without results did not pass
+func passed(outcome *verifier.LegacyOutcome) bool {
+	if len(outcome.Result) == 0 {
+		return false
+	}
+	for _, result := range outcome.Result {
+		if result != verifier.Success {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReport() *Report {
+	exec := verifier.NewLegacy("exec", "Exec into a pod", "MITRE", "Execution", "Exec Into Container")
+	exec.Success("ls")
+	exec.Fail("whoami")
+	exec.StoreResultOutputs("whoami", map[string]string{"stdout": "<root>"})
+
+	privileged := verifier.NewLegacy("privileged", "Privileged container", "MITRE", "Privilege Escalation", "Privileged Container")
+	privileged.Success("privileged")
+
+	leak := verifier.NewLegacy("leak", "LLM data leakage", "MITRE-ATLAS", "Exfiltration", "LLM Data Leakage")
+
+	return &Report{
+		Metadata: Metadata{ClusterContext: "kind-woodpecker", GeneratedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Version: "v1.2.3", RunIDs: []string{"run-1"}},
+		Outcomes: []*verifier.LegacyOutcome{exec.GetOutcome(), privileged.GetOutcome(), leak.GetOutcome()},
+	}
+}
+
+func TestSummary(t *testing.T) {
+	assert.Equal(t, Summary{Experiments: 3, Checks: 3, Passed: 2, Failed: 1, WithoutResults: 1}, testReport().Summary())
+}
+
+func TestMatrices(t *testing.T) {
+	matrices := testReport().matrices()
+	require.Len(t, matrices, 2)
+	assert.Equal(t, "MITRE", matrices[0].Framework)
+	assert.Equal(t, "MITRE-ATLAS", matrices[1].Framework)
+
+	statuses := make(map[string]string)
+	for _, matrix := range matrices {
+		for _, tactic := range matrix.Tactics {
+			for _, cell := range tactic.Cells {
+				statuses[tactic.Name+"/"+cell.Technique] = cell.Status
+			}
+		}
+	}
+	assert.Equal(t, statusFail, statuses["Execution/Exec Into Container"])
+	assert.Equal(t, statusPass, statuses["Privilege Escalation/Privileged Container"])
+	assert.Equal(t, statusUntested, statuses["Persistence/Kubernetes Cron Job"])
+	// An experiment without results did not pass
+	assert.Equal(t, statusFail, statuses["Exfiltration/LLM Data Leakage"])
+}
+
+func TestWriteHTML(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, testReport().WriteHTML(&b))
+	html := b.String()
+	assert.Contains(t, html, "kind-woodpecker")
+	assert.Contains(t, html, "v1.2.3")
+	assert.Contains(t, html, "2024-01-02 03:04:05 UTC")
+	assert.Contains(t, html, "Exec Into Container")
+	// Result outputs are escaped
+	assert.Contains(t, html, "&lt;root&gt;")
+	assert.NotContains(t, html, "<root>")
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := map[string]string{
+		"results.json":      JSON,
+		"results.YML":       YAML,
+		"junit.xml":         JUnit,
+		"results.sarif":     SARIF,
+		"report.html":       HTML,
+		"results.txt":       Table,
+		"results":           Table,
+		"dir.json/results":  Table,
+		"results.yaml.html": HTML,
+	}
+	for path, expected := range tests {
+		assert.Equal(t, expected, FormatFromPath(path), path)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, format := range Formats() {
+		t.Run(format, func(t *testing.T) {
+			var b bytes.Buffer
+			require.NoError(t, testReport().Write(&b, format))
+			assert.Contains(t, b.String(), "exec")
+		})
+	}
+
+	var b bytes.Buffer
+	assert.ErrorIs(t, testReport().Write(&b, "pdf"), ErrUnknownFormat)
+}
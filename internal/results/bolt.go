@@ -0,0 +1,244 @@
+/*
+Copyright 2023 Operant AI
+*/
+package results
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	resultsBucket = []byte("results")
+	runsBucket    = []byte("runs")
+)
+
+// boltStore keeps results in nested run/experiment type/experiment buckets of a BoltDB file
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore returns a ResultStore backed by a BoltDB database at the given path
+func NewBoltStore(path string) (ResultStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("Unable to create result store directory for %s: %w", path, err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open result store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(resultsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(runsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Put(ctx context.Context, result *Result) error {
+	if err := result.Key.validate(); err != nil {
+		return err
+	}
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
+	}
+	contents, err := json.Marshal(&storedResult{CreatedAt: result.CreatedAt, Data: result.Data})
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(resultsBucket)
+		for _, name := range []string{result.RunID, result.ExperimentType, result.Experiment} {
+			bucket, err = bucket.CreateBucketIfNotExists([]byte(escapeSegment(name)))
+			if err != nil {
+				return err
+			}
+		}
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		id := make([]byte, 8)
+		binary.BigEndian.PutUint64(id, seq)
+		return bucket.Put(id, contents)
+	})
+}
+
+func (s *boltStore) List(ctx context.Context, key Key) ([]*Result, error) {
+	var results []*Result
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return walkBuckets(tx.Bucket(resultsBucket), key, func(k Key, parent, bucket *bolt.Bucket) error {
+			return bucket.ForEach(func(_, v []byte) error {
+				var stored storedResult
+				if err := json.Unmarshal(v, &stored); err != nil {
+					return fmt.Errorf("Could not parse stored result for %s: %w", k.Experiment, err)
+				}
+				results = append(results, &Result{Key: k, CreatedAt: stored.CreatedAt, Data: stored.Data})
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortResults(results)
+	return results, nil
+}
+
+func (s *boltStore) Delete(ctx context.Context, key Key) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(resultsBucket)
+		type match struct {
+			parent *bolt.Bucket
+			name   []byte
+		}
+		var matches []match
+		err := walkBuckets(root, key, func(k Key, parent, bucket *bolt.Bucket) error {
+			matches = append(matches, match{parent: parent, name: []byte(escapeSegment(k.Experiment))})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Buckets may not be modified while iterating over them, so delete afterwards
+		for _, m := range matches {
+			if err := m.parent.DeleteBucket(m.name); err != nil {
+				return err
+			}
+		}
+		return pruneEmptyBuckets(root, 2)
+	})
+}
+
+func (s *boltStore) PutRun(ctx context.Context, run *Run) error {
+	contents, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).Put([]byte(run.ID), contents)
+	})
+}
+
+func (s *boltStore) GetRun(ctx context.Context, id string) (*Run, error) {
+	var run *Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		contents := tx.Bucket(runsBucket).Get([]byte(id))
+		if contents == nil {
+			return ErrRunNotFound
+		}
+		run = &Run{}
+		return json.Unmarshal(contents, run)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (s *boltStore) ListRuns(ctx context.Context) ([]*Run, error) {
+	var runs []*Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).ForEach(func(k, v []byte) error {
+			var run Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return fmt.Errorf("Could not parse run %s: %w", k, err)
+			}
+			runs = append(runs, &run)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *boltStore) DeleteRun(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(runsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		root := tx.Bucket(resultsBucket)
+		name := []byte(escapeSegment(id))
+		if root.Bucket(name) == nil {
+			return nil
+		}
+		return root.DeleteBucket(name)
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// walkBuckets calls fn for every experiment bucket matching the key, along with its parent bucket
+func walkBuckets(root *bolt.Bucket, filter Key, fn func(key Key, parent, bucket *bolt.Bucket) error) error {
+	return forEachBucket(root, func(run []byte, runBucket *bolt.Bucket) error {
+		return forEachBucket(runBucket, func(experimentType []byte, typeBucket *bolt.Bucket) error {
+			return forEachBucket(typeBucket, func(experiment []byte, bucket *bolt.Bucket) error {
+				key := Key{
+					RunID:          unescapeSegment(string(run)),
+					ExperimentType: unescapeSegment(string(experimentType)),
+					Experiment:     unescapeSegment(string(experiment)),
+				}
+				if !key.Matches(filter) {
+					return nil
+				}
+				return fn(key, typeBucket, bucket)
+			})
+		})
+	})
+}
+
+func forEachBucket(bucket *bolt.Bucket, fn func(name []byte, bucket *bolt.Bucket) error) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		// Nested buckets have a nil value
+		if v != nil {
+			return nil
+		}
+		return fn(k, bucket.Bucket(k))
+	})
+}
+
+// pruneEmptyBuckets removes empty nested buckets up to the given depth
+func pruneEmptyBuckets(bucket *bolt.Bucket, depth int) error {
+	// Buckets may not be modified while iterating over them, so collect the names first
+	var names [][]byte
+	err := forEachBucket(bucket, func(name []byte, _ *bolt.Bucket) error {
+		names = append(names, append([]byte(nil), name...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		child := bucket.Bucket(name)
+		if depth > 1 {
+			if err := pruneEmptyBuckets(child, depth-1); err != nil {
+				return err
+			}
+		}
+		if k, _ := child.Cursor().First(); k == nil {
+			if err := bucket.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
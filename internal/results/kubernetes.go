@@ -0,0 +1,359 @@
+/*
+Copyright 2023 Operant AI
+*/
+package results
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	managedByLabel       = "app.kubernetes.io/managed-by"
+	componentLabel       = "app.kubernetes.io/component"
+	runIDLabel           = "woodpecker.operant.ai/run-id"
+	experimentTypeLabel  = "woodpecker.operant.ai/experiment-type"
+	experimentLabel      = "woodpecker.operant.ai/experiment"
+	createdAtAnnotation  = "woodpecker.operant.ai/created-at"
+	resultDataKey        = "result"
+	resultObjectPrefix   = "woodpecker-result-"
+	resultComponentValue = "result"
+	runDataKey           = "run"
+	runObjectPrefix      = "woodpecker-run-"
+	runComponentValue    = "run"
+)
+
+// kubernetesStore keeps each result in its own ConfigMap or Secret, labelled with the result key
+type kubernetesStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	kind      string
+}
+
+// NewKubernetesStore returns a ResultStore keeping results as ConfigMaps or Secrets, depending on kind,
+// in the given namespace
+func NewKubernetesStore(clientset kubernetes.Interface, namespace, kind string) (ResultStore, error) {
+	if kind != ConfigMap && kind != Secret {
+		return nil, fmt.Errorf("Unknown Kubernetes result store kind %q", kind)
+	}
+	return &kubernetesStore{
+		clientset: clientset,
+		namespace: namespace,
+		kind:      kind,
+	}, nil
+}
+
+func (s *kubernetesStore) Put(ctx context.Context, result *Result) error {
+	if err := result.Key.validate(); err != nil {
+		return err
+	}
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
+	}
+
+	objectMeta := metav1.ObjectMeta{
+		Name:      resultObjectPrefix + rand.String(10),
+		Namespace: s.namespace,
+		Labels: map[string]string{
+			managedByLabel:      "woodpecker",
+			componentLabel:      resultComponentValue,
+			runIDLabel:          labelValue(result.RunID),
+			experimentTypeLabel: labelValue(result.ExperimentType),
+			experimentLabel:     labelValue(result.Experiment),
+		},
+		// Label values are restricted, so the exact key is kept in the annotations
+		Annotations: map[string]string{
+			runIDLabel:          result.RunID,
+			experimentTypeLabel: result.ExperimentType,
+			experimentLabel:     result.Experiment,
+			createdAtAnnotation: result.CreatedAt.Format(time.RFC3339Nano),
+		},
+	}
+
+	var err error
+	switch s.kind {
+	case Secret:
+		secret := &corev1.Secret{
+			ObjectMeta: objectMeta,
+			Type:       corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				resultDataKey: result.Data,
+			},
+		}
+		_, err = s.clientset.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	default:
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: objectMeta,
+			BinaryData: map[string][]byte{
+				resultDataKey: result.Data,
+			},
+		}
+		_, err = s.clientset.CoreV1().ConfigMaps(s.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to store result in %s %s: %w", s.kind, s.namespace, err)
+	}
+	return nil
+}
+
+func (s *kubernetesStore) List(ctx context.Context, key Key) ([]*Result, error) {
+	objects, err := s.listObjects(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Result
+	for _, result := range objects {
+		results = append(results, result)
+	}
+	sortResults(results)
+	return results, nil
+}
+
+func (s *kubernetesStore) Delete(ctx context.Context, key Key) error {
+	objects, err := s.listObjects(ctx, key)
+	if err != nil {
+		return err
+	}
+	for name := range objects {
+		switch s.kind {
+		case Secret:
+			err = s.clientset.CoreV1().Secrets(s.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		default:
+			err = s.clientset.CoreV1().ConfigMaps(s.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listObjects returns the results matching the key, by the name of the object holding them
+func (s *kubernetesStore) listObjects(ctx context.Context, key Key) (map[string]*Result, error) {
+	listOptions := metav1.ListOptions{LabelSelector: selectorForKey(key)}
+
+	objects := make(map[string]*Result)
+	switch s.kind {
+	case Secret:
+		secrets, err := s.clientset.CoreV1().Secrets(s.namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secrets.Items {
+			objects[secret.Name] = resultFromObject(secret.ObjectMeta, secret.Data[resultDataKey])
+		}
+	default:
+		configMaps, err := s.clientset.CoreV1().ConfigMaps(s.namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, configMap := range configMaps.Items {
+			objects[configMap.Name] = resultFromObject(configMap.ObjectMeta, configMap.BinaryData[resultDataKey])
+		}
+	}
+
+	// Label values may be hashed, so check the exact key kept in the annotations
+	for name, result := range objects {
+		if !result.Matches(key) {
+			delete(objects, name)
+		}
+	}
+	return objects, nil
+}
+
+func (s *kubernetesStore) PutRun(ctx context.Context, run *Run) error {
+	contents, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	objectMeta := metav1.ObjectMeta{
+		Name:      runObjectName(run.ID),
+		Namespace: s.namespace,
+		Labels: map[string]string{
+			managedByLabel: "woodpecker",
+			componentLabel: runComponentValue,
+			runIDLabel:     labelValue(run.ID),
+		},
+		Annotations: map[string]string{
+			runIDLabel: run.ID,
+		},
+	}
+
+	switch s.kind {
+	case Secret:
+		secret := &corev1.Secret{
+			ObjectMeta: objectMeta,
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{runDataKey: contents},
+		}
+		_, err = s.clientset.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.clientset.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+		}
+	default:
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: objectMeta,
+			BinaryData: map[string][]byte{runDataKey: contents},
+		}
+		_, err = s.clientset.CoreV1().ConfigMaps(s.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.clientset.CoreV1().ConfigMaps(s.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to store run in %s %s: %w", s.kind, s.namespace, err)
+	}
+	return nil
+}
+
+func (s *kubernetesStore) GetRun(ctx context.Context, id string) (*Run, error) {
+	var contents []byte
+	switch s.kind {
+	case Secret:
+		secret, err := s.clientset.CoreV1().Secrets(s.namespace).Get(ctx, runObjectName(id), metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, ErrRunNotFound
+			}
+			return nil, err
+		}
+		contents = secret.Data[runDataKey]
+	default:
+		configMap, err := s.clientset.CoreV1().ConfigMaps(s.namespace).Get(ctx, runObjectName(id), metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, ErrRunNotFound
+			}
+			return nil, err
+		}
+		contents = configMap.BinaryData[runDataKey]
+	}
+	var run Run
+	if err := json.Unmarshal(contents, &run); err != nil {
+		return nil, fmt.Errorf("Could not parse run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+func (s *kubernetesStore) ListRuns(ctx context.Context) ([]*Run, error) {
+	listOptions := metav1.ListOptions{
+		LabelSelector: labels.Set{
+			managedByLabel: "woodpecker",
+			componentLabel: runComponentValue,
+		}.String(),
+	}
+
+	var contents [][]byte
+	switch s.kind {
+	case Secret:
+		secrets, err := s.clientset.CoreV1().Secrets(s.namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secrets.Items {
+			contents = append(contents, secret.Data[runDataKey])
+		}
+	default:
+		configMaps, err := s.clientset.CoreV1().ConfigMaps(s.namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, configMap := range configMaps.Items {
+			contents = append(contents, configMap.BinaryData[runDataKey])
+		}
+	}
+
+	var runs []*Run
+	for _, c := range contents {
+		var run Run
+		if err := json.Unmarshal(c, &run); err != nil {
+			return nil, fmt.Errorf("Could not parse run: %w", err)
+		}
+		runs = append(runs, &run)
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *kubernetesStore) DeleteRun(ctx context.Context, id string) error {
+	var err error
+	switch s.kind {
+	case Secret:
+		err = s.clientset.CoreV1().Secrets(s.namespace).Delete(ctx, runObjectName(id), metav1.DeleteOptions{})
+	default:
+		err = s.clientset.CoreV1().ConfigMaps(s.namespace).Delete(ctx, runObjectName(id), metav1.DeleteOptions{})
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return s.Delete(ctx, Key{RunID: id})
+}
+
+func (s *kubernetesStore) Close() error {
+	return nil
+}
+
+func resultFromObject(objectMeta metav1.ObjectMeta, data []byte) *Result {
+	createdAt, err := time.Parse(time.RFC3339Nano, objectMeta.Annotations[createdAtAnnotation])
+	if err != nil {
+		createdAt = objectMeta.CreationTimestamp.Time
+	}
+	return &Result{
+		Key: Key{
+			RunID:          objectMeta.Annotations[runIDLabel],
+			ExperimentType: objectMeta.Annotations[experimentTypeLabel],
+			Experiment:     objectMeta.Annotations[experimentLabel],
+		},
+		CreatedAt: createdAt,
+		Data:      data,
+	}
+}
+
+func selectorForKey(key Key) string {
+	selector := labels.Set{
+		managedByLabel: "woodpecker",
+		componentLabel: resultComponentValue,
+	}
+	if key.RunID != "" {
+		selector[runIDLabel] = labelValue(key.RunID)
+	}
+	if key.ExperimentType != "" {
+		selector[experimentTypeLabel] = labelValue(key.ExperimentType)
+	}
+	if key.Experiment != "" {
+		selector[experimentLabel] = labelValue(key.Experiment)
+	}
+	return selector.String()
+}
+
+// runObjectName returns the name of the object holding a run record
+func runObjectName(id string) string {
+	name := runObjectPrefix + id
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(id))
+	return runObjectPrefix + hex.EncodeToString(sum[:])[:40]
+}
+
+// labelValue returns the value as is if it is a valid label value, otherwise a hash of it
+func labelValue(value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return strings.Join([]string{"sha256", hex.EncodeToString(sum[:])[:40]}, "-")
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2023 Operant AI
+*/
+package results
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// storedResult is the on-disk representation of a result
+type storedResult struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Data      []byte    `json:"data"`
+}
+
+// runFile is the name of the run record kept in each run directory
+const runFile = "run.json"
+
+// localStore keeps results in a directory tree of <run>/<experiment type>/<experiment>/<result>.json
+type localStore struct {
+	dir string
+}
+
+// NewLocalStore returns a ResultStore backed by the given directory
+func NewLocalStore(dir string) (ResultStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Unable to create result store directory %s: %w", dir, err)
+	}
+	return &localStore{dir: dir}, nil
+}
+
+func (s *localStore) keyDir(key Key) string {
+	return filepath.Join(s.dir, escapeSegment(key.RunID), escapeSegment(key.ExperimentType), escapeSegment(key.Experiment))
+}
+
+func (s *localStore) Put(ctx context.Context, result *Result) error {
+	if err := result.Key.validate(); err != nil {
+		return err
+	}
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
+	}
+
+	dir := s.keyDir(result.Key)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	contents, err := json.Marshal(&storedResult{CreatedAt: result.CreatedAt, Data: result.Data})
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, fmt.Sprintf("%d-*.json", result.CreatedAt.UnixNano()))
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	// A partially written result would not parse when listed
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
+
+func (s *localStore) List(ctx context.Context, key Key) ([]*Result, error) {
+	var results []*Result
+	err := s.walk(key, func(k Key, dir string) error {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			contents, err := os.ReadFile(filepath.Join(dir, file.Name()))
+			if err != nil {
+				return err
+			}
+			var stored storedResult
+			if err := json.Unmarshal(contents, &stored); err != nil {
+				return fmt.Errorf("Could not parse stored result %s: %w", file.Name(), err)
+			}
+			results = append(results, &Result{Key: k, CreatedAt: stored.CreatedAt, Data: stored.Data})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortResults(results)
+	return results, nil
+}
+
+func (s *localStore) Delete(ctx context.Context, key Key) error {
+	err := s.walk(key, func(k Key, dir string) error {
+		return os.RemoveAll(dir)
+	})
+	if err != nil {
+		return err
+	}
+	return s.removeEmptyDirs()
+}
+
+func (s *localStore) PutRun(ctx context.Context, run *Run) error {
+	dir := filepath.Join(s.dir, escapeSegment(run.ID))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	contents, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, runFile), contents, 0600)
+}
+
+func (s *localStore) GetRun(ctx context.Context, id string) (*Run, error) {
+	contents, err := os.ReadFile(filepath.Join(s.dir, escapeSegment(id), runFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrRunNotFound
+		}
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(contents, &run); err != nil {
+		return nil, fmt.Errorf("Could not parse run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+func (s *localStore) ListRuns(ctx context.Context) ([]*Run, error) {
+	dirs, err := readSubDirs(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Run
+	for _, dir := range dirs {
+		run, err := s.GetRun(ctx, unescapeSegment(dir))
+		if err != nil {
+			// Results may have been written without a run record
+			if err == ErrRunNotFound {
+				continue
+			}
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *localStore) DeleteRun(ctx context.Context, id string) error {
+	return os.RemoveAll(filepath.Join(s.dir, escapeSegment(id)))
+}
+
+func (s *localStore) Close() error {
+	return nil
+}
+
+// walk calls fn for every experiment directory matching the key
+func (s *localStore) walk(filter Key, fn func(key Key, dir string) error) error {
+	runs, err := readSubDirs(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		runDir := filepath.Join(s.dir, run)
+		types, err := readSubDirs(runDir)
+		if err != nil {
+			return err
+		}
+		for _, experimentType := range types {
+			typeDir := filepath.Join(runDir, experimentType)
+			experiments, err := readSubDirs(typeDir)
+			if err != nil {
+				return err
+			}
+			for _, experiment := range experiments {
+				key := Key{
+					RunID:          unescapeSegment(run),
+					ExperimentType: unescapeSegment(experimentType),
+					Experiment:     unescapeSegment(experiment),
+				}
+				if !key.Matches(filter) {
+					continue
+				}
+				if err := fn(key, filepath.Join(typeDir, experiment)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// removeEmptyDirs removes run and experiment type directories left empty after a delete
+func (s *localStore) removeEmptyDirs() error {
+	runs, err := readSubDirs(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		runDir := filepath.Join(s.dir, run)
+		types, err := readSubDirs(runDir)
+		if err != nil {
+			return err
+		}
+		for _, experimentType := range types {
+			typeDir := filepath.Join(runDir, experimentType)
+			if isEmptyDir(typeDir) {
+				_ = os.Remove(typeDir)
+			}
+		}
+		if isEmptyDir(runDir) {
+			_ = os.Remove(runDir)
+		}
+	}
+	return nil
+}
+
+func readSubDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+func isEmptyDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) == 0
+}
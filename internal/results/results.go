@@ -0,0 +1,246 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package results persists the raw output of experiment runs so that they can be
+// verified later, potentially from a different machine.
+package results
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/operantai/woodpecker/internal/k8s"
+)
+
+const (
+	// Local stores results as files in a directory
+	Local = "local"
+	// Bolt stores results in an embedded BoltDB database file
+	Bolt = "bolt"
+	// ConfigMap stores results as ConfigMaps in a Kubernetes namespace
+	ConfigMap = "configmap"
+	// Secret stores results as Secrets in a Kubernetes namespace
+	Secret = "secret"
+
+	// DefaultLocalDir is the directory used by the local store when none is given
+	DefaultLocalDir = "/tmp/woodpecker"
+	// DefaultBoltFile is the database file used by the bolt store when none is given
+	DefaultBoltFile = "/tmp/woodpecker/results.db"
+	// DefaultNamespace is the namespace used by the Kubernetes stores when none is given
+	DefaultNamespace = "default"
+)
+
+var (
+	// ErrInvalidKey is returned when a result is stored without a complete key
+	ErrInvalidKey = errors.New("result key requires a run ID, experiment type and experiment name")
+	// ErrRunNotFound is returned when a run record does not exist
+	ErrRunNotFound = errors.New("run not found")
+	// ErrUnknownStore is returned when a store backend does not exist
+	ErrUnknownStore = errors.New("Unknown result store")
+)
+
+// Key identifies the results of an experiment within a run
+type Key struct {
+	RunID          string `json:"runId" yaml:"runId"`
+	ExperimentType string `json:"experimentType" yaml:"experimentType"`
+	Experiment     string `json:"experiment" yaml:"experiment"`
+}
+
+// Result is a single result written by an experiment
+type Result struct {
+	Key
+	CreatedAt time.Time `json:"createdAt"`
+	Data      []byte    `json:"data"`
+}
+
+// Run records a single invocation of a set of experiments
+type Run struct {
+	ID          string    `json:"id" yaml:"id"`
+	StartedAt   time.Time `json:"startedAt" yaml:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt" yaml:"finishedAt"`
+	Experiments []Key     `json:"experiments" yaml:"experiments"`
+	// VerifiedAt, Passed and Failed summarise the latest verification of the run
+	VerifiedAt time.Time `json:"verifiedAt" yaml:"verifiedAt"`
+	Passed     int       `json:"passed" yaml:"passed"`
+	Failed     int       `json:"failed" yaml:"failed"`
+	// Verifications are the latest verification of every verified experiment of the run, which
+	// Passed and Failed sum up
+	Verifications []Verification `json:"verifications,omitempty" yaml:"verifications,omitempty"`
+}
+
+// Verification is the latest verification of an experiment of a run
+type Verification struct {
+	ExperimentType string `json:"experimentType" yaml:"experimentType"`
+	Experiment     string `json:"experiment" yaml:"experiment"`
+	Passed         int    `json:"passed" yaml:"passed"`
+	Failed         int    `json:"failed" yaml:"failed"`
+}
+
+// RecordVerification replaces the verification of an experiment of the run and sums up the
+// verifications of all its experiments into Passed and Failed, so that verifying some experiments
+// of a run keeps the verification of the others
+func (r *Run) RecordVerification(verification Verification) {
+	replaced := false
+	for i, v := range r.Verifications {
+		if v.ExperimentType == verification.ExperimentType && v.Experiment == verification.Experiment {
+			r.Verifications[i] = verification
+			replaced = true
+		}
+	}
+	if !replaced {
+		r.Verifications = append(r.Verifications, verification)
+	}
+	r.Passed, r.Failed = 0, 0
+	for _, v := range r.Verifications {
+		r.Passed += v.Passed
+		r.Failed += v.Failed
+	}
+}
+
+// HasExperiment reports whether the experiment was part of the run
+func (r *Run) HasExperiment(experimentType, experiment string) bool {
+	for _, k := range r.Experiments {
+		if k.ExperimentType == experimentType && k.Experiment == experiment {
+			return true
+		}
+	}
+	return false
+}
+
+// ResultStore persists experiment results and the runs that produced them
+type ResultStore interface {
+	// Put stores a result, the result key must be complete
+	Put(ctx context.Context, result *Result) error
+	// List returns the results matching the key, oldest first. Empty key fields match anything.
+	List(ctx context.Context, key Key) ([]*Result, error)
+	// Delete removes the results matching the key. Empty key fields match anything.
+	Delete(ctx context.Context, key Key) error
+	// PutRun creates or replaces a run record
+	PutRun(ctx context.Context, run *Run) error
+	// GetRun returns the run record with the given ID, or ErrRunNotFound
+	GetRun(ctx context.Context, id string) (*Run, error)
+	// ListRuns returns every run record, oldest first
+	ListRuns(ctx context.Context) ([]*Run, error)
+	// DeleteRun removes a run record along with all of its results
+	DeleteRun(ctx context.Context, id string) error
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Backends returns the names of the available store backends
+func Backends() []string {
+	return []string{Local, Bolt, ConfigMap, Secret}
+}
+
+// New returns a ResultStore for the given backend. The location is the directory for the
+// local backend, the database file for the bolt backend and the namespace for the Kubernetes
+// backends, an empty location selects the backend default.
+func New(ctx context.Context, backend, location string) (ResultStore, error) {
+	switch strings.ToLower(backend) {
+	case "", Local:
+		if location == "" {
+			location = DefaultLocalDir
+		}
+		return NewLocalStore(location)
+	case Bolt:
+		if location == "" {
+			location = DefaultBoltFile
+		}
+		return NewBoltStore(location)
+	case ConfigMap, Secret:
+		if location == "" {
+			location = DefaultNamespace
+		}
+		client, err := k8s.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		return NewKubernetesStore(client.Clientset, location, strings.ToLower(backend))
+	default:
+		return nil, fmt.Errorf("%w %q, valid stores are %s", ErrUnknownStore, backend, strings.Join(Backends(), ", "))
+	}
+}
+
+// Matches reports whether the key is selected by the filter, empty filter fields match anything
+func (k Key) Matches(filter Key) bool {
+	return matchField(filter.RunID, k.RunID) &&
+		matchField(filter.ExperimentType, k.ExperimentType) &&
+		matchField(filter.Experiment, k.Experiment)
+}
+
+func (k Key) validate() error {
+	if k.RunID == "" || k.ExperimentType == "" || k.Experiment == "" {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+func matchField(filter, value string) bool {
+	return filter == "" || filter == value
+}
+
+func sortResults(results []*Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].CreatedAt.Before(results[j].CreatedAt)
+	})
+}
+
+func sortRuns(runs []*Run) {
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.Before(runs[j].StartedAt)
+	})
+}
+
+// Prune deletes the runs started before olderThan, always keeping the newest keep runs. A zero
+// olderThan only applies the keep limit and a zero keep only applies the age limit.
+// It returns the runs that were deleted.
+func Prune(ctx context.Context, store ResultStore, olderThan time.Time, keep int) ([]*Run, error) {
+	if olderThan.IsZero() && keep <= 0 {
+		return nil, errors.New("Pruning requires an age or a number of runs to keep")
+	}
+	runs, err := store.ListRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if keep > 0 {
+		if keep >= len(runs) {
+			return nil, nil
+		}
+		runs = runs[:len(runs)-keep]
+	}
+
+	var pruned []*Run
+	for _, run := range runs {
+		if !olderThan.IsZero() && !run.StartedAt.Before(olderThan) {
+			continue
+		}
+		if err := store.DeleteRun(ctx, run.ID); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, run)
+	}
+	return pruned, nil
+}
+
+// escapeSegment makes a key field safe to use as a single path segment or bucket name
+func escapeSegment(s string) string {
+	escaped := url.PathEscape(s)
+	if strings.Trim(escaped, ".") == "" {
+		escaped = strings.ReplaceAll(escaped, ".", "%2E")
+	}
+	return escaped
+}
+
+func unescapeSegment(s string) string {
+	unescaped, err := url.PathUnescape(s)
+	if err != nil {
+		return s
+	}
+	return unescaped
+}
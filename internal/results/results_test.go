@@ -0,0 +1,203 @@
+package results
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testStores returns a fresh instance of every store backend
+func testStores(t *testing.T) map[string]ResultStore {
+	local, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "results.db"))
+	require.NoError(t, err)
+	configMap, err := NewKubernetesStore(fake.NewSimpleClientset(), "woodpecker", ConfigMap)
+	require.NoError(t, err)
+	secret, err := NewKubernetesStore(fake.NewSimpleClientset(), "woodpecker", Secret)
+	require.NoError(t, err)
+	return map[string]ResultStore{
+		Local:     local,
+		Bolt:      bolt,
+		ConfigMap: configMap,
+		Secret:    secret,
+	}
+}
+
+func TestResultStores(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			defer store.Close()
+
+			puts := []Result{
+				{Key: Key{RunID: "run-1", ExperimentType: "kube-exec", Experiment: "llm"}, Data: []byte(`"first"`)},
+				{Key: Key{RunID: "run-1", ExperimentType: "kube-exec", Experiment: "llm-data"}, Data: []byte(`"prefixed"`)},
+				{Key: Key{RunID: "run-2", ExperimentType: "kube-exec", Experiment: "llm"}, Data: []byte(`"second"`)},
+				{Key: Key{RunID: "run-2", ExperimentType: "execute_api", Experiment: "../escape"}, Data: []byte(`"escaped"`)},
+			}
+			for i := range puts {
+				require.NoError(t, store.Put(ctx, &puts[i]))
+			}
+
+			// An experiment name that prefixes another must not pick up its results
+			got, err := store.List(ctx, Key{ExperimentType: "kube-exec", Experiment: "llm"})
+			require.NoError(t, err)
+			assert.Equal(t, []string{`"first"`, `"second"`}, resultData(got))
+
+			got, err = store.List(ctx, Key{RunID: "run-2"})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{`"second"`, `"escaped"`}, resultData(got))
+
+			got, err = store.List(ctx, Key{Experiment: "../escape"})
+			require.NoError(t, err)
+			require.Len(t, got, 1)
+			assert.Equal(t, Key{RunID: "run-2", ExperimentType: "execute_api", Experiment: "../escape"}, got[0].Key)
+
+			require.NoError(t, store.Delete(ctx, Key{ExperimentType: "kube-exec", Experiment: "llm"}))
+			got, err = store.List(ctx, Key{})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{`"prefixed"`, `"escaped"`}, resultData(got))
+
+			assert.ErrorIs(t, store.Put(ctx, &Result{Key: Key{ExperimentType: "kube-exec", Experiment: "llm"}}), ErrInvalidKey)
+		})
+	}
+}
+
+func TestRuns(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			defer store.Close()
+
+			started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i, id := range []string{"run-2", "run-1", "run-3"} {
+				run := &Run{
+					ID:          id,
+					StartedAt:   started.Add(time.Duration(len(id)+i) * time.Hour),
+					Experiments: []Key{{RunID: id, ExperimentType: "kube-exec", Experiment: "exec"}},
+				}
+				if id == "run-1" {
+					run.StartedAt = started
+				}
+				require.NoError(t, store.PutRun(ctx, run))
+				require.NoError(t, store.Put(ctx, &Result{Key: run.Experiments[0], Data: []byte(id)}))
+			}
+
+			run, err := store.GetRun(ctx, "run-2")
+			require.NoError(t, err)
+			assert.True(t, run.HasExperiment("kube-exec", "exec"))
+			run.Passed = 1
+			require.NoError(t, store.PutRun(ctx, run))
+
+			runs, err := store.ListRuns(ctx)
+			require.NoError(t, err)
+			require.Len(t, runs, 3)
+			assert.Equal(t, []string{"run-1", "run-2", "run-3"}, []string{runs[0].ID, runs[1].ID, runs[2].ID})
+			assert.Equal(t, 1, runs[1].Passed)
+
+			require.NoError(t, store.DeleteRun(ctx, "run-1"))
+			_, err = store.GetRun(ctx, "run-1")
+			assert.ErrorIs(t, err, ErrRunNotFound)
+			got, err := store.List(ctx, Key{})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"run-2", "run-3"}, resultData(got))
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		olderThan time.Time
+		keep      int
+		expected  []string
+	}{
+		{name: "Prune by age", olderThan: now.Add(-36 * time.Hour), expected: []string{"run-1", "run-2"}},
+		{name: "Prune by count", keep: 1, expected: []string{"run-1", "run-2", "run-3"}},
+		{name: "Prune by age and count", olderThan: now.Add(-36 * time.Hour), keep: 3, expected: []string{"run-1"}},
+		{name: "Keep more runs than exist", keep: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, err := NewLocalStore(t.TempDir())
+			require.NoError(t, err)
+			for i := 1; i <= 4; i++ {
+				require.NoError(t, store.PutRun(ctx, &Run{
+					ID:        fmt.Sprintf("run-%d", i),
+					StartedAt: now.Add(-time.Duration(4-i) * 24 * time.Hour),
+				}))
+			}
+
+			pruned, err := Prune(ctx, store, test.olderThan, test.keep)
+			require.NoError(t, err)
+			var ids []string
+			for _, run := range pruned {
+				ids = append(ids, run.ID)
+			}
+			assert.Equal(t, test.expected, ids)
+
+			runs, err := store.ListRuns(ctx)
+			require.NoError(t, err)
+			assert.Len(t, runs, 4-len(test.expected))
+		})
+	}
+
+	_, err := Prune(context.Background(), nil, time.Time{}, 0)
+	assert.Error(t, err)
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		hashed bool
+	}{
+		{name: "Valid label value", value: "kube-exec", hashed: false},
+		{name: "Value with spaces", value: "Experiment 1", hashed: true},
+		{name: "Value too long", value: "a-very-long-experiment-name-that-does-not-fit-in-a-kubernetes-label", hashed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := labelValue(test.value)
+			if test.hashed {
+				assert.NotEqual(t, test.value, result)
+				assert.LessOrEqual(t, len(result), 63)
+			} else {
+				assert.Equal(t, test.value, result)
+			}
+		})
+	}
+}
+
+func resultData(results []*Result) []string {
+	var data []string
+	for _, result := range results {
+		data = append(data, string(result.Data))
+	}
+	return data
+}
+
+func TestRunRecordVerification(t *testing.T) {
+	run := &Run{ID: "run"}
+	run.RecordVerification(Verification{ExperimentType: "kube-exec", Experiment: "exec", Passed: 2})
+	run.RecordVerification(Verification{ExperimentType: "host-path-mount", Experiment: "mount", Passed: 1, Failed: 1})
+	assert.Equal(t, 3, run.Passed)
+	assert.Equal(t, 1, run.Failed)
+
+	// Verifying one experiment again keeps the verification of the other
+	run.RecordVerification(Verification{ExperimentType: "kube-exec", Experiment: "exec", Failed: 2})
+	assert.Equal(t, 1, run.Passed)
+	assert.Equal(t, 3, run.Failed)
+	assert.Len(t, run.Verifications, 2)
+}
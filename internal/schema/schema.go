@@ -0,0 +1,109 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package schema generates JSON Schemas from the Go types YAML configuration is decoded into,
+// and validates YAML documents against them with the line of every error.
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect of the generated schemas
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema needed to describe YAML configuration
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Const       string             `json:"const,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties is false for structs, and the schema of the values for maps
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	Required             []string    `json:"required,omitempty"`
+	Items                *Schema     `json:"items,omitempty"`
+	OneOf                []*Schema   `json:"oneOf,omitempty"`
+}
+
+// JSON Schema types
+const (
+	Object  = "object"
+	Array   = "array"
+	String  = "string"
+	Integer = "integer"
+	Number  = "number"
+	Boolean = "boolean"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Generate returns the schema of the YAML documents that decode into values of type t. Struct
+// fields are named after their yaml tags, as gopkg.in/yaml.v3 does, and structs do not accept
+// unknown fields. Interface types accept anything.
+func Generate(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &Schema{Type: String}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &Schema{Type: Object, Properties: make(map[string]*Schema), AdditionalProperties: false}
+		addFields(s, t)
+		return s
+	case reflect.Map:
+		return &Schema{Type: Object, AdditionalProperties: Generate(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: String}
+		}
+		return &Schema{Type: Array, Items: Generate(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: String}
+	case reflect.Bool:
+		return &Schema{Type: Boolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Integer}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Number}
+	default:
+		return &Schema{}
+	}
+}
+
+// addFields adds the properties of the fields of struct type t to s, inlined structs are merged
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if strings.Contains(options, "inline") {
+			inline := Generate(field.Type)
+			for property, schema := range inline.Properties {
+				s.Properties[property] = schema
+			}
+			if inline.AdditionalProperties != false {
+				s.AdditionalProperties = inline.AdditionalProperties
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		s.Properties[name] = Generate(field.Type)
+	}
+}
@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type testConfig struct {
+	Name    string            `yaml:"name"`
+	Port    int32             `yaml:"targetPort"`
+	Ratio   float64           `yaml:"ratio"`
+	Enabled bool              `yaml:"enabled,omitempty"`
+	Command []string          `yaml:"command"`
+	Headers map[string]string `yaml:"headers"`
+	Target  struct {
+		Pod string `yaml:"pod"`
+	} `yaml:"target"`
+	Inline   testInline  `yaml:",inline"`
+	Any      interface{} `yaml:"any"`
+	Ignored  string      `yaml:"-"`
+	Untagged string
+	private  string
+}
+
+type testInline struct {
+	Image string `yaml:"image"`
+}
+
+func TestGenerate(t *testing.T) {
+	s := Generate(reflect.TypeOf(&testConfig{}))
+	assert.Equal(t, Object, s.Type)
+	assert.Equal(t, false, s.AdditionalProperties)
+	assert.Equal(t, Integer, s.Properties["targetPort"].Type)
+	assert.Equal(t, Number, s.Properties["ratio"].Type)
+	assert.Equal(t, Boolean, s.Properties["enabled"].Type)
+	assert.Equal(t, &Schema{Type: Array, Items: &Schema{Type: String}}, s.Properties["command"])
+	assert.Equal(t, &Schema{Type: Object, AdditionalProperties: &Schema{Type: String}}, s.Properties["headers"])
+	assert.Equal(t, String, s.Properties["target"].Properties["pod"].Type)
+	assert.Equal(t, String, s.Properties["image"].Type)
+	assert.Equal(t, &Schema{}, s.Properties["any"])
+	assert.Contains(t, s.Properties, "untagged")
+	assert.NotContains(t, s.Properties, "Ignored")
+	assert.NotContains(t, s.Properties, "-")
+	assert.NotContains(t, s.Properties, "private")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			name: "Valid",
+			document: `
+name: web
+targetPort: 80
+ratio: 1
+command: [ls]
+headers:
+  Accept: application/json
+target:
+  pod: web
+image: nginx
+any: [1, {a: b}]
+`,
+		},
+		{
+			name:     "Null values",
+			document: "target:\ncommand: ~\n",
+		},
+		{
+			name:     "Unknown field with suggestion",
+			document: "target:\n  pods: web\n",
+			expected: []string{`line 2: target: unknown field "pods", did you mean "pod"?`},
+		},
+		{
+			name:     "Unknown field without suggestion",
+			document: "namespace: default\n",
+			expected: []string{`line 1: unknown field "namespace"`},
+		},
+		{
+			name:     "Wrong types",
+			document: "targetPort: \"80\"\ncommand: ls\nenabled: yes please\ntarget: [web]\nratio: fast\n",
+			expected: []string{
+				`line 1: targetPort: expected an integer, got "80"`,
+				`line 2: command: expected an array, got "ls"`,
+				`line 3: enabled: expected a boolean, got "yes please"`,
+				`line 4: target: expected an object, got an array`,
+				`line 5: ratio: expected a number, got "fast"`,
+			},
+		},
+		{
+			name:     "Array items",
+			document: "command: [ls, [-l]]\n",
+			expected: []string{`line 1: command[1]: expected a string, got an array`},
+		},
+	}
+
+	s := Generate(reflect.TypeOf(testConfig{}))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var node yaml.Node
+			require.NoError(t, yaml.Unmarshal([]byte(test.document), &node))
+			var messages []string
+			for _, err := range s.Validate(&node, "") {
+				messages = append(messages, err.Error())
+			}
+			assert.Equal(t, test.expected, messages)
+		})
+	}
+}
+
+func TestValidateRequired(t *testing.T) {
+	s := &Schema{Type: Object, Properties: map[string]*Schema{"name": {Type: String}}, Required: []string{"name"}}
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte("{}"), &node))
+	errs := s.Validate(&node, "metadata")
+	require.Len(t, errs, 1)
+	assert.Equal(t, `line 1: metadata: missing required field "name"`, errs[0].Error())
+}
+
+func TestWithFile(t *testing.T) {
+	err := &ValidationError{Line: 3, Column: 5, Path: "parameters", Message: "unknown field"}
+	assert.EqualError(t, WithFile(err, "exec.yaml"), "exec.yaml:3:5: parameters: unknown field")
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2023 Operant AI
+*/
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a YAML value that does not match its schema
+type ValidationError struct {
+	// File is the name of the validated file, if known
+	File   string
+	Line   int
+	Column int
+	// Path is the dotted path of the value, e.g. experiments[0].parameters.target
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	location := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		location = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, e.Path, e.Message)
+}
+
+// Validate checks the YAML node against the schema, returning a ValidationError for every
+// unknown field, missing required field and value of the wrong type. The path is used as the
+// prefix of the paths of the errors.
+func (s *Schema) Validate(node *yaml.Node, path string) []*ValidationError {
+	var errs []*ValidationError
+	s.validate(node, path, &errs)
+	return errs
+}
+
+func (s *Schema) validate(node *yaml.Node, path string, errs *[]*ValidationError) {
+	fail := func(n *yaml.Node, path, format string, args ...interface{}) {
+		*errs = append(*errs, &ValidationError{Line: n.Line, Column: n.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			s.validate(node.Content[0], path, errs)
+		}
+		return
+	case yaml.AliasNode:
+		s.validate(node.Alias, path, errs)
+		return
+	}
+	// A null value decodes into the zero value of any type
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+		return
+	}
+
+	switch s.Type {
+	case Object:
+		if node.Kind != yaml.MappingNode {
+			fail(node, path, "expected an object, got %s", describe(node))
+			return
+		}
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// Merge keys are expanded by the decoder
+			if key.ShortTag() == "!!merge" {
+				continue
+			}
+			seen[key.Value] = true
+			property, ok := s.Properties[key.Value]
+			if !ok {
+				additional, isSchema := s.AdditionalProperties.(*Schema)
+				if !isSchema {
+					fail(key, path, "unknown field %q%s", key.Value, suggestion(key.Value, s.Properties))
+					continue
+				}
+				property = additional
+			}
+			property.validate(value, join(path, key.Value), errs)
+		}
+		for _, required := range s.Required {
+			if !seen[required] {
+				fail(node, path, "missing required field %q", required)
+			}
+		}
+	case Array:
+		if node.Kind != yaml.SequenceNode {
+			fail(node, path, "expected an array, got %s", describe(node))
+			return
+		}
+		for i, item := range node.Content {
+			s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case String:
+		// Any scalar decodes into a string
+		if node.Kind != yaml.ScalarNode {
+			fail(node, path, "expected a string, got %s", describe(node))
+		}
+	case Integer:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			fail(node, path, "expected an integer, got %s", describe(node))
+		}
+	case Number:
+		if node.Kind != yaml.ScalarNode || (node.ShortTag() != "!!int" && node.ShortTag() != "!!float") {
+			fail(node, path, "expected a number, got %s", describe(node))
+		}
+	case Boolean:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			fail(node, path, "expected a boolean, got %s", describe(node))
+		}
+	}
+
+	if s.Const != "" && node.Kind == yaml.ScalarNode && node.Value != s.Const {
+		fail(node, path, "expected %q, got %q", s.Const, node.Value)
+	}
+}
+
+// WithFile sets the file of the validation errors in err, joined or not
+func WithFile(err error, file string) error {
+	var validationErr *ValidationError
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			WithFile(e, file)
+		}
+	} else if errors.As(err, &validationErr) {
+		validationErr.File = file
+	}
+	return err
+}
+
+// describe returns the kind of a YAML node for error messages
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "an object"
+	case yaml.SequenceNode:
+		return "an array"
+	}
+	switch node.ShortTag() {
+	case "!!int":
+		return "an integer"
+	case "!!float":
+		return "a number"
+	case "!!bool":
+		return "a boolean"
+	}
+	return fmt.Sprintf("%q", node.Value)
+}
+
+// suggestion returns a hint naming the known field closest to an unknown field, if any is close
+func suggestion(field string, properties map[string]*Schema) string {
+	var best string
+	bestDistance := len(field)/3 + 1
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if d := distance(field, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// distance returns the Levenshtein distance between two strings
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
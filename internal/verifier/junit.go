@@ -0,0 +1,105 @@
+/*
+Copyright 2023 Operant AI
+*/
+package verifier
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// JUnit renders the outcomes as a JUnit XML report, with a test suite per experiment and a test
+// case per check. The result outputs of a check are added to its failure details, or to its
+// standard output if it passed.
+func (s *LegacyStructuredOutput) JUnit() ([]byte, error) {
+	report := junitTestSuites{Name: "woodpecker"}
+	for _, outcome := range s.Results {
+		suite := junitTestSuite{
+			Name: outcome.Experiment,
+			Properties: []junitProperty{
+				{Name: "description", Value: outcome.Description},
+				{Name: "framework", Value: outcome.Framework},
+				{Name: "tactic", Value: outcome.Tactic},
+				{Name: "technique", Value: outcome.Technique},
+			},
+		}
+
+		// An experiment without results is reported as failed, as it is in the CLI summary
+		if len(outcome.Result) == 0 {
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      "Overall",
+				ClassName: outcome.Experiment,
+				Failure:   &junitFailure{Message: "No results", Type: Fail},
+			})
+		}
+
+		for _, check := range outcome.Checks() {
+			testCase := junitTestCase{Name: check, ClassName: outcome.Experiment}
+			details, err := outcome.ResultOutputsJSON(check)
+			if err != nil {
+				return nil, err
+			}
+			if outcome.Result[check] == Success {
+				testCase.SystemOut = details
+			} else {
+				testCase.Failure = &junitFailure{
+					Message: fmt.Sprintf("%s: %s", check, outcome.Result[check]),
+					Type:    Fail,
+					Details: details,
+				}
+			}
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+
+		for _, testCase := range suite.TestCases {
+			suite.Tests++
+			if testCase.Failure != nil {
+				suite.Failures++
+			}
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error rendering JUnit report: %w", err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
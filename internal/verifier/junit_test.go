@@ -0,0 +1,48 @@
+package verifier
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStructuredOutput() *LegacyStructuredOutput {
+	exec := NewLegacy("exec", "Exec into a pod", "MITRE", "Execution", "Exec Into Container")
+	exec.Success("ls")
+	exec.StoreResultOutputs("ls", "bin etc")
+	exec.Fail("whoami")
+	exec.StoreResultOutputs("whoami", map[string]string{"stdout": "root"})
+
+	empty := NewLegacy("leak", "LLM data leakage", "MITRE-ATLAS", "Exfiltration", "LLM Data Leakage")
+
+	return &LegacyStructuredOutput{Results: []*LegacyOutcome{exec.GetOutcome(), empty.GetOutcome()}}
+}
+
+func TestJUnit(t *testing.T) {
+	b, err := testStructuredOutput().JUnit()
+	require.NoError(t, err)
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(b, &report))
+	assert.Equal(t, 3, report.Tests)
+	assert.Equal(t, 2, report.Failures)
+	require.Len(t, report.Suites, 2)
+
+	exec := report.Suites[0]
+	assert.Equal(t, "exec", exec.Name)
+	assert.Contains(t, exec.Properties, junitProperty{Name: "technique", Value: "Exec Into Container"})
+	require.Len(t, exec.TestCases, 2)
+	assert.Equal(t, "ls", exec.TestCases[0].Name)
+	assert.Nil(t, exec.TestCases[0].Failure)
+	assert.Contains(t, exec.TestCases[0].SystemOut, "bin etc")
+	assert.Equal(t, "whoami", exec.TestCases[1].Name)
+	require.NotNil(t, exec.TestCases[1].Failure)
+	assert.Contains(t, exec.TestCases[1].Failure.Details, `"stdout": "root"`)
+
+	leak := report.Suites[1]
+	require.Len(t, leak.TestCases, 1)
+	assert.Equal(t, "Overall", leak.TestCases[0].Name)
+	assert.Equal(t, "No results", leak.TestCases[0].Failure.Message)
+}
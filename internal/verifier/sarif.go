@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Operant AI
+*/
+package verifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string              `json:"id"`
+	Name             string              `json:"name"`
+	ShortDescription sarifMessage        `json:"shortDescription"`
+	Properties       sarifRuleProperties `json:"properties"`
+}
+
+type sarifRuleProperties struct {
+	Framework string   `json:"framework"`
+	Tactic    string   `json:"tactic"`
+	Technique string   `json:"technique"`
+	Tags      []string `json:"tags"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	RuleIndex  int                    `json:"ruleIndex"`
+	Kind       string                 `json:"kind"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+// SARIF renders the outcomes as a SARIF 2.1.0 log. Each framework, tactic and technique becomes
+// a rule, each check a result reported against the rule of its experiment. Failed checks are
+// reported as errors, passed checks as passes.
+func (s *LegacyStructuredOutput) SARIF() ([]byte, error) {
+	driver := sarifDriver{
+		Name:           "woodpecker",
+		InformationURI: "https://github.com/OperantAI/woodpecker",
+		Rules:          []sarifRule{},
+	}
+	results := []sarifResult{}
+	ruleIndexes := make(map[string]int)
+
+	for _, outcome := range s.Results {
+		ruleID := sarifRuleID(outcome)
+		index, ok := ruleIndexes[ruleID]
+		if !ok {
+			index = len(driver.Rules)
+			ruleIndexes[ruleID] = index
+			driver.Rules = append(driver.Rules, sarifRule{
+				ID:               ruleID,
+				Name:             outcome.Technique,
+				ShortDescription: sarifMessage{Text: fmt.Sprintf("%s %s: %s", outcome.Framework, outcome.Tactic, outcome.Technique)},
+				Properties: sarifRuleProperties{
+					Framework: outcome.Framework,
+					Tactic:    outcome.Tactic,
+					Technique: outcome.Technique,
+					Tags:      []string{outcome.Framework, outcome.Tactic, outcome.Technique},
+				},
+			})
+		}
+
+		// An experiment without results is reported as failed, as it is in the CLI summary
+		if len(outcome.Result) == 0 {
+			results = append(results, sarifResult{
+				RuleID:    ruleID,
+				RuleIndex: index,
+				Kind:      "fail",
+				Level:     "error",
+				Message:   sarifMessage{Text: fmt.Sprintf("%s: No results", outcome.Experiment)},
+				Locations: sarifLocations(outcome.Experiment, "Overall"),
+			})
+		}
+
+		for _, check := range outcome.Checks() {
+			result := sarifResult{
+				RuleID:    ruleID,
+				RuleIndex: index,
+				Kind:      "pass",
+				Level:     "none",
+				Message:   sarifMessage{Text: fmt.Sprintf("%s: %s: %s", outcome.Experiment, check, outcome.Result[check])},
+				Locations: sarifLocations(outcome.Experiment, check),
+			}
+			if outcome.Result[check] != Success {
+				result.Kind = "fail"
+				result.Level = "error"
+			}
+			if outputs := outcome.ResultOutputs[check]; len(outputs) > 0 {
+				result.Properties = map[string]interface{}{"resultOutputs": outputs}
+			}
+			results = append(results, result)
+		}
+	}
+
+	log := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	b, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error rendering SARIF report: %w", err)
+	}
+	return b, nil
+}
+
+// sarifRuleID returns the rule ID of an outcome, e.g. MITRE/Privilege-Escalation/Privileged-Container
+func sarifRuleID(outcome *LegacyOutcome) string {
+	parts := []string{outcome.Framework, outcome.Tactic, outcome.Technique}
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(strings.TrimSpace(part), " ", "-")
+	}
+	return strings.Join(parts, "/")
+}
+
+func sarifLocations(experiment, check string) []sarifLocation {
+	return []sarifLocation{{
+		LogicalLocations: []sarifLogicalLocation{{
+			Name:               check,
+			FullyQualifiedName: experiment + "/" + check,
+		}},
+	}}
+}
@@ -0,0 +1,36 @@
+package verifier
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSARIF(t *testing.T) {
+	b, err := testStructuredOutput().SARIF()
+	require.NoError(t, err)
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(b, &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+
+	rules := log.Runs[0].Tool.Driver.Rules
+	require.Len(t, rules, 2)
+	assert.Equal(t, "MITRE/Execution/Exec-Into-Container", rules[0].ID)
+	assert.Equal(t, "Execution", rules[0].Properties.Tactic)
+	assert.Equal(t, "MITRE-ATLAS/Exfiltration/LLM-Data-Leakage", rules[1].ID)
+
+	results := log.Runs[0].Results
+	require.Len(t, results, 3)
+	assert.Equal(t, "pass", results[0].Kind)
+	assert.Equal(t, "none", results[0].Level)
+	assert.Equal(t, "fail", results[1].Kind)
+	assert.Equal(t, "error", results[1].Level)
+	assert.Equal(t, 0, results[1].RuleIndex)
+	assert.Contains(t, results[1].Properties, "resultOutputs")
+	assert.Equal(t, "fail", results[2].Kind)
+	assert.Equal(t, 1, results[2].RuleIndex)
+}
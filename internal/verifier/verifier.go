@@ -2,7 +2,10 @@ package verifier
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 const (
@@ -181,6 +184,34 @@ func (r *LegacyOutcome) GetResultString() string {
 	return b.String()
 }
 
+// Checks returns the names of the checks of the outcome, sorted
+func (r *LegacyOutcome) Checks() []string {
+	checks := make([]string, 0, len(r.Result))
+	for check := range r.Result {
+		checks = append(checks, check)
+	}
+	sort.Strings(checks)
+	return checks
+}
+
+// ResultOutputsJSON returns the result outputs stored for a check as indented JSON, or an empty
+// string if there are none
+func (r *LegacyOutcome) ResultOutputsJSON(check string) (string, error) {
+	outputs, ok := r.ResultOutputs[check]
+	if !ok || len(outputs) == 0 {
+		return "", nil
+	}
+	// Outputs are shown as they are, e.g. command output containing < and >
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(outputs); err != nil {
+		return "", fmt.Errorf("Error rendering result outputs of check %s: %w", check, err)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
 type LegacyStructuredOutput struct {
 	Results []*LegacyOutcome `json:"results" yaml:"results"`
 }
@@ -0,0 +1,195 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package webhook implements a malicious mutating admission webhook, which injects an environment
+// variable and a sidecar into the pods routed through it and records what it can read of the
+// Secrets routed through it
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Defaults of what the webhook injects
+const (
+	DefaultEnvName      = "WOODPECKER_INJECTED"
+	DefaultSidecarName  = "woodpecker-sidecar"
+	DefaultSidecarImage = "alpine:latest"
+)
+
+// The executor server serves the webhook on Port, when the CertDirEnv environment variable is
+// the directory its kubernetes.io/tls Secret is mounted in, with the serving certificate and key
+// in the tls.crt and tls.key files
+const (
+	Port            = 8443
+	Path            = "/mutate"
+	CertDirEnv      = "WEBHOOK_TLS_DIR"
+	SidecarImageEnv = "WEBHOOK_SIDECAR_IMAGE"
+)
+
+// maxReviews bounds the reviews kept by the webhook
+const maxReviews = 100
+
+// Injection is what the webhook injects into pods
+type Injection struct {
+	EnvName      string
+	SidecarName  string
+	SidecarImage string
+}
+
+// Review is an admission request routed through the webhook
+type Review struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	DryRun    bool   `json:"dryRun"`
+	// User is the user whose request was routed through the webhook
+	User string `json:"user"`
+	// Patched lists what was injected into a pod: env and sidecar
+	Patched []string `json:"patched,omitempty"`
+	// SecretKeys are the keys of the data of a Secret, SecretValues is set when their values could
+	// be read. The values are never kept.
+	SecretKeys   []string `json:"secretKeys,omitempty"`
+	SecretValues bool     `json:"secretValues,omitempty"`
+}
+
+// Server is the webhook, serving AdmissionReview requests
+type Server struct {
+	injection Injection
+
+	mu      sync.Mutex
+	reviews []Review
+}
+
+// NewServer returns a webhook injecting the Injection, with defaults for what it does not set
+func NewServer(injection Injection) *Server {
+	if injection.EnvName == "" {
+		injection.EnvName = DefaultEnvName
+	}
+	if injection.SidecarName == "" {
+		injection.SidecarName = DefaultSidecarName
+	}
+	if injection.SidecarImage == "" {
+		injection.SidecarImage = DefaultSidecarImage
+	}
+	return &Server{injection: injection}
+}
+
+// Reviews returns the admission requests routed through the webhook, oldest first
+func (s *Server) Reviews() []Review {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Review{}, s.reviews...)
+}
+
+// jsonPatch is an operation of a JSON patch
+type jsonPatch struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// ServeHTTP admits every request, patching pods
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var review admissionv1.AdmissionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "AdmissionReview has no request", http.StatusBadRequest)
+		return
+	}
+	request := review.Request
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	observed := Review{
+		Kind:      request.Kind.Kind,
+		Namespace: request.Namespace,
+		Name:      request.Name,
+		Operation: string(request.Operation),
+		DryRun:    request.DryRun != nil && *request.DryRun,
+		User:      request.UserInfo.Username,
+	}
+
+	switch request.Kind.Kind {
+	case "Pod":
+		var pod corev1.Pod
+		if err := json.Unmarshal(request.Object.Raw, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid pod: %s", err), http.StatusBadRequest)
+			return
+		}
+		if observed.Name == "" {
+			observed.Name = pod.Name
+		}
+		patch, patched := s.patch(&pod)
+		patchJSON, err := json.Marshal(patch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch = patchJSON
+		response.PatchType = &patchType
+		observed.Patched = patched
+	case "Secret":
+		var secret corev1.Secret
+		if err := json.Unmarshal(request.Object.Raw, &secret); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid secret: %s", err), http.StatusBadRequest)
+			return
+		}
+		if observed.Name == "" {
+			observed.Name = secret.Name
+		}
+		for key, value := range secret.Data {
+			observed.SecretKeys = append(observed.SecretKeys, key)
+			observed.SecretValues = observed.SecretValues || len(value) > 0
+		}
+		for key, value := range secret.StringData {
+			observed.SecretKeys = append(observed.SecretKeys, key)
+			observed.SecretValues = observed.SecretValues || len(value) > 0
+		}
+		sort.Strings(observed.SecretKeys)
+	}
+
+	s.mu.Lock()
+	if len(s.reviews) == maxReviews {
+		s.reviews = s.reviews[1:]
+	}
+	s.reviews = append(s.reviews, observed)
+	s.mu.Unlock()
+
+	review.Response = response
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(review)
+}
+
+// patch returns the JSON patch injecting the environment variable into every container of a pod
+// and adding the sidecar, with what it injects
+func (s *Server) patch(pod *corev1.Pod) ([]jsonPatch, []string) {
+	env := corev1.EnvVar{Name: s.injection.EnvName, Value: "true"}
+	var patch []jsonPatch
+	for i, container := range pod.Spec.Containers {
+		if len(container.Env) == 0 {
+			patch = append(patch, jsonPatch{Op: "add", Path: fmt.Sprintf("/spec/containers/%d/env", i), Value: []corev1.EnvVar{env}})
+		} else {
+			patch = append(patch, jsonPatch{Op: "add", Path: fmt.Sprintf("/spec/containers/%d/env/-", i), Value: env})
+		}
+	}
+	patch = append(patch, jsonPatch{Op: "add", Path: "/spec/containers/-", Value: corev1.Container{
+		Name:    s.injection.SidecarName,
+		Image:   s.injection.SidecarImage,
+		Command: []string{"sh", "-c", "while true; do sleep 3600; done"},
+		Env:     []corev1.EnvVar{env},
+	}})
+	return patch, []string{"env", "sidecar"}
+}
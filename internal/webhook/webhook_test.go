@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+)
+
+func TestNewCertificates(t *testing.T) {
+	certs, err := NewCertificates([]string{"hook.default.svc"}, time.Hour)
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair(certs.Cert, certs.Key)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certs.CA))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "hook.default.svc"}}}
+	response, err := client.Get(server.URL)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	// The certificate is only valid for its DNS names
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "other.default.svc"}}}
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	_, err = NewCertificates(nil, time.Hour)
+	assert.Error(t, err)
+}
+
+// admit sends an AdmissionReview for the object to the server
+func admit(t *testing.T, s *Server, kind string, object runtime.Object) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(object)
+	require.NoError(t, err)
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: kind},
+			Namespace: "default",
+			Operation: admissionv1.Create,
+			DryRun:    pointer.Bool(true),
+			UserInfo:  authenticationv1.UserInfo{Username: "admin"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+	body, err := json.Marshal(review)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response admissionv1.AdmissionReview
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.NotNil(t, response.Response)
+	assert.Equal(t, review.Request.UID, response.Response.UID)
+	assert.True(t, response.Response.Allowed)
+	return response.Response
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(Injection{})
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "probe", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "app", Image: "alpine"},
+			{Name: "proxy", Image: "envoy", Env: []corev1.EnvVar{{Name: "PORT", Value: "8080"}}},
+		}},
+	}
+	response := admit(t, s, "Pod", pod)
+	require.NotNil(t, response.PatchType)
+	assert.Equal(t, admissionv1.PatchTypeJSONPatch, *response.PatchType)
+	var patch []map[string]interface{}
+	require.NoError(t, json.Unmarshal(response.Patch, &patch))
+	require.Len(t, patch, 3)
+	assert.Equal(t, "/spec/containers/0/env", patch[0]["path"])
+	assert.Equal(t, "/spec/containers/1/env/-", patch[1]["path"])
+	assert.Equal(t, "/spec/containers/-", patch[2]["path"])
+	assert.Equal(t, DefaultSidecarName, patch[2]["value"].(map[string]interface{})["name"])
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "probe", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("hunter2"), "empty": nil},
+	}
+	response = admit(t, s, "Secret", secret)
+	assert.Nil(t, response.Patch)
+
+	assert.Equal(t, []Review{
+		{Kind: "Pod", Namespace: "default", Name: "probe", Operation: "CREATE", DryRun: true, User: "admin", Patched: []string{"env", "sidecar"}},
+		{Kind: "Secret", Namespace: "default", Name: "probe", Operation: "CREATE", DryRun: true, User: "admin", SecretKeys: []string{"empty", "password"}, SecretValues: true},
+	}, s.Reviews())
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
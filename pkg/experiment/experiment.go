@@ -0,0 +1,142 @@
+/*
+Copyright 2023 Operant AI
+*/
+
+// Package experiment is the public API of woodpecker experiments. Experiments that are not part
+// of woodpecker are executables speaking a JSON protocol over stdio: woodpecker starts the
+// executable for every call, writes a Request to its stdin and reads a Response from its stdout,
+// while its stderr is shown to the user. Serve implements the protocol for experiments written
+// in Go.
+//
+// Executables are discovered by their name, woodpecker-experiment-<name>, in the directories of
+// the WOODPECKER_PLUGIN_PATH environment variable, once an experiment file names a type that is
+// not part of woodpecker.
+package experiment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PluginPrefix is the prefix of the names of experiment executables
+const PluginPrefix = "woodpecker-experiment-"
+
+// PluginPathEnv lists the directories searched for experiment executables, PATH is not searched
+const PluginPathEnv = "WOODPECKER_PLUGIN_PATH"
+
+// Results of the checks of an Outcome
+const (
+	Success = "success"
+	Fail    = "fail"
+)
+
+// Experiment is an attack woodpecker runs, verifies and cleans up
+type Experiment interface {
+	// Info describes the experiment and maps it to an attack framework
+	Info() Info
+	// Run runs the experiment, results stored with Config.StoreResult are passed to Verify and
+	// Cleanup
+	Run(ctx context.Context, config *Config) error
+	// Verify checks whether the attack of the experiment succeeded
+	Verify(ctx context.Context, config *Config) (*Outcome, error)
+	// Cleanup removes everything the experiment created
+	Cleanup(ctx context.Context, config *Config) error
+}
+
+// Info describes an experiment type
+type Info struct {
+	// Type is the type experiment files refer to the experiment by
+	Type string `json:"type"`
+	// Description describes the experiment in a brief sentence
+	Description string `json:"description"`
+	// Framework is the attack framework, e.g. MITRE or MITRE-ATLAS
+	Framework string `json:"framework"`
+	// Tactic is the attack tactic of the framework
+	Tactic string `json:"tactic"`
+	// Technique is the attack technique of the framework
+	Technique string `json:"technique"`
+}
+
+// Metadata is the metadata of an experiment in an experiment file
+type Metadata struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Type      string            `json:"type"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+}
+
+// Config is the configuration of an experiment in an experiment file
+type Config struct {
+	Metadata Metadata `json:"metadata"`
+	// Parameters are the parameters of the experiment, decode them with DecodeParameters
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	// RunID identifies the run of the experiment
+	RunID string `json:"runId,omitempty"`
+	// Results are the results stored by Run, oldest first, set for Verify and Cleanup
+	Results []json.RawMessage `json:"results,omitempty"`
+
+	// stored are the results stored by Run
+	stored []json.RawMessage
+}
+
+// DecodeParameters decodes the parameters of the experiment into v
+func (c *Config) DecodeParameters(v interface{}) error {
+	if len(c.Parameters) == 0 {
+		return fmt.Errorf("Experiment %s is missing parameters", c.Metadata.Name)
+	}
+	if err := json.Unmarshal(c.Parameters, v); err != nil {
+		return fmt.Errorf("Failed to decode parameters of experiment %s: %w", c.Metadata.Name, err)
+	}
+	return nil
+}
+
+// StoreResult stores a result of Run in the result store of woodpecker, so that it is passed
+// to Verify and Cleanup, possibly on another machine
+func (c *Config) StoreResult(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("Failed to encode result: %w", err)
+	}
+	c.stored = append(c.stored, data)
+	return nil
+}
+
+// Outcome is the outcome of verifying an experiment
+type Outcome struct {
+	// Result maps the name of every check to Success or Fail
+	Result map[string]string `json:"result"`
+	// ResultOutputs are the outputs of every check, shown in reports
+	ResultOutputs map[string][]interface{} `json:"result_outputs,omitempty"`
+}
+
+// NewOutcome returns an Outcome without checks
+func NewOutcome() *Outcome {
+	return &Outcome{Result: make(map[string]string), ResultOutputs: make(map[string][]interface{})}
+}
+
+// Success marks a check as successful, along with its outputs
+func (o *Outcome) Success(check string, outputs ...interface{}) {
+	o.set(check, Success, outputs)
+}
+
+// Fail marks a check as failed, along with its outputs
+func (o *Outcome) Fail(check string, outputs ...interface{}) {
+	o.set(check, Fail, outputs)
+}
+
+func (o *Outcome) set(check, result string, outputs []interface{}) {
+	if o.Result == nil {
+		o.Result = make(map[string]string)
+	}
+	o.Result[check] = result
+	if len(outputs) == 0 {
+		return
+	}
+	if o.ResultOutputs == nil {
+		o.ResultOutputs = make(map[string][]interface{})
+	}
+	o.ResultOutputs[check] = append(o.ResultOutputs[check], outputs...)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 Operant AI
+*/
+package experiment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ProtocolVersion is the version of the protocol spoken over stdio
+const ProtocolVersion = 1
+
+// Methods of the protocol
+const (
+	// MethodInfo returns the Info of the experiment
+	MethodInfo = "info"
+	// MethodRun runs the experiment, returning the results it stored
+	MethodRun = "run"
+	// MethodVerify verifies the experiment, returning its Outcome
+	MethodVerify = "verify"
+	// MethodCleanup cleans up the experiment
+	MethodCleanup = "cleanup"
+)
+
+// Request is written by woodpecker to the stdin of an experiment executable
+type Request struct {
+	// Version is the ProtocolVersion of woodpecker
+	Version int    `json:"version"`
+	Method  string `json:"method"`
+	// Config is the configuration of the experiment, for every method but info
+	Config *Config `json:"config,omitempty"`
+}
+
+// Response is written by an experiment executable to its stdout
+type Response struct {
+	// Version is the ProtocolVersion of the executable
+	Version int `json:"version"`
+	// Info is the response to info
+	Info *Info `json:"info,omitempty"`
+	// Results are the results stored by run
+	Results []json.RawMessage `json:"results,omitempty"`
+	// Outcome is the response to verify
+	Outcome *Outcome `json:"outcome,omitempty"`
+	// Error is the error the method failed with, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Serve answers the request on stdin with a response on stdout, it is the main function of
+// experiment executables. Experiments should write logs to stderr. It exits with a non-zero
+// status if the request cannot be answered.
+func Serve(e Experiment) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := ServeIO(ctx, e, os.Stdin, os.Stdout)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// ServeIO reads a request from r, calls the method of the experiment and writes the response
+// to w. Errors of the experiment are part of the response, the returned error is only set if
+// the request could not be read or the response could not be written.
+func ServeIO(ctx context.Context, e Experiment, r io.Reader, w io.Writer) error {
+	var req Request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return fmt.Errorf("Failed to read request: %w", err)
+	}
+
+	resp := handle(ctx, e, &req)
+	resp.Version = ProtocolVersion
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return fmt.Errorf("Failed to write response: %w", err)
+	}
+	return nil
+}
+
+func handle(ctx context.Context, e Experiment, req *Request) *Response {
+	if req.Version != ProtocolVersion {
+		return &Response{Error: fmt.Sprintf("Unsupported protocol version %d, expected %d", req.Version, ProtocolVersion)}
+	}
+	if req.Method == MethodInfo {
+		info := e.Info()
+		return &Response{Info: &info}
+	}
+	if req.Config == nil {
+		return &Response{Error: fmt.Sprintf("Request %s is missing the experiment config", req.Method)}
+	}
+
+	resp := &Response{}
+	var err error
+	switch req.Method {
+	case MethodRun:
+		err = e.Run(ctx, req.Config)
+		resp.Results = req.Config.stored
+	case MethodVerify:
+		resp.Outcome, err = e.Verify(ctx, req.Config)
+	case MethodCleanup:
+		err = e.Cleanup(ctx, req.Config)
+	default:
+		err = fmt.Errorf("Unknown method %s", req.Method)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
@@ -0,0 +1,116 @@
+package experiment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeExperiment struct{}
+
+func (fakeExperiment) Info() Info {
+	return Info{Type: "fake", Description: "Fake experiment", Framework: "MITRE", Tactic: "Execution", Technique: "Fake"}
+}
+
+func (fakeExperiment) Run(ctx context.Context, config *Config) error {
+	var parameters struct {
+		Target string `json:"target"`
+	}
+	if err := config.DecodeParameters(&parameters); err != nil {
+		return err
+	}
+	return config.StoreResult(map[string]string{"target": parameters.Target})
+}
+
+func (fakeExperiment) Verify(ctx context.Context, config *Config) (*Outcome, error) {
+	outcome := NewOutcome()
+	if len(config.Results) > 0 {
+		outcome.Success("reached", json.RawMessage(config.Results[0]))
+	} else {
+		outcome.Fail("reached")
+	}
+	return outcome, nil
+}
+
+func (fakeExperiment) Cleanup(ctx context.Context, config *Config) error {
+	return errors.New("Cleanup failed")
+}
+
+func TestServeIO(t *testing.T) {
+	config := &Config{
+		Metadata:   Metadata{Name: "fake", Type: "fake"},
+		Parameters: json.RawMessage(`{"target": "api"}`),
+	}
+
+	tests := []struct {
+		name     string
+		request  Request
+		expected Response
+	}{
+		{
+			name:     "Info",
+			request:  Request{Version: ProtocolVersion, Method: MethodInfo},
+			expected: Response{Info: &Info{Type: "fake", Description: "Fake experiment", Framework: "MITRE", Tactic: "Execution", Technique: "Fake"}},
+		},
+		{
+			name:     "Run returns the stored results",
+			request:  Request{Version: ProtocolVersion, Method: MethodRun, Config: config},
+			expected: Response{Results: []json.RawMessage{json.RawMessage(`{"target":"api"}`)}},
+		},
+		{
+			name:    "Verify",
+			request: Request{Version: ProtocolVersion, Method: MethodVerify, Config: &Config{Metadata: config.Metadata, Results: []json.RawMessage{json.RawMessage(`{"target":"api"}`)}}},
+			expected: Response{Outcome: &Outcome{
+				Result:        map[string]string{"reached": Success},
+				ResultOutputs: map[string][]interface{}{"reached": {map[string]interface{}{"target": "api"}}},
+			}},
+		},
+		{
+			name:     "Errors are part of the response",
+			request:  Request{Version: ProtocolVersion, Method: MethodCleanup, Config: config},
+			expected: Response{Error: "Cleanup failed"},
+		},
+		{
+			name:     "Missing parameters",
+			request:  Request{Version: ProtocolVersion, Method: MethodRun, Config: &Config{Metadata: config.Metadata}},
+			expected: Response{Error: "Experiment fake is missing parameters"},
+		},
+		{
+			name:     "Missing config",
+			request:  Request{Version: ProtocolVersion, Method: MethodRun},
+			expected: Response{Error: "Request run is missing the experiment config"},
+		},
+		{
+			name:     "Unknown method",
+			request:  Request{Version: ProtocolVersion, Method: "destroy", Config: config},
+			expected: Response{Error: "Unknown method destroy"},
+		},
+		{
+			name:     "Unsupported version",
+			request:  Request{Version: ProtocolVersion + 1, Method: MethodInfo},
+			expected: Response{Error: "Unsupported protocol version 2, expected 1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := json.Marshal(test.request)
+			require.NoError(t, err)
+			var out bytes.Buffer
+			require.NoError(t, ServeIO(context.Background(), fakeExperiment{}, bytes.NewReader(request), &out))
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(out.Bytes(), &resp))
+			test.expected.Version = ProtocolVersion
+			assert.Equal(t, test.expected, resp)
+		})
+	}
+
+	assert.Error(t, ServeIO(context.Background(), fakeExperiment{}, strings.NewReader("not json"), &bytes.Buffer{}))
+}